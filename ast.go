@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+)
+
+/*
+** Typed syntax trees, from labelled rules.
+**
+** A rule may be followed, where a precedence mark may be, by a label in
+** angle brackets that names a Go struct type:
+**
+**     %type expr {Expr}
+**     expr ::= expr(X) PLUS|MINUS(Op) expr(Y).   <BinaryExpr>
+**     expr ::= expr(X) TIMES(Op) expr(Y).        <BinaryExpr>
+**     expr ::= ID(Name) LP expr % COMMA (Args) RP. <CallExpr>
+**     expr(A) ::= LP expr(B) RP.                  { A = B }
+**
+** The %type of a nonterminal with labelled rules must be a type name,
+** which golemon declares as a sealed interface.  Each label becomes a
+** struct that implements it, with a field for each symbol of the rule
+** that has an alias, named by the alias, and holding the symbol's value:
+**
+**     type Expr interface {
+**         isExpr()
+**     }
+**
+**     type BinaryExpr struct {
+**         Loc ParseLocation // Where the text of the rule starts
+**         X   Expr
+**         Op  ParseTOKENTYPE
+**         Y   Expr
+**     }
+**
+**     func (*BinaryExpr) isExpr() {}
+**
+** A labelled rule must not have an action of its own: the parser gives
+** it one that sets the left-hand side to a new struct.  The values of
+** symbols without an alias are destroyed as usual.  Rules may share a
+** label if their aliases and their types are the same, in the same
+** order, and several nonterminals may share an interface.  The rules of
+** the nonterminal that have no label keep their actions, as the last
+** rule above does.
+ */
+
+/* A type declared for labelled rules */
+type astdecl struct {
+	name   string   /* The name of the type */
+	iface  string   /* The interface it implements, or "" if it is one */
+	fields []string /* The name and type of each field after Loc */
+	rules  []*rule  /* The rules with this label */
+}
+
+/* Return the Go type of the value of sp, as a field of a struct */
+func ast_fieldtype(lemp *lemon, sp *symbol) string {
+	name := lemp.name
+	if name == "" {
+		name = "Parse"
+	}
+	if sp.typ == NONTERMINAL {
+		if typ := cst_valuetype(lemp, sp); typ != "" {
+			return typ
+		}
+	}
+	return name + "TOKENTYPE"
+}
+
+/* Give each labelled rule its action, and record the types to declare.
+** Must be called before index_grammar() numbers the rules, as rules with
+** actions are numbered first. */
+func ast_actions(lemp *lemon) {
+	decls := make(map[string]*astdecl)
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.label == "" {
+			continue
+		}
+		iface := strings.TrimSpace(rp.lhs.datatype)
+		if !token.IsIdentifier(iface) {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"The %%type of \"%s\" must name the interface of its labelled rules.", rp.lhs.name)
+			lemp.errorcnt++
+			continue
+		}
+		if !token.IsIdentifier(rp.label) {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"The label \"%s\" is not a Go type name.", rp.label)
+			lemp.errorcnt++
+			continue
+		}
+		if rp.code != "" {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"The rule labelled <%s> can't also have an action.", rp.label)
+			lemp.errorcnt++
+			continue
+		}
+		var fields, values []string
+		for i, sp := range rp.rhs {
+			alias := rp.rhsalias[i]
+			if alias == "" {
+				continue
+			}
+			if alias == "Loc" {
+				ErrorMsg(rp.filename, rp.ruleline,
+					"The alias \"Loc\" is taken by the field that holds the location of <%s>.", rp.label)
+				lemp.errorcnt++
+			}
+			fields = append(fields, alias+" "+ast_fieldtype(lemp, sp))
+			values = append(values, alias)
+		}
+
+		if d := decls[iface]; d == nil {
+			d = &astdecl{name: iface}
+			decls[iface] = d
+			lemp.astdecls = append(lemp.astdecls, d)
+		} else if d.iface != "" {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"\"%s\" is both the label of a rule and the %%type of \"%s\".", iface, rp.lhs.name)
+			lemp.errorcnt++
+			continue
+		}
+		d := decls[rp.label]
+		if d == nil {
+			d = &astdecl{name: rp.label, iface: iface, fields: fields}
+			decls[rp.label] = d
+			lemp.astdecls = append(lemp.astdecls, d)
+		} else if d.iface == "" {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"\"%s\" is both the label of a rule and the %%type of a nonterminal.", rp.label)
+			lemp.errorcnt++
+			continue
+		} else if d.iface != iface {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"The label <%s> is used for values of both %s and %s.", rp.label, d.iface, iface)
+			lemp.errorcnt++
+			continue
+		} else if strings.Join(d.fields, "; ") != strings.Join(fields, "; ") {
+			ErrorMsg(rp.filename, rp.ruleline,
+				"The rules labelled <%s> on lines %d and %d differ in their aliases or in their types.",
+				rp.label, d.rules[0].ruleline, rp.ruleline)
+			lemp.errorcnt++
+			continue
+		}
+		d.rules = append(d.rules, rp)
+
+		loc := "yypParser.yyloc"
+		if n := len(rp.rhs); n == 1 {
+			loc = "yypParser.yystack[yypParser.yytos].loc"
+		} else if n > 1 {
+			loc = fmt.Sprintf("yypParser.yystack[yypParser.yytos-%d].loc", n-1)
+		}
+		if rp.lhsalias == "" {
+			rp.lhsalias = "yyast"
+		}
+		/* The fields are given in order, as an alias would be replaced
+		 ** in a field name too */
+		rp.code = fmt.Sprintf(" %s = &%s{%s} ", rp.lhsalias, rp.label, strings.Join(append([]string{loc}, values...), ", "))
+		rp.line = rp.ruleline
+		rp.noCode = false
+	}
+}
+
+/* Write the types of the labelled rules to out, after the rest of the
+** parser */
+func ast_output(out *os.File, lemp *lemon, lineno *int) {
+	name := lemp.name
+	if name == "" {
+		name = "Parse"
+	}
+	var b strings.Builder
+	for _, d := range lemp.astdecls {
+		if d.iface == "" {
+			fmt.Fprintf(&b, "\n/* The value of each nonterminal whose %%type is %s */\n", d.name)
+			fmt.Fprintf(&b, "type %s interface {\n\tis%s()\n}\n", d.name, d.name)
+			continue
+		}
+		fmt.Fprintf(&b, "\n/* A %s, made by", d.name)
+		for _, rp := range d.rules {
+			if rp.sugar != "" {
+				fmt.Fprintf(&b, "\n**     %s.", rp.sugar)
+				continue
+			}
+			fmt.Fprintf(&b, "\n**     %s ::=", rp.lhs.name)
+			for i, sp := range rp.rhs {
+				if sp.typ == MULTITERMINAL {
+					fmt.Fprintf(&b, " %s", sp.subsym[0].name)
+					for _, ss := range sp.subsym[1:] {
+						fmt.Fprintf(&b, "|%s", ss.name)
+					}
+				} else {
+					fmt.Fprintf(&b, " %s", sp.name)
+				}
+				if rp.rhsalias[i] != "" {
+					fmt.Fprintf(&b, "(%s)", rp.rhsalias[i])
+				}
+			}
+			fmt.Fprintf(&b, ".")
+		}
+		fmt.Fprintf(&b, "\n */\ntype %s struct {\n", d.name)
+		fmt.Fprintf(&b, "\tLoc %sLocation /* Where the text of the rule starts */\n", name)
+		for _, f := range d.fields {
+			fmt.Fprintf(&b, "\t%s\n", f)
+		}
+		fmt.Fprintf(&b, "}\n\nfunc (*%s) is%s() {}\n", d.name, d.iface)
+	}
+	fmt.Fprintf(out, "%s", b.String())
+	*lineno += strings.Count(b.String(), "\n")
+}
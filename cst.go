@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+** A concrete syntax tree, built by the parser itself.
+**
+** With -cst, nonterminals that have no %type (and there is no
+** %default_type) carry a *ParseNode, and each rule of such a nonterminal
+** that has no action is given one that builds a node:
+**
+**     type ParseNode struct {
+**         Rule     int            // The rule, as in yyRuleName, or -1
+**         Symbol   YYCODETYPE     // The rule's left-hand side, or a token
+**         Children []*ParseNode   // One per symbol of the right-hand side
+**         Token    ParseTOKENTYPE // The value of a token
+**         Value    interface{}    // The value of a nonterminal of another type
+**         Loc      ParseLocation  // Where the symbol starts
+**         Trivia   string         // Text skipped before a token
+**     }
+**
+** A token on the right-hand side becomes a leaf with Rule -1, holding its
+** value, its location and its trivia: the text, such as white space and
+** comments, that the lexer skipped before it.  ParseAll() takes these
+** from the ParseLexer, and from its Trivia() method if it has one, as
+** the lexer built from %token_pattern does.  Push-mode callers give them
+** with ParseSetLocation() before each Parse().  A nonterminal whose
+** %type is not *ParseNode becomes a leaf holding its value in Value.
+**
+** Rules with actions keep them, so a grammar can build its own nodes, or
+** values of other types, where it needs to.  The root that ParseAll()
+** returns has as its Trivia the text after the last token.
+**
+** ParseWalk() and ParseInspect() visit a tree in the manner of go/ast,
+** ParseFprint() prints it, one node to a line, and ParseFprintSource()
+** prints the trivia and the value of each token in turn, which gives
+** back the input where the token values are their text.
+ */
+
+/* Return the Go type of the nodes of the syntax tree */
+func cst_nodetype(lemp *lemon) string {
+	name := lemp.name
+	if name == "" {
+		name = "Parse"
+	}
+	return "*" + name + "Node"
+}
+
+/* Return the Go type of the value carried by the nonterminal sp, once
+** the whole grammar has been read */
+func cst_valuetype(lemp *lemon, sp *symbol) string {
+	if sp.datatype != "" {
+		return strings.TrimSpace(sp.datatype)
+	}
+	return strings.TrimSpace(lemp.vartype)
+}
+
+/* Give an action that builds a node to each rule that has none and
+** whose left-hand side is a node.  Must be called, once %default_type
+** has been made the node type if it was not given, before
+** index_grammar() numbers the rules, as rules with actions are numbered
+** first. */
+func cst_actions(lemp *lemon) {
+	nodetype := cst_nodetype(lemp)
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.code != "" || cst_valuetype(lemp, rp.lhs) != nodetype {
+			continue
+		}
+		if rp.lhsalias == "" {
+			rp.lhsalias = "yynode"
+		}
+		children := []string{"yyruleno"}
+		for i, sp := range rp.rhs {
+			offset := i - len(rp.rhs) + 1
+			if sp.name == "error" {
+				children = append(children, fmt.Sprintf("yypParser.yy_cst_value(%d, nil)", offset))
+				continue
+			}
+			if rp.rhsalias[i] == "" {
+				rp.rhsalias[i] = fmt.Sprintf("yyrhs%d", i)
+			}
+			sp.bContent = true
+			alias := rp.rhsalias[i]
+			switch {
+			case sp.typ != NONTERMINAL:
+				children = append(children, fmt.Sprintf("yypParser.yy_cst_leaf(%d, %s)", offset, alias))
+			case cst_valuetype(lemp, sp) == nodetype:
+				children = append(children, alias)
+			default:
+				children = append(children, fmt.Sprintf("yypParser.yy_cst_value(%d, %s)", offset, alias))
+			}
+		}
+		rp.code = fmt.Sprintf(" %s = yypParser.yy_cst_node(%s) ", rp.lhsalias, strings.Join(children, ", "))
+		rp.line = rp.ruleline
+		rp.noCode = false
+	}
+}
+
+/* Write the syntax tree types and functions to out, after the rest of
+** the parser */
+func cst_output(out *os.File, lemp *lemon, lineno *int) {
+	tplt_xfer(lemp.name, bufio.NewReader(strings.NewReader(cstTemplate)), out, lineno)
+}
+
+/* The code of the syntax tree.  "Parse" at the start of a word is
+** replaced by the %name of the parser. */
+const cstTemplate = `
+/* A node of the concrete syntax tree.  A node made by a rule has Rule
+** set to the rule's number and Symbol to its left-hand side, with one
+** child for each symbol of the right-hand side.  A leaf has Rule -1, and
+** holds the value of a token in Token or that of a nonterminal whose type
+** is not a node in Value.
+ */
+type ParseNode struct {
+	Rule     int            /* The rule that made the node, or -1 for a leaf */
+	Symbol   YYCODETYPE     /* The rule's left-hand side, or the leaf's symbol */
+	Children []*ParseNode   /* One for each symbol of the rule's right-hand side */
+	Token    ParseTOKENTYPE /* The value of a token */
+	Value    interface{}    /* The value of a nonterminal that is not a node */
+	Loc      ParseLocation  /* Where the symbol starts */
+	Trivia   string         /* Text skipped before a token, or after the input */
+}
+
+/* Return the name of the node's symbol */
+func (n *ParseNode) Name() string {
+	return yyTokenName[n.Symbol]
+}
+
+/* Return true if the node is a token other than "error" */
+func (n *ParseNode) IsToken() bool {
+	return n.Rule < 0 && int(n.Symbol) < YYNTOKEN && int(n.Symbol) != YYERRORSYMBOL
+}
+
+/* Return a node for the rule yyruleno, which starts where the first of
+** children that is not nil does, if any.  A child is nil where error
+** recovery put the zero value in place of a nonterminal. */
+func (yypParser *yyParser) yy_cst_node(yyruleno YYACTIONTYPE, children ...*ParseNode) *ParseNode {
+	n := &ParseNode{Rule: int(yyruleno), Symbol: yyRuleInfoLhs[yyruleno], Children: children, Loc: yypParser.yyloc}
+	for _, c := range children {
+		if c != nil {
+			n.Loc = c.Loc
+			break
+		}
+	}
+	return n
+}
+
+/* Return a leaf for the token at offset i from the top of the stack */
+func (yypParser *yyParser) yy_cst_leaf(i int, token ParseTOKENTYPE) *ParseNode {
+	yytos := &yypParser.yystack[yypParser.yytos+i]
+	return &ParseNode{Rule: -1, Symbol: yytos.major, Token: token, Loc: yytos.loc, Trivia: yytos.trivia}
+}
+
+/* Return a leaf for the nonterminal at offset i from the top of the stack */
+func (yypParser *yyParser) yy_cst_value(i int, value interface{}) *ParseNode {
+	yytos := &yypParser.yystack[yypParser.yytos+i]
+	return &ParseNode{Rule: -1, Symbol: yytos.major, Value: value, Loc: yytos.loc}
+}
+
+/* A ParseVisitor's Visit method is called for each node found by
+** ParseWalk().  If the visitor w it returns is not nil, ParseWalk()
+** visits each of the node's children with w, then calls w.Visit(nil).
+ */
+type ParseVisitor interface {
+	Visit(n *ParseNode) (w ParseVisitor)
+}
+
+/* Visit the tree n in depth-first order, as go/ast.Walk does */
+func ParseWalk(v ParseVisitor, n *ParseNode) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+	for _, c := range n.Children {
+		if c != nil {
+			ParseWalk(v, c)
+		}
+	}
+	v.Visit(nil)
+}
+
+type yyInspector func(*ParseNode) bool
+
+func (f yyInspector) Visit(n *ParseNode) ParseVisitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+/* Call f for each node of the tree n in depth-first order.  If f returns
+** true, ParseInspect() visits the children of the node, then calls
+** f(nil). */
+func ParseInspect(n *ParseNode, f func(*ParseNode) bool) {
+	ParseWalk(yyInspector(f), n)
+}
+
+/* Print the tree n to w, one node to a line, indented by depth.  A node
+** made by a rule is shown as the rule, and a leaf as its symbol and its
+** value, with its location and trivia.
+ */
+func ParseFprint(w io.Writer, n *ParseNode) error {
+	var err error
+	depth := 0
+	ParseInspect(n, func(n *ParseNode) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		if err != nil {
+			return false
+		}
+		switch {
+		case n.Rule >= 0:
+			_, err = fmt.Fprintf(w, "%*s%s\n", 2*depth, "", yyRuleName[n.Rule])
+		case n.IsToken():
+			_, err = fmt.Fprintf(w, "%*s%s %#v %s", 2*depth, "", n.Name(), n.Token, n.Loc)
+			if err == nil && n.Trivia != "" {
+				_, err = fmt.Fprintf(w, " trivia %q", n.Trivia)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "\n")
+			}
+		default:
+			_, err = fmt.Fprintf(w, "%*s%s %#v %s\n", 2*depth, "", n.Name(), n.Value, n.Loc)
+		}
+		depth++
+		return true
+	})
+	return err
+}
+
+/* Print to w the trivia and the value of each token of the tree n, in
+** order, then the trivia of n itself, which for the root returned by
+** ParseAll() is the text after the last token.  Where the value of each
+** token is its text, as with the lexer built from %token_pattern, this
+** prints the text that was parsed.
+ */
+func ParseFprintSource(w io.Writer, n *ParseNode) error {
+	var err error
+	ParseInspect(n, func(c *ParseNode) bool {
+		if c == nil || err != nil {
+			return false
+		}
+		if c.IsToken() {
+			if _, err = io.WriteString(w, c.Trivia); err == nil {
+				_, err = fmt.Fprint(w, c.Token)
+			}
+		}
+		return true
+	})
+	if err == nil && n != nil && n.Rule >= 0 {
+		_, err = io.WriteString(w, n.Trivia)
+	}
+	return err
+}
+`
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+** Unified diffs, for -check.
+**
+** The difference between two files is found with Myers' O(ND) algorithm,
+** after removing the lines the two files have in common at either end.
+** Generated parsers that are out of date usually differ in a handful of
+** places, so D is small.  If it is not, the whole of the middle of the
+** files is shown as replaced rather than spending time and memory on
+** an exact answer.
+ */
+
+/* Largest number of differing lines for which an exact diff is found */
+const MAXDIFF = 2000
+
+/* Lines of context around each change in a unified diff */
+const DIFFCONTEXT = 3
+
+/* One line of a diff */
+type diffop struct {
+	kind byte /* ' ' for a common line, '-' for a deleted line, '+' for an added one */
+	a    int  /* Index of the line in the old file, or where it would be */
+	b    int  /* Index of the line in the new file, or where it would be */
+}
+
+/* Find the differences between the lines a[lo:ahi] and b[lo:bhi] with
+** Myers' algorithm, and append them to ops.  Return nil if there are more
+** than MAXDIFF of them. */
+func diff_middle(ops []diffop, a, b []string, lo, ahi, bhi int) []diffop {
+	n, m := ahi-lo, bhi-lo
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	d := 0
+search:
+	for ; d <= max; d++ {
+		if d > MAXDIFF {
+			return nil
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[lo+x] == b[lo+y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	/* Walk back through the trace to recover the edit script */
+	var rev []diffop
+	x, y := n, m
+	for ; d >= 0; d-- {
+		var prevx, prevy int
+		if d > 0 {
+			snap := trace[d]
+			k := x - y
+			var prevk int
+			if k == -d || (k != d && snap[k-1+d] < snap[k+1+d]) {
+				prevk = k + 1
+			} else {
+				prevk = k - 1
+			}
+			prevx = snap[prevk+d]
+			prevy = prevx - prevk
+		}
+		for x > prevx && y > prevy {
+			x--
+			y--
+			rev = append(rev, diffop{' ', lo + x, lo + y})
+		}
+		if d > 0 {
+			if x == prevx {
+				y--
+				rev = append(rev, diffop{'+', lo + x, lo + y})
+			} else {
+				x--
+				rev = append(rev, diffop{'-', lo + x, lo + y})
+			}
+		}
+	}
+	for i := len(rev) - 1; i >= 0; i-- {
+		ops = append(ops, rev[i])
+	}
+	return ops
+}
+
+/* Return the edit script that turns the lines a into the lines b */
+func diff_lines(a, b []string) []diffop {
+	lo := 0
+	for lo < len(a) && lo < len(b) && a[lo] == b[lo] {
+		lo++
+	}
+	ahi, bhi := len(a), len(b)
+	for ahi > lo && bhi > lo && a[ahi-1] == b[bhi-1] {
+		ahi--
+		bhi--
+	}
+	var ops []diffop
+	for i := 0; i < lo; i++ {
+		ops = append(ops, diffop{' ', i, i})
+	}
+	if mid := diff_middle(ops, a, b, lo, ahi, bhi); mid != nil {
+		ops = mid
+	} else {
+		for i := lo; i < ahi; i++ {
+			ops = append(ops, diffop{'-', i, lo})
+		}
+		for i := lo; i < bhi; i++ {
+			ops = append(ops, diffop{'+', ahi, i})
+		}
+	}
+	for i := 0; i < len(a)-ahi; i++ {
+		ops = append(ops, diffop{' ', ahi + i, bhi + i})
+	}
+	return ops
+}
+
+/* Split text into lines, each keeping its newline */
+func diff_split(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+/* Write the line of a diff for one line of a file */
+func diff_line(w io.Writer, kind byte, line string) {
+	fmt.Fprintf(w, "%c%s", kind, line)
+	if !strings.HasSuffix(line, "\n") {
+		fmt.Fprintf(w, "\n\\ No newline at end of file\n")
+	}
+}
+
+/* Write a unified diff that turns old, called aname, into new, called
+** bname.  Return false, writing nothing, if they are the same. */
+func unified_diff(w io.Writer, aname string, bname string, old string, new string) bool {
+	if old == new {
+		return false
+	}
+	a, b := diff_split(old), diff_split(new)
+	ops := diff_lines(a, b)
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", aname, bname)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		/* Extend the hunk while the next change is close enough that
+		** the contexts would overlap */
+		start := i - DIFFCONTEXT
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j <= end+2*DIFFCONTEXT; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		stop := end + DIFFCONTEXT + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		na, nb := 0, 0
+		for _, op := range ops[start:stop] {
+			if op.kind != '+' {
+				na++
+			}
+			if op.kind != '-' {
+				nb++
+			}
+		}
+		sa, sb := ops[start].a+1, ops[start].b+1
+		if na == 0 {
+			sa--
+		}
+		if nb == 0 {
+			sb--
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", sa, na, sb, nb)
+		for _, op := range ops[start:stop] {
+			switch op.kind {
+			case '+':
+				diff_line(w, '+', b[op.b])
+			default:
+				diff_line(w, op.kind, a[op.a])
+			}
+		}
+		i = stop
+	}
+	return true
+}
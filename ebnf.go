@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+** EBNF operators on the right-hand side of rules.
+**
+** The following forms may appear wherever a symbol may appear on the
+** right-hand side of a rule:
+**
+**     X?            Zero or one X.
+**     X*            Zero or more X.
+**     X+            One or more X.
+**     X % SEP       One or more X, separated by SEP.
+**     ( A B ... )   A group of symbols, treated as a single element.
+**
+** Each operator is desugared into a synthetic nonterminal, named after
+** the operator in the style of Menhir's standard library:
+**
+**     X?            option(X) ::= .          option(X) ::= X.
+**     X*            list(X) ::= .            list(X) ::= list(X) X.
+**     X+            nonempty_list(X) ::= X.  nonempty_list(X) ::= nonempty_list(X) X.
+**     X % SEP       separated_nonempty_list(SEP,X) ::= X.
+**                   separated_nonempty_list(SEP,X) ::= separated_nonempty_list(SEP,X) SEP X.
+**     ( A B )       group(A B) ::= A B.
+**     ( A B(X) )    group(A B(*)) ::= A B.
+**
+** These names cannot clash with user symbols, because the tokenizer never
+** produces an identifier containing parentheses.  Identical uses share a
+** single synthetic nonterminal.
+**
+** If the element carries a value (it is a terminal and %token_type is set,
+** or it is a nonterminal with a %type or a %default_type) then the
+** synthetic nonterminal carries one too:
+**
+**     X?            The value of X, or the zero value of its type.
+**     X*, X+, X%S   A slice []T of the values of each X.
+**     ( ... )       The value of the one element in the group that has
+**                   an alias, if any.  For example (COMMA expr(E))* is
+**                   a list of expr values.
+**
+** A group must hold more than one symbol: "X (A)" is always read as
+** the symbol X with alias A.  After an aliased symbol, as in
+** "X(A) (B C)", a "(" always begins a group.
+ */
+
+/* Information about one synthetic nonterminal */
+type ebnfsym struct {
+	sp       *symbol   /* The synthetic nonterminal */
+	kind     string    /* "option", "list", "nonempty_list", "separated_nonempty_list" or "group" */
+	elem     *symbol   /* The optional or repeated element (not used by groups) */
+	sep      *symbol   /* The separator of a separated_nonempty_list */
+	rhs      []*symbol /* The contents of a group */
+	iValue   int       /* Group element whose value is the group's value, or -1 */
+	filename string    /* File in which the operator was first used */
+	lineno   int       /* Line at which the operator was first used */
+	rules    []*rule   /* The rules of sp, in order */
+}
+
+/* The partially parsed right-hand side outside of an open group */
+type ebnfframe struct {
+	rhs     []*symbol
+	alias   []string
+	rhstext []string
+	lineno  int
+}
+
+/* The name of symbol sp as it appears in a rule */
+func ebnf_symname(sp *symbol) string {
+	if sp.typ != MULTITERMINAL {
+		return sp.name
+	}
+	names := make([]string, len(sp.subsym))
+	for i, ss := range sp.subsym {
+		names[i] = ss.name
+	}
+	return strings.Join(names, "|")
+}
+
+/* Write an RHS element as it appeared in the input, with its alias */
+func ebnf_element(text string, alias string) string {
+	if alias == "" {
+		return text
+	}
+	return text + "(" + alias + ")"
+}
+
+/* Create a rule for a synthetic nonterminal.  Rules are kept aside and
+** added to the end of the rule list by ebnf_finish(), so that a synthetic
+** nonterminal never becomes the start symbol. */
+func ebnf_rule(es *ebnfsym, rhs ...*symbol) {
+	rp := &rule{
+		ruleline: es.lineno,
+		filename: es.filename,
+		lhs:      es.sp,
+		rhs:      rhs,
+		rhsalias: make([]string, len(rhs)),
+		noCode:   true,
+		nextlhs:  es.sp.rule,
+	}
+	es.sp.rule = rp
+	es.rules = append(es.rules, rp)
+}
+
+/* Return the synthetic nonterminal called name, creating it and its
+** rules if this is its first use. */
+func ebnf_symbol(psp *pstate, name string, kind string, elem *symbol, sep *symbol, group []*symbol, iValue int) *symbol {
+	if es, ok := psp.ebnfmap[name]; ok {
+		es.sp.useCnt++
+		return es.sp
+	}
+	es := &ebnfsym{
+		sp:       Symbol_new(name),
+		kind:     kind,
+		elem:     elem,
+		sep:      sep,
+		rhs:      group,
+		iValue:   iValue,
+		filename: psp.filename,
+		lineno:   psp.tokenlineno,
+	}
+	if psp.ebnfmap == nil {
+		psp.ebnfmap = make(map[string]*ebnfsym)
+	}
+	psp.ebnfmap[name] = es
+	psp.ebnf = append(psp.ebnf, es)
+
+	switch kind {
+	case "option":
+		ebnf_rule(es)
+		ebnf_rule(es, elem)
+	case "list":
+		ebnf_rule(es)
+		ebnf_rule(es, es.sp, elem)
+	case "nonempty_list":
+		ebnf_rule(es, elem)
+		ebnf_rule(es, es.sp, elem)
+	case "separated_nonempty_list":
+		ebnf_rule(es, elem)
+		ebnf_rule(es, es.sp, sep, elem)
+	case "group":
+		ebnf_rule(es, group...)
+	}
+	return es.sp
+}
+
+/* Apply a postfix operator ("?", "*" or "+") or, if sep is not nil, the
+** "%" operator to the last element of the right-hand side. */
+func ebnf_wrap(psp *pstate, op string, sep *symbol) {
+	n := len(psp.rhs) - 1
+	elem := psp.rhs[n]
+	text := psp.rhstext[n]
+	var name string
+	var kind string
+	switch op {
+	case "?":
+		kind = "option"
+		name = fmt.Sprintf("option(%s)", ebnf_symname(elem))
+		text += "?"
+	case "*":
+		kind = "list"
+		name = fmt.Sprintf("list(%s)", ebnf_symname(elem))
+		text += "*"
+	case "+":
+		kind = "nonempty_list"
+		name = fmt.Sprintf("nonempty_list(%s)", ebnf_symname(elem))
+		text += "+"
+	case "%":
+		kind = "separated_nonempty_list"
+		name = fmt.Sprintf("separated_nonempty_list(%s,%s)", sep.name, ebnf_symname(elem))
+		text += " % " + sep.name
+	}
+	/* An alias already written on the element, as in "expr(E)*", is kept
+	** and names the value of the whole construct. */
+	psp.rhs[n] = ebnf_symbol(psp, name, kind, elem, sep, nil, -1)
+	psp.rhstext[n] = text
+	psp.hasEbnf = true
+}
+
+/* Begin a parenthesized group on the right-hand side */
+func ebnf_open_group(psp *pstate) {
+	psp.groups = append(psp.groups, ebnfframe{
+		rhs:     psp.rhs,
+		alias:   psp.alias,
+		rhstext: psp.rhstext,
+		lineno:  psp.tokenlineno,
+	})
+	psp.rhs = nil
+	psp.alias = nil
+	psp.rhstext = nil
+	psp.nrhs = 0
+	psp.hasEbnf = true
+}
+
+/* Finish the innermost group and append it, as a single element, to the
+** enclosing right-hand side */
+func ebnf_close_group(psp *pstate) {
+	top := psp.groups[len(psp.groups)-1]
+	psp.groups = psp.groups[:len(psp.groups)-1]
+
+	group := psp.rhs
+	iValue := -1
+	parts := make([]string, len(group))
+	for i := range group {
+		parts[i] = ebnf_element(psp.rhstext[i], psp.alias[i])
+		if psp.alias[i] == "" {
+			continue
+		}
+		if iValue >= 0 {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Only one symbol in a group may have an alias.")
+			psp.errorcnt++
+		}
+		iValue = i
+	}
+	/* The name marks the element whose value is the group's, but not by
+	** its alias, so that groups that differ only in the spelling of the
+	** alias share one nonterminal */
+	names := make([]string, len(group))
+	for i, sp := range group {
+		names[i] = ebnf_symname(sp)
+		if i == iValue {
+			names[i] += "(*)"
+		}
+	}
+	sp := ebnf_symbol(psp, fmt.Sprintf("group(%s)", strings.Join(names, " ")), "group", nil, nil, group, iValue)
+
+	psp.rhs = append(top.rhs, sp)
+	psp.alias = append(top.alias, "")
+	psp.rhstext = append(top.rhstext, "( "+strings.Join(parts, " ")+" )")
+	psp.nrhs = len(psp.rhs)
+}
+
+/* Return the Go type of the value carried by sp, or "" if it carries none */
+func ebnf_valuetype(gp *lemon, sp *symbol) string {
+	if sp.typ == TERMINAL || sp.typ == MULTITERMINAL {
+		return gp.tokentype
+	}
+	if sp.datatype != "" {
+		return sp.datatype
+	}
+	return gp.vartype
+}
+
+/* Give a synthetic rule an action.  lhsalias and the aliases in rhsalias
+** are used by code. */
+func ebnf_action(rp *rule, lhsalias string, code string, rhsalias ...string) {
+	rp.lhsalias = lhsalias
+	copy(rp.rhsalias, rhsalias)
+	for i, sp := range rp.rhs {
+		if rp.rhsalias[i] != "" {
+			sp.bContent = true
+		}
+	}
+	rp.code = " " + code + " "
+	rp.line = rp.ruleline
+	rp.noCode = false
+}
+
+/* Called once the whole grammar has been read.  Now that every %type is
+** known, work out the datatype and actions of each synthetic nonterminal,
+** then append the synthetic rules to the rule list. */
+func ebnf_finish(psp *pstate) {
+	gp := psp.gp
+	for _, es := range psp.ebnf {
+		var elemtype string
+		if es.kind == "group" {
+			if es.iValue >= 0 {
+				elemtype = ebnf_valuetype(gp, es.rhs[es.iValue])
+			}
+		} else {
+			elemtype = ebnf_valuetype(gp, es.elem)
+		}
+		if elemtype != "" {
+			switch es.kind {
+			case "option":
+				es.sp.datatype = elemtype
+				ebnf_action(es.rules[0], "yyopt", fmt.Sprintf("var yyzero %s; yyopt = yyzero", elemtype))
+				ebnf_action(es.rules[1], "yyopt", "yyopt = yyelem", "yyelem")
+			case "list":
+				es.sp.datatype = "[]" + elemtype
+				ebnf_action(es.rules[0], "yylist", "yylist = nil")
+				ebnf_action(es.rules[1], "yylist", "yylist = append(yylist, yyelem)", "yylist", "yyelem")
+			case "nonempty_list":
+				es.sp.datatype = "[]" + elemtype
+				ebnf_action(es.rules[0], "yylist", fmt.Sprintf("yylist = []%s{yyelem}", elemtype), "yyelem")
+				ebnf_action(es.rules[1], "yylist", "yylist = append(yylist, yyelem)", "yylist", "yyelem")
+			case "separated_nonempty_list":
+				es.sp.datatype = "[]" + elemtype
+				ebnf_action(es.rules[0], "yylist", fmt.Sprintf("yylist = []%s{yyelem}", elemtype), "yyelem")
+				ebnf_action(es.rules[1], "yylist", "yylist = append(yylist, yyelem)", "yylist", "", "yyelem")
+			case "group":
+				es.sp.datatype = elemtype
+				aliases := make([]string, len(es.rhs))
+				aliases[es.iValue] = "yyelem"
+				ebnf_action(es.rules[0], "yygroup", "yygroup = yyelem", aliases...)
+			}
+		}
+		for _, rp := range es.rules {
+			rp.index = gp.nrule
+			gp.nrule++
+			if psp.firstrule == nil {
+				psp.firstrule = rp
+			} else {
+				psp.lastrule.next = rp
+			}
+			psp.lastrule = rp
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+** A fuzz test for the generated parser.
+**
+** With -fuzz, golemon writes NAME_fuzz_test.go beside NAME.go, holding
+** FuzzParse(f *testing.F) for Go's native fuzzing:
+**
+**     go test -fuzz=FuzzParse
+**
+** The fuzzer's bytes are read as a sequence of token codes, one byte
+** each (two if there are more than 256 tokens), taken modulo YYNTOKEN-1
+** so that every code is a token other than the end of input.  Each token
+** is passed to Parse() with the zero value of %token_type, then the end
+** of input, then ParseFinalize() is called.  The test fails if:
+**
+**   *  The driver panics, in an assert() or otherwise.  A panic in the
+**      grammar's own code (an action, %syntax_error and so on, as told
+**      by the //line directives) skips the input instead, since the
+**      grammar may rightly expect the token values to be meaningful.
+**
+**   *  The stack is not empty after ParseFinalize().
+**
+**   *  A value on the stack is destroyed twice, destroyed after being
+**      passed to an action, overwritten, or left undestroyed at the end
+**      or by a reduce whose action does not take it.  The parser's
+**      yyvaluehook, which it has only with -fuzz, reports each push,
+**      reduce and destructor call, and the test keeps track of which
+**      stack entries hold values.  A lookahead token that is discarded
+**      may be destroyed at most once.
+**
+** The seed corpus is the sentences that "golemon sentences" would print
+** for the grammar.
+ */
+
+/* How many sentences of the grammar to use as seeds */
+const FUZZ_SEEDS = 16
+
+/* Return the seed corpus: distinct sentences of the grammar, each
+** encoded as the fuzz test decodes its input */
+func fuzz_seeds(lemp *lemon, width int) []string {
+	g := &sentencegen{lemp: lemp, rnd: rand.New(rand.NewSource(1))}
+	if lemp.start != "" {
+		g.start = Symbol_find(lemp.start)
+	}
+	if g.start == nil {
+		g.start = lemp.startRule.lhs
+	}
+	g.find_heights()
+	if _, ok := g.height[g.start]; !ok {
+		return nil
+	}
+	var seeds []string
+	seen := make(map[string]bool)
+	for n := 0; n < FUZZ_SEEDS; n++ {
+		s, ok := g.sentence(6)
+		if !ok {
+			continue
+		}
+		var buf bytes.Buffer
+		for _, sp := range s {
+			code := sp.index - 1
+			buf.WriteByte(byte(code))
+			if width == 2 {
+				buf.WriteByte(byte(code >> 8))
+			}
+		}
+		if !seen[buf.String()] {
+			seen[buf.String()] = true
+			seeds = append(seeds, buf.String())
+		}
+	}
+	return seeds
+}
+
+/* Write the fuzz test for the generated parser, which will be called
+** goname and is for now in the file called path.  header holds the
+** lines describing how the parser was made. */
+func fuzz_output(lemp *lemon, path string, goname string, header []string) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read the package name of \"%s\": %v\n", goname, err)
+		lemp.errorcnt++
+		return
+	}
+	name := lemp.name
+	if name == "" {
+		name = "Parse"
+	}
+	width := 1
+	if lemp.nterminal-1 > 256 {
+		width = 2
+	}
+	parserFile := filepath.Base(goname)
+	if goname == "-" {
+		parserFile = filepath.Base(file_makename(lemp, ".go"))
+	}
+	ctxDecl, ctxArg := "", ""
+	if lemp.ctx != "" {
+		ctxDecl = "var " + lemp.ctx + "\n"
+		ctxArg = strings.Fields(lemp.ctx)[0]
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by golemon from %s. DO NOT EDIT.\n\n", lemp.filename)
+	fmt.Fprintf(&out, "// Fuzz test for the parser in %s.\n//\n%s\n\n", parserFile, strings.Join(header, "\n"))
+	fmt.Fprintf(&out, "package %s\n\n", f.Name.Name)
+	fmt.Fprintf(&out, "import (\n\t\"fmt\"\n\t\"path/filepath\"\n\t\"runtime\"\n\t\"strings\"\n\t\"testing\"\n)\n\n")
+	fmt.Fprintf(&out, "// The file holding the parser, to tell its panics from those in the\n// grammar's code.\n")
+	fmt.Fprintf(&out, "const yyFuzzParserFile = %q\n\n", parserFile)
+	fmt.Fprintf(&out, "// Bytes of fuzzer input per token.\nconst yyFuzzTokenBytes = %d\n\n", width)
+	fmt.Fprintf(&out, "// Sentences of the grammar, encoded as yyFuzzTokens() decodes them.\nvar yyFuzzSeeds = []string{\n")
+	for _, seed := range fuzz_seeds(lemp, width) {
+		fmt.Fprintf(&out, "\t%q,\n", seed)
+	}
+	fmt.Fprintf(&out, "}\n\n")
+	fmt.Fprintf(&out, "// For each rule, a character for each symbol on its right-hand side:\n")
+	fmt.Fprintf(&out, "// 'd' if the reduce destroys the value, '.' if the action takes it.\n")
+	fmt.Fprintf(&out, "var yyFuzzRuleValues = []string{\n")
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		var values []byte
+		for i, sp := range rp.rhs {
+			if (i >= len(rp.rhsalias) || rp.rhsalias[i] == "") && has_destructor(sp, lemp) {
+				values = append(values, 'd')
+			} else {
+				values = append(values, '.')
+			}
+		}
+		fmt.Fprintf(&out, "\t%q, // ", values)
+		rule_print(&out, rp)
+		fmt.Fprintf(&out, "\n")
+	}
+	fmt.Fprintf(&out, "}\n\n")
+	/* "Parse" is replaced where it begins a word, as tplt_xfer() does */
+	body := regexp.MustCompile(`(^|[^A-Za-z])Parse`).ReplaceAllString(fuzzTemplate, "${1}"+name)
+	out.WriteString(strings.NewReplacer("CTXDECL\n", ctxDecl, "CTXARG", ctxArg).Replace(body))
+
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't format the fuzz test: %v\n", err)
+		lemp.errorcnt++
+		return
+	}
+	fp := file_open(lemp, "_fuzz_test.go", "wb")
+	if fp == nil {
+		return
+	}
+	defer fp.Close()
+	if _, err := fp.Write(formatted); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write file \"%s\": %v\n", lemp.outname, err)
+		lemp.errorcnt++
+	}
+}
+
+/* The rest of the fuzz test.  "Parse" at the start of a word is
+** replaced by the %name of the parser, and CTXDECL and CTXARG declare
+** and name the %extra_context argument of ParseAlloc(). */
+const fuzzTemplate = `// Decode the fuzzer's input as a sequence of token codes.
+func yyFuzzTokens(data []byte) []YYCODETYPE {
+	var codes []YYCODETYPE
+	if YYNTOKEN < 2 {
+		return codes
+	}
+	for ; len(data) >= yyFuzzTokenBytes; data = data[yyFuzzTokenBytes:] {
+		n := int(data[0])
+		if yyFuzzTokenBytes == 2 {
+			n |= int(data[1]) << 8
+		}
+		codes = append(codes, YYCODETYPE(1+n%(YYNTOKEN-1)))
+	}
+	return codes
+}
+
+// yyFuzzValues follows the values on the parser's stack, by way of
+// the parser's yyvaluehook, and records the first misuse of one.
+type yyFuzzValues struct {
+	live      []bool // Whether each stack entry holds a value
+	discarded int    // Lookahead tokens destroyed in this call to Parse()
+	err       string
+}
+
+func (v *yyFuzzValues) fail(format string, args ...interface{}) {
+	if v.err == "" {
+		v.err = fmt.Sprintf(format, args...)
+	}
+}
+
+func (v *yyFuzzValues) hook(p *yyParser, event int, index int, value *YYMINORTYPE) {
+	for len(v.live) <= index || len(v.live) < len(p.yystack) {
+		v.live = append(v.live, false)
+	}
+	switch event {
+	case YYVALUE_PUSH:
+		if v.live[index] {
+			v.fail("the value at stack index %d was overwritten", index)
+		}
+		v.live[index] = true
+	case YYVALUE_RELEASE:
+		values := yyFuzzRuleValues[index]
+		for k := range values {
+			i := p.yytos - len(values) + 1 + k
+			if values[k] == 'd' && v.live[i] {
+				v.fail("the %s at stack index %d was not destroyed by the reduce by %s", yyTokenName[p.yystack[i].major], i, yyRuleName[index])
+			}
+			v.live[i] = false
+		}
+	case YYVALUE_DESTROY:
+		for i := range p.yystack {
+			if &p.yystack[i].minor == value {
+				if !v.live[i] {
+					v.fail("the %s at stack index %d was destroyed twice, or after being used", yyTokenName[p.yystack[i].major], i)
+				}
+				v.live[i] = false
+				return
+			}
+		}
+		if v.discarded++; v.discarded > 1 {
+			v.fail("a lookahead token was destroyed twice")
+		}
+	}
+}
+
+// Called after each call to Parse().  A value above the top of the stack
+// that was not destroyed was taken by the accept action.
+func (v *yyFuzzValues) settle(p *yyParser) {
+	for i := p.yytos + 1; i < len(v.live); i++ {
+		v.live[i] = false
+	}
+	v.discarded = 0
+}
+
+// Called after ParseFinalize().  Values without a destructor need not
+// have been destroyed.
+func (v *yyFuzzValues) finish(p *yyParser) {
+	for i := 1; i < len(v.live) && i < len(p.yystack); i++ {
+		if v.live[i] && int(p.yystack[i].major) >= YY_MIN_DSTRCTR {
+			v.fail("the %s at stack index %d was never destroyed", yyTokenName[p.yystack[i].major], i)
+		}
+	}
+}
+
+// Report whether the panic being recovered from was raised in the
+// parser rather than in the grammar's code.
+func yyFuzzPanicInParser() bool {
+	pcs := make([]uintptr, 100)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			return filepath.Base(frame.File) == yyFuzzParserFile
+		}
+		if !more {
+			return true
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range yyFuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		codes := yyFuzzTokens(data)
+		tokens := func() string {
+			names := make([]string, len(codes))
+			for i, code := range codes {
+				names[i] = yyTokenName[code]
+			}
+			return strings.Join(names, " ")
+		}
+		var values yyFuzzValues
+		defer func() {
+			if r := recover(); r != nil {
+				if !yyFuzzPanicInParser() {
+					t.Skipf("panic in the grammar's code: %v", r)
+				}
+				t.Fatalf("panic: %v\ntokens: %s", r, tokens())
+			}
+		}()
+
+		var token ParseTOKENTYPE
+		CTXDECL
+		p := ParseAlloc(CTXARG)
+		p.yyvaluehook = values.hook
+		for _, code := range codes {
+			p.Parse(code, token)
+			values.settle(p)
+		}
+		p.Parse(0, token)
+		values.settle(p)
+		p.ParseFinalize()
+		values.finish(p)
+
+		if p.yytos != 0 {
+			t.Fatalf("the stack holds %d entries after ParseFinalize()\ntokens: %s", p.yytos, tokens())
+		}
+		if values.err != "" {
+			t.Fatalf("%s\ntokens: %s", values.err, tokens())
+		}
+	})
+}
+`
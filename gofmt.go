@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+** Checking and formatting the generated parser.
+**
+** ReportTable() copies the user's %include, %code and rule actions into
+** the parser verbatim, so a mistake in one of them would otherwise only
+** show up when the generated file is compiled.  Once the file has been
+** written it is read back and parsed with go/parser.  Syntax errors are
+** reported against the grammar, by way of the //line directives, and
+** name the rule whose action contains the error.  If the file parses, it
+** is rewritten in gofmt style so that regenerating it does not churn
+** diffs.
+ */
+
+/* Return the rule whose action covers the given line of the given file,
+** or nil if there is none */
+func rule_at(lemp *lemon, filename string, lineno int) *rule {
+	var best *rule
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.noCode || rp.filename != filename || rp.line > lineno {
+			continue
+		}
+		/* The parser is checked before it is formatted, so the action
+		** takes up the same lines as in the grammar */
+		if rp.line+strings.Count(rp.code, "\n") < lineno {
+			continue
+		}
+		if best == nil || rp.line > best.line {
+			best = rp
+		}
+	}
+	return best
+}
+
+/* Report one syntax error in the generated parser */
+func output_error(lemp *lemon, e *scanner.Error) {
+	if rp := rule_at(lemp, e.Pos.Filename, e.Pos.Line); rp != nil {
+		var sb strings.Builder
+		rule_print(&sb, rp)
+		ErrorMsg(e.Pos.Filename, e.Pos.Line, "%s, in the action of rule \"%s.\"", e.Msg, sb.String())
+	} else {
+		ErrorMsg(e.Pos.Filename, e.Pos.Line, "%s", e.Msg)
+	}
+	lemp.errorcnt++
+}
+
+/* gofmt may move lines of the parser, so rewrite each "//line" directive
+** that refers back to the generated file itself with its new position. */
+func fix_linedirs(src []byte, filename string) []byte {
+	prefix := "//line " + filename + ":"
+	lines := strings.Split(string(src), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			lines[i] = fmt.Sprintf("%s%d", prefix, i+2)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+/* Parse the generated parser, which will be called filename and is for
+** now in the file called path.  Report any syntax errors; otherwise
+** rewrite the file in gofmt style. */
+func format_output(lemp *lemon, path string, filename string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read file \"%s\": %v\n", path, err)
+		lemp.errorcnt++
+		return
+	}
+	fset := token.NewFileSet()
+	_, err = parser.ParseFile(fset, filename, src, parser.ParseComments|parser.AllErrors)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok {
+			/* The list is sorted by the file names in the //line
+			** directives.  Report in the order of the generated file,
+			** where the first error is the one that matters. */
+			sort.SliceStable(list, func(i, j int) bool { return list[i].Pos.Offset < list[j].Pos.Offset })
+			for i, e := range list {
+				if i == 10 {
+					fmt.Fprintf(os.Stderr, "%s: too many errors\n", filename)
+					break
+				}
+				output_error(lemp, e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			lemp.errorcnt++
+		}
+		return
+	}
+	formatted, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't format \"%s\": %v\n", filename, err)
+		lemp.errorcnt++
+		return
+	}
+	if !lemp.nolinenosflag {
+		formatted = fix_linedirs(formatted, linedir_name(lemp, filename))
+	}
+	if err := os.WriteFile(path, formatted, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write file \"%s\": %v\n", filename, err)
+		lemp.errorcnt++
+	}
+}
@@ -3,15 +3,18 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -73,6 +76,7 @@ type symbol struct {
 	typ        symbol_type  /* Symbols are all either TERMINALS or NTs */
 	rule       *rule        /* Linked list of rules of this (if an NT) */ //? slice?
 	fallback   *symbol      /* fallback token in case this token doesn't parse */
+	sync       bool         /* True for a %sync token */
 	prec       int          /* Precedence if defined (-1 otherwise) */
 	assoc      e_assoc      /* Associativity if precedence is defined */
 	firstset   map[int]bool /* First-set for all rules of this symbol */
@@ -82,7 +86,12 @@ type symbol struct {
 	 ** popped from the stack during error processing */
 	destLineno int /* Line number for start of destructor.  Set to
 	 ** -1 for duplicate destructors. */
-	datatype string /* The data type of information held by this
+	destFilename string /* File in which the destructor appears */
+	copycode     string /* Code which gives a value its own copy, when
+	 ** the parser is cloned */
+	copyLineno   int    /* Line number for start of the %copy code */
+	copyFilename string /* File in which the %copy code appears */
+	datatype     string /* The data type of information held by this
 	 ** object. Only used if type==NONTERMINAL */
 	dtnum int /* The data type number.  In the parser, the value
 	 ** stack is a union.  The .yy%d element of this
@@ -100,13 +109,16 @@ type rule struct {
 	lhsalias    string    /* Alias for the LHS ("" if none) */
 	lhsStart    bool      /* True if left-hand side is the start symbol */
 	ruleline    int       /* Line number for the rule */
+	filename    string    /* File in which the rule appears */
 	rhs         []*symbol /* The RHS symbols */
 	rhsalias    []string  /* An alias for each RHS symbol (empty if none) */
 	line        int       /* Line number at which code begins */
 	code        string    /* The code executed when this rule is reduced */
 	codePrefix  string    /* Setup code before code[] above */
 	codeSuffix  string    /* Breakdown code after code[] above */
+	sugar       string    /* The rule as written, if it used EBNF operators */
 	precsym     *symbol   /* Precedence symbol for this rule */
+	label       string    /* Struct type given by a "<Label>" after the rule */
 	index       int       /* An index number for this rule */
 	iRule       int       /* Rule number as used in the generated tables */
 	noCode      bool      /* True if this rule has no associated C code */
@@ -205,53 +217,71 @@ type plink struct {
 ** static variables.  Fields in the following structure can be thought
 ** of as begin global variables in the program.) */
 type lemon struct {
-	sorted            []*state  /* Table of states sorted by state number */
-	rule              *rule     /* List of all rules */
-	startRule         *rule     /* First rule */
-	nstate            int       /* Number of states */
-	nxstate           int       /* nstate with tail degenerate states removed */
-	nrule             int       /* Number of rules */
-	nruleWithAction   int       /* Number of rules with actions */
-	nsymbol           int       /* Number of terminal and nonterminal symbols */
-	nterminal         int       /* Number of terminal symbols */
-	minShiftReduce    int       /* Minimum shift-reduce action value */
-	errAction         int       /* Error action value */
-	accAction         int       /* Accept action value */
-	noAction          int       /* No-op action value */
-	minReduce         int       /* Minimum reduce action */
-	maxAction         int       /* Maximum action value of any kind */
-	symbols           []*symbol /* Sorted array of pointers to symbols */
-	errorcnt          int       /* Number of errors */
-	errsym            *symbol   /* The error symbol */
-	wildcard          *symbol   /* Token that matches anything */
-	name              string    /* Name of the generated parser */
-	arg               string    /* Declaration of the 3rd argument to parser */
-	ctx               string    /* Declaration of 2nd argument to constructor */
-	tokentype         string    /* Type of terminal symbols in the parser stack */
-	vartype           string    /* The default type of non-terminal symbols */
-	start             string    /* Name of the start symbol for the grammar */
-	stacksize         string    /* Size of the parser stack */
-	include           string    /* Code to put at the start of the C file */
-	error             string    /* Code to execute when an error is seen */
-	overflow          string    /* Code to execute on a stack overflow */
-	failure           string    /* Code to execute on parser failure */
-	accept            string    /* Code to execute when the parser excepts */
-	extracode         string    /* Code appended to the generated file */
-	tokendest         string    /* Code to execute to destroy token data */
-	vardest           string    /* Code for the default non-terminal destructor */
-	filename          string    /* Name of the input file */
-	outname           string    /* Name of the current output file */
-	tokenprefix       string    /* A prefix added to token names in the .h file */
-	nconflict         int       /* Number of parsing conflicts */
-	nactiontab        int       /* Number of entries in the yyaction[] table */
-	nlookaheadtab     int       /* Number of entries in yylookahead[] */
-	tablesize         int       /* Total table size of all tables in bytes */
-	basisflag         bool      /* Print only basis configurations */
-	printPreprocessed bool      /* Show preprocessor output on stdout */
-	has_fallback      bool      /* True if any %fallback is seen in the grammar */
-	nolinenosflag     bool      /* True if #line statements should not be printed */
-	argc              int       /* Number of command-line arguments */
-	argv              []string  /* Command-line arguments */
+	sorted            []*state   /* Table of states sorted by state number */
+	rule              *rule      /* List of all rules */
+	startRule         *rule      /* First rule */
+	nstate            int        /* Number of states */
+	nxstate           int        /* nstate with tail degenerate states removed */
+	nrule             int        /* Number of rules */
+	nruleWithAction   int        /* Number of rules with actions */
+	nsymbol           int        /* Number of terminal and nonterminal symbols */
+	nterminal         int        /* Number of terminal symbols */
+	minShiftReduce    int        /* Minimum shift-reduce action value */
+	errAction         int        /* Error action value */
+	accAction         int        /* Accept action value */
+	noAction          int        /* No-op action value */
+	minReduce         int        /* Minimum reduce action */
+	maxAction         int        /* Maximum action value of any kind */
+	symbols           []*symbol  /* Sorted array of pointers to symbols */
+	errorcnt          int        /* Number of errors */
+	errsym            *symbol    /* The error symbol */
+	wildcard          *symbol    /* Token that matches anything */
+	patterns          []*lexrule /* %token_pattern and %skip_pattern, in order */
+	name              string     /* Name of the generated parser */
+	arg               string     /* Declaration of the 3rd argument to parser */
+	ctx               string     /* Declaration of 2nd argument to constructor */
+	tokentype         string     /* Type of terminal symbols in the parser stack */
+	vartype           string     /* The default type of non-terminal symbols */
+	start             string     /* Name of the start symbol for the grammar */
+	stacksize         string     /* Size of the parser stack */
+	include           string     /* Code to put at the start of the C file */
+	error             string     /* Code to execute when an error is seen */
+	overflow          string     /* Code to execute on a stack overflow */
+	failure           string     /* Code to execute on parser failure */
+	accept            string     /* Code to execute when the parser excepts */
+	extracode         string     /* Code appended to the generated file */
+	tokendest         string     /* Code to execute to destroy token data */
+	vardest           string     /* Code for the default non-terminal destructor */
+	tokencopy         string     /* Code to copy token data, for ParseClone() */
+	varcopy           string     /* Code for the default non-terminal copy */
+	filename          string     /* Name of the input file */
+	fromStdin         bool       /* Read the input from standard input */
+	source            []byte     /* Text of the grammar, if not to be read from filename */
+	files             []string   /* Every grammar file read, the input file first */
+	checkOnly         bool       /* Compare outputs with the files on disk; write nothing */
+	inputHash         hash.Hash  /* Hash of the grammar after preprocessing */
+	outname           string     /* Name of the current output file */
+	outfiles          []*outfile /* Output files written so far */
+	tokenprefix       string     /* A prefix added to token names in the .h file */
+	nconflict         int        /* Number of parsing conflicts */
+	nactiontab        int        /* Number of entries in the yyaction[] table */
+	nlookaheadtab     int        /* Number of entries in yylookahead[] */
+	tablesize         int        /* Total table size of all tables in bytes */
+	basisflag         bool       /* Print only basis configurations */
+	printPreprocessed bool       /* Show preprocessor output on stdout */
+	stringTables      bool       /* Emit parser tables as string constants */
+	typecheck         bool       /* Type-check rule actions with go/types */
+	fuzz              bool       /* Write a fuzz test for the parser */
+	astdecls          []*astdecl /* Types declared for labelled rules */
+	cst               bool       /* Build a syntax tree in rules without actions */
+	recover           bool       /* Write ParseRecover, for -recover, %sync or -incremental */
+	pull              bool       /* Write ParseAll, for -pull or what needs it */
+	incremental       bool       /* Write ParseIncremental, for reparsing after edits */
+	has_fallback      bool       /* True if any %fallback is seen in the grammar */
+	has_sync          bool       /* True if any %sync is seen in the grammar */
+	nolinenosflag     bool       /* True if #line statements should not be printed */
+	argc              int        /* Number of command-line arguments */
+	argv              []string   /* Command-line arguments */
 }
 
 /**************** From the file "table.h" *********************************/
@@ -698,7 +728,7 @@ func FindStates(lemp *lemon) {
 		sp = lemp.startRule.lhs
 	} else {
 		ErrorMsg(lemp.filename, 0, "Internal error - no start rule\n")
-		os.Exit(1)
+		lemon_exit(1)
 	}
 
 	/* Make sure the start symbol doesn't occur on the right-hand side of
@@ -961,7 +991,7 @@ func FindActions(lemp *lemon) {
 				}
 				fmt.Fprintf(os.Stderr, "internal error on source line %d: no start rule\n",
 					line)
-				os.Exit(1)
+				lemon_exit(1)
 			}
 			sp = lemp.startRule.lhs
 		}
@@ -1002,7 +1032,7 @@ func FindActions(lemp *lemon) {
 		if rp.canReduce {
 			continue
 		}
-		ErrorMsg(lemp.filename, rp.ruleline, "This rule can not be reduced.\n")
+		ErrorMsg(rp.filename, rp.ruleline, "This rule can not be reduced.\n")
 		lemp.errorcnt++
 	}
 }
@@ -1208,7 +1238,7 @@ func Configlist_closure(lemp *lemon) {
 		sp = rp.rhs[dot]
 		if sp.typ == NONTERMINAL {
 			if sp.rule == nil && sp != lemp.errsym {
-				ErrorMsg(lemp.filename, rp.line, "Nonterminal \"%s\" has no rules.",
+				ErrorMsg(rp.filename, rp.line, "Nonterminal \"%s\" has no rules.",
 					sp.name)
 				lemp.errorcnt++
 			}
@@ -1289,7 +1319,28 @@ func Configlist_eat(cfp *config) {
 /*
 ** Code for printing error message.
  */
+
+/* If not nil, error messages are passed to this function instead of being
+** printed.  The language server uses it to collect diagnostics. */
+var errorHook func(filename string, lineno int, msg string)
+
+/* If not nil, this is called instead of os.Exit() after a fatal error.
+** It must not return. */
+var exitHook func(status int)
+
+/* Give up after a fatal error in the grammar */
+func lemon_exit(status int) {
+	if exitHook != nil {
+		exitHook(status)
+	}
+	os.Exit(status)
+}
+
 func ErrorMsg(filename string, lineno int, format string, args ...interface{}) {
+	if errorHook != nil {
+		errorHook(filename, lineno, fmt.Sprintf(format, args...))
+		return
+	}
 	fmt.Fprintf(os.Stderr, "%s:%d: ", filename, lineno)
 	fmt.Fprintf(os.Stderr, format, args...)
 	fmt.Fprintf(os.Stderr, "\n")
@@ -1301,15 +1352,25 @@ func ErrorMsg(filename string, lineno int, format string, args ...interface{}) {
 ** Main program file for the LEMON parser generator.
  */
 
-var azDefine setFlag = make(map[string]bool)
+var azDefine setFlag = make(map[string]string)
 var azUndefine unsetFlag = unsetFlag{sf: azDefine}
 
 /* Rember the name of the output directory
  */
 var outputDir string
 
+/* Output file names given on the command line, by suffix.  "-" is the
+** standard output. */
+var outputPaths = make(map[string]string)
+
 var user_templatename string
 
+/* Names given values by %define, for %if expressions */
+var ppDefines defines
+
+/* Directories to search for %include_file and %import, from -I */
+var includePath pathFlag
+
 /* Merge together to lists of rules ordered by rule.iRule */
 func Rule_merge(pA *rule, pB *rule) *rule {
 	var pFirst *rule
@@ -1377,16 +1438,35 @@ func main() {
 	var noResort bool
 	var sqlFlag bool
 	var printPP bool
+	var tableMode string
+	var typecheck bool
+	var fuzz bool
+	var cst bool
+	var recover bool
+	var incremental bool
+	var pull bool
+	var goPath, reportPath, sqlPath, stdinName string
+	var checkOnly bool
+
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(fmt_command(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		os.Exit(lsp_command(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sentences" {
+		os.Exit(sentences_command(os.Args[2:]))
+	}
 
 	flag.BoolVar(&basisflag, "b", false, "Print only the basis in report.")
 	flag.BoolVar(&compress, "c", false, "Don't compress the action table.")
 	flag.StringVar(&outputDir, "d", "", "Output directory.  Default '.'")
-	flag.Var(&azDefine, "D", "Define an %ifdef macro.")
-	flag.Var(&azDefine, "U", "Undefine a macro.")
+	flag.Var(&azDefine, "D", "Define an %ifdef macro, as NAME or NAME=VALUE.")
+	flag.Var(&azUndefine, "U", "Undefine a macro.")
 	flag.BoolVar(&printPP, "E", false, "Print input file after preprocessing.")
 	_ = flag.String("f", "", "Ignored.  (Placeholder for -f compiler options.)")
 	flag.BoolVar(&rpflag, "g", false, "Print grammar without actions.")
-	_ = flag.String("I", "", "Ignored.  (Placeholder for -I compiler options.)")
+	flag.Var(&includePath, "I", "Search this directory for %include_file and %import.")
 	flag.BoolVar(&nolinenosflag, "l", false, "Do not print #line statements.")
 	_ = flag.String("O", "", "Ignored.  (Placeholder for -O compiler options.)")
 	flag.BoolVar(&showPrecedenceConflict, "p", false, "Show conflicts resolved by precedence rules")
@@ -1396,21 +1476,68 @@ func main() {
 	flag.BoolVar(&sqlFlag, "S", false, "Generate the *.sql file describing the parser tables.")
 	flag.BoolVar(&version, "x", false, "Print the version number.")
 	flag.StringVar(&user_templatename, "T", "", "Specify a template file.")
+	flag.StringVar(&goPath, "o", "", "Write the parser to this file, or to standard output if \"-\".")
+	flag.StringVar(&reportPath, "report", "", "Write the report to this file, or to standard output if \"-\".")
+	flag.StringVar(&sqlPath, "sql", "", "Write the SQL tables to this file, or to standard output if \"-\".  Implies -S.")
+	flag.StringVar(&stdinName, "filename", "", "Name of the grammar read from standard input, for diagnostics and output names.")
+	flag.BoolVar(&checkOnly, "check", false, "Write nothing; show a diff and fail if any output differs from the file on disk.")
+	flag.BoolVar(&typecheck, "typecheck", false, "Type-check rule actions against the %type declarations.")
+	flag.StringVar(&tableMode, "tables", "slice", "Encoding of the parser tables: \"slice\" or \"string\".")
+	flag.BoolVar(&fuzz, "fuzz", false, "Write a fuzz test for the parser to NAME_fuzz_test.go.")
+	flag.BoolVar(&cst, "cst", false, "Build a concrete syntax tree in rules that have no action.")
+	flag.BoolVar(&recover, "recover", false, "Generate ParseRecover, to recover from syntax errors by inserting, deleting or skipping tokens.")
+	flag.BoolVar(&incremental, "incremental", false, "Generate ParseIncremental, to parse a document again after each edit.")
+	flag.BoolVar(&pull, "pull", false, "Generate ParseAll, to parse the tokens read from a lexer.")
 	_ = flag.String("W", "", "Ignored.  (Placeholder for -W compiler options.)")
 
 	flag.Parse()
 
 	var lem lemon
-	var rp *rule
 
 	if version {
-		fmt.Printf("Lemon version 1.0\n")
+		fmt.Printf("Lemon version 1.0 (golemon %s)\n", golemon_version())
 		os.Exit(0)
 	}
 	if len(flag.Args()) != 1 {
 		fmt.Fprintf(os.Stderr, "Exactly one filename argument is required.\n")
 		os.Exit(1)
 	}
+	nstdout := 0
+	for _, path := range []string{goPath, reportPath, sqlPath} {
+		if path == "-" {
+			nstdout++
+		}
+	}
+	if nstdout > 1 {
+		fmt.Fprintf(os.Stderr, "Only one of -o, -report and -sql may write to standard output.\n")
+		os.Exit(1)
+	}
+	outputPaths[".go"] = goPath
+	outputPaths[".out"] = reportPath
+	outputPaths[".sql"] = sqlPath
+	if goPath != "" && goPath != "-" {
+		outputPaths["_fuzz_test.go"] = strings.TrimSuffix(goPath, ".go") + "_fuzz_test.go"
+	}
+	if sqlPath != "" {
+		sqlFlag = true
+	}
+	if flag.Args()[0] == "-" {
+		lem.fromStdin = true
+		if stdinName == "" && (goPath == "" || (reportPath == "" && !quiet) || (sqlFlag && sqlPath == "")) {
+			fmt.Fprintf(os.Stderr, "Reading the grammar from standard input needs -filename, or -o, -report (or -q) and, with -S, -sql.\n")
+			os.Exit(1)
+		}
+		if stdinName == "" && goPath == "-" && !nolinenosflag {
+			/* The //line directives would name neither the grammar nor
+			** the parser */
+			fmt.Fprintf(os.Stderr, "Writing the parser of a grammar from standard input to standard output needs -filename, or -l.\n")
+			os.Exit(1)
+		}
+	}
+	if tableMode != "slice" && tableMode != "string" {
+		fmt.Fprintf(os.Stderr, "Unknown -tables mode \"%s\".  Use \"slice\" or \"string\".\n", tableMode)
+		os.Exit(1)
+	}
 	lem.errorcnt = 0
 
 	/* Initialize the machine */
@@ -1420,9 +1547,23 @@ func main() {
 	lem.argv = os.Args
 	lem.argc = len(os.Args)
 	lem.filename = flag.Args()[0]
+	if lem.fromStdin {
+		lem.filename = "<stdin>"
+		if stdinName != "" {
+			lem.filename = stdinName
+		}
+	}
 	lem.basisflag = basisflag
 	lem.nolinenosflag = nolinenosflag
 	lem.printPreprocessed = printPP
+	lem.stringTables = tableMode == "string"
+	lem.typecheck = typecheck
+	lem.fuzz = fuzz
+	lem.cst = cst
+	lem.recover = recover || incremental
+	lem.incremental = incremental
+	lem.pull = pull
+	lem.checkOnly = checkOnly
 	Symbol_new("$")
 
 	/* Parse the input file */
@@ -1434,51 +1575,23 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Empty grammar.\n")
 		os.Exit(1)
 	}
-	lem.errsym = Symbol_find("error")
-
-	/* Count and index the symbols of the grammar */
-	Symbol_new("{default}")
-	lem.nsymbol = Symbol_count()
-	lem.symbols = Symbol_arrayof()
-	for i := 0; i < lem.nsymbol; i++ {
-		lem.symbols[i].index = i
+	if lem.cst && lem.vartype == "" {
+		lem.vartype = cst_nodetype(&lem)
 	}
-	sort.Sort(symbolSorter(lem.symbols[:lem.nsymbol]))
-	var i int
-	for i = 0; i < lem.nsymbol; i++ {
-		lem.symbols[i].index = i
+	if lem.has_sync {
+		lem.recover = true
 	}
-	for lem.symbols[i-1].typ == MULTITERMINAL {
-		i--
+	if lem.recover || lem.cst || len(lem.patterns) > 0 || len(lem.astdecls) > 0 {
+		lem.pull = true
 	}
-	assert(lem.symbols[i-1].name == "{default}", `lem.symbols[i-1].name == "{default}"`)
-	lem.nsymbol = i - 1
-
-	for i = 1; firstRuneIsUpper(lem.symbols[i].name); i++ {
-	}
-	lem.nterminal = i
-	/* Assign sequential rule numbers.  Start with 0.  Put rules that have no
-	 ** reduce action C-code associated with them last, so that the switch()
-	 ** statement that selects reduction actions will have a smaller jump table.
-	 */
-
-	for i, rp = 0, lem.rule; rp != nil; rp = rp.next {
-		if rp.code != "" {
-			rp.iRule = i
-			i++
-		} else {
-			rp.iRule = -1
-		}
+	ast_actions(&lem)
+	if lem.cst {
+		cst_actions(&lem)
 	}
-	lem.nruleWithAction = i
-	for rp := lem.rule; rp != nil; rp = rp.next {
-		if rp.iRule < 0 {
-			rp.iRule = i
-			i++
-		}
+	if lem.errorcnt > 0 {
+		os.Exit(lem.errorcnt)
 	}
-	lem.startRule = lem.rule
-	lem.rule = Rule_sort(lem.rule)
+	index_grammar(&lem)
 
 	/* Generate a reprint of the grammar, if requested on the command line */
 	if rpflag {
@@ -1545,6 +1658,13 @@ func main() {
 	if lem.nconflict > 0 {
 		fmt.Fprintf(os.Stderr, "%d parsing conflicts.\n", lem.nconflict)
 	}
+	if lem.checkOnly {
+		if file_check(&lem) > 0 {
+			os.Exit(1)
+		}
+	} else {
+		file_commit(&lem)
+	}
 
 	/* return 0 on success, 1 on failure. */
 	if lem.errorcnt > 0 || lem.nconflict > 0 {
@@ -1552,6 +1672,54 @@ func main() {
 	}
 }
 
+/* Count and index the symbols of the grammar, and number its rules */
+func index_grammar(lemp *lemon) {
+	lemp.errsym = Symbol_find("error")
+	Symbol_new("{default}")
+	lemp.nsymbol = Symbol_count()
+	lemp.symbols = Symbol_arrayof()
+	for i := 0; i < lemp.nsymbol; i++ {
+		lemp.symbols[i].index = i
+	}
+	sort.Sort(symbolSorter(lemp.symbols[:lemp.nsymbol]))
+	var i int
+	for i = 0; i < lemp.nsymbol; i++ {
+		lemp.symbols[i].index = i
+	}
+	for lemp.symbols[i-1].typ == MULTITERMINAL {
+		i--
+	}
+	assert(lemp.symbols[i-1].name == "{default}", `lemp.symbols[i-1].name == "{default}"`)
+	lemp.nsymbol = i - 1
+
+	for i = 1; firstRuneIsUpper(lemp.symbols[i].name); i++ {
+	}
+	lemp.nterminal = i
+	/* Assign sequential rule numbers.  Start with 0.  Put rules that have no
+	 ** reduce action C-code associated with them last, so that the switch()
+	 ** statement that selects reduction actions will have a smaller jump table.
+	 */
+
+	i = 0
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.code != "" {
+			rp.iRule = i
+			i++
+		} else {
+			rp.iRule = -1
+		}
+	}
+	lemp.nruleWithAction = i
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.iRule < 0 {
+			rp.iRule = i
+			i++
+		}
+	}
+	lemp.startRule = lemp.rule
+	lemp.rule = Rule_sort(lemp.rule)
+}
+
 /******************** From the file "msort.c" *******************************/
 /*
 ** A generic merge-sort program.
@@ -1834,42 +2002,74 @@ const (
 	LHS_ALIAS_3
 	RHS_ALIAS_1
 	RHS_ALIAS_2
+	RHS_SEPARATOR
+	MACRO_ARGS
+	WAITING_FOR_MACRO_NAME
+	WAITING_FOR_MACRO_LPAREN
+	WAITING_FOR_MACRO_PARAM
+	WAITING_FOR_MACRO_COMMA
+	WAITING_FOR_INCLUDE_FILE
 	PRECEDENCE_MARK_1
 	PRECEDENCE_MARK_2
+	RULE_LABEL_1
+	RULE_LABEL_2
 	RESYNC_AFTER_RULE_ERROR
 	RESYNC_AFTER_DECL_ERROR
 	WAITING_FOR_DESTRUCTOR_SYMBOL
+	WAITING_FOR_COPY_SYMBOL
 	WAITING_FOR_DATATYPE_SYMBOL
 	WAITING_FOR_FALLBACK_ID
 	WAITING_FOR_WILDCARD_ID
+	WAITING_FOR_SYNC_ID
 	WAITING_FOR_CLASS_ID
 	WAITING_FOR_CLASS_TOKEN
 	WAITING_FOR_TOKEN_NAME
+	WAITING_FOR_PATTERN_TOKEN
+	WAITING_FOR_PATTERN
 )
 
 type pstate struct {
-	filename        string    /* Name of the input file */
-	tokenlineno     int       /* Linenumber at which current token starts */
-	errorcnt        int       /* Number of errors so far */
-	tokenstart      int       /* T̵e̵x̵t̵ start position of current token */
-	gp              *lemon    /* Global state vector */
-	state           e_state   /* The state of the parser */
-	fallback        *symbol   /* The fallback token */
-	tkclass         *symbol   /* Token class symbol */
-	lhs             *symbol   /* Left-hand side of current rule */
-	lhsalias        string    /* Alias for the LHS */
-	nrhs            int       /* Number of right-hand side symbols seen */
-	rhs             []*symbol /* RHS symbols */
-	alias           []string  /* Aliases for each RHS symbol (or NULL) */
-	prevrule        *rule     /* Previous rule parsed */
-	declkeyword     string    /* Keyword of a declaration */
-	declargslot     *string   /* Where the declaration argument should be put */
-	insertLineMacro bool      /* Add #line before declaration insert */
-	decllinenoslot  *int      /* Where to write declaration line number */
-	declassoc       e_assoc   /* Assign this association to decl arguments */
-	preccounter     int       /* Assign this precedence to decl arguments */
-	firstrule       *rule     /* Pointer to first rule in the grammar */
-	lastrule        *rule     /* Pointer to the most recently parsed rule */
+	filename        string                /* Name of the input file */
+	tokenlineno     int                   /* Linenumber at which current token starts */
+	errorcnt        int                   /* Number of errors so far */
+	tokenstart      int                   /* T̵e̵x̵t̵ start position of current token */
+	gp              *lemon                /* Global state vector */
+	state           e_state               /* The state of the parser */
+	fallback        *symbol               /* The fallback token */
+	tkclass         *symbol               /* Token class symbol */
+	pattok          *symbol               /* Token of a %token_pattern */
+	lhs             *symbol               /* Left-hand side of current rule */
+	lhsalias        string                /* Alias for the LHS */
+	nrhs            int                   /* Number of right-hand side symbols seen */
+	rhs             []*symbol             /* RHS symbols */
+	alias           []string              /* Aliases for each RHS symbol (or NULL) */
+	prevrule        *rule                 /* Previous rule parsed */
+	declkeyword     string                /* Keyword of a declaration */
+	declargslot     *string               /* Where the declaration argument should be put */
+	insertLineMacro bool                  /* Add #line before declaration insert */
+	decllinenoslot  *int                  /* Where to write declaration line number */
+	declfileslot    *string               /* Where to write declaration file name */
+	declassoc       e_assoc               /* Assign this association to decl arguments */
+	preccounter     int                   /* Assign this precedence to decl arguments */
+	firstrule       *rule                 /* Pointer to first rule in the grammar */
+	lastrule        *rule                 /* Pointer to the most recently parsed rule */
+	rhstext         []string              /* Each RHS element as written in the input */
+	hasEbnf         bool                  /* True if the current rule uses EBNF operators */
+	groups          []ebnfframe           /* Enclosing RHS of each open group */
+	ebnf            []*ebnfsym            /* Synthetic nonterminals, in order of creation */
+	ebnfmap         map[string]*ebnfsym   /* Synthetic nonterminals by name */
+	macros          map[string]*macro     /* Parameterised nonterminals by name */
+	curmacro        *macro                /* Macro whose %macro declaration is being parsed */
+	recording       *macro                /* Macro whose rule is being recorded */
+	recordtoks      []macrotoken          /* Tokens of the rule being recorded */
+	recordphase     int                   /* Progress through the recorded rule */
+	calltoks        []string              /* Tokens of the macro use being parsed */
+	calldepth       int                   /* Parenthesis depth within calltoks */
+	instances       []*macroinst          /* Macro instances, in order of creation */
+	instmap         map[string]*macroinst /* Macro instances by name */
+	includes        []string              /* Files being read, outermost first */
+	imported        map[string]bool       /* Every file read so far */
+	defines         defines               /* Names given values by %define so far */
 }
 
 /* Parse a single token */
@@ -1888,6 +2088,10 @@ func parseonetoken(psp *pstate, runes []rune) {
 		fmt.Printf("%s:%d: Token=[%s] state=%d\n", psp.filename, psp.tokenlineno, x, psp.state)
 	} // #endif
 
+	if psp.recording != nil && macro_record(psp, x) {
+		return
+	}
+
 	switch psp.state {
 	case INITIALIZE:
 		psp.prevrule = nil
@@ -1900,11 +2104,16 @@ func parseonetoken(psp *pstate, runes []rune) {
 	case WAITING_FOR_DECL_OR_RULE:
 		if x0 == '%' {
 			psp.state = WAITING_FOR_DECL_KEYWORD
+		} else if mp := psp.macros[x]; mp != nil {
+			macro_record_start(psp, mp, x)
 		} else if islower(x0) {
 			psp.lhs = Symbol_new(x)
 			psp.nrhs = 0
 			psp.rhs = psp.rhs[:0]
 			psp.alias = psp.alias[:0]
+			psp.rhstext = psp.rhstext[:0]
+			psp.groups = psp.groups[:0]
+			psp.hasEbnf = false
 			psp.lhsalias = ""
 			psp.state = WAITING_FOR_ARROW
 		} else if x0 == '{' {
@@ -1925,6 +2134,8 @@ func parseonetoken(psp *pstate, runes []rune) {
 			}
 		} else if x0 == '[' {
 			psp.state = PRECEDENCE_MARK_1
+		} else if x0 == '<' {
+			psp.state = RULE_LABEL_1
 		} else {
 			ErrorMsg(psp.filename, psp.tokenlineno,
 				"Token \"%s\" should be either \"%%\" or a nonterminal name.",
@@ -1956,6 +2167,30 @@ func parseonetoken(psp *pstate, runes []rune) {
 		}
 		psp.state = WAITING_FOR_DECL_OR_RULE
 
+	case RULE_LABEL_1:
+		if !unicode.IsLetter(x0) {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"The label \"%s\" is not a Go type name.", x)
+			psp.errorcnt++
+		} else if psp.prevrule == nil {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"There is no prior rule to label \"<%s>\".", x)
+			psp.errorcnt++
+		} else if psp.prevrule.label != "" {
+			ErrorMsg(psp.filename, psp.tokenlineno, "Label on this line is not the first to follow the previous rule.")
+			psp.errorcnt++
+		} else {
+			psp.prevrule.label = x
+		}
+		psp.state = RULE_LABEL_2
+
+	case RULE_LABEL_2:
+		if x0 != '>' {
+			ErrorMsg(psp.filename, psp.tokenlineno, "Missing \">\" on rule label.")
+			psp.errorcnt++
+		}
+		psp.state = WAITING_FOR_DECL_OR_RULE
+
 	case WAITING_FOR_ARROW:
 		if x0 == ':' && x1 == ':' && x2 == '=' {
 			psp.state = IN_RHS
@@ -2003,9 +2238,16 @@ func parseonetoken(psp *pstate, runes []rune) {
 		}
 
 	case IN_RHS:
-		if x0 == '.' {
+		if x0 == '.' && len(psp.groups) > 0 {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Missing \")\" to close the group that begins on line %d.",
+				psp.groups[len(psp.groups)-1].lineno)
+			psp.errorcnt++
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else if x0 == '.' {
 			rp := &rule{
 				ruleline: psp.tokenlineno,
+				filename: psp.filename,
 				lhs:      psp.lhs,
 
 				lhsalias: psp.lhsalias,
@@ -2027,6 +2269,13 @@ func parseonetoken(psp *pstate, runes []rune) {
 				}
 			}
 			rp.lhs.rule = rp
+			if psp.hasEbnf {
+				parts := make([]string, psp.nrhs)
+				for i := range parts {
+					parts[i] = ebnf_element(psp.rhstext[i], psp.alias[i])
+				}
+				rp.sugar = fmt.Sprintf("%s ::= %s", ebnf_element(psp.lhs.name, psp.lhsalias), strings.Join(parts, " "))
+			}
 
 			if psp.firstrule == nil {
 				psp.firstrule = rp
@@ -2037,6 +2286,10 @@ func parseonetoken(psp *pstate, runes []rune) {
 			}
 			psp.prevrule = rp
 			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else if psp.macros[x] != nil {
+			psp.calltoks = []string{x}
+			psp.calldepth = 0
+			psp.state = MACRO_ARGS
 		} else if unicode.IsLetter(x0) {
 			if len(psp.rhs) >= MAXRHS {
 				ErrorMsg(psp.filename, psp.tokenlineno,
@@ -2047,6 +2300,7 @@ func parseonetoken(psp *pstate, runes []rune) {
 			} else {
 				psp.rhs = append(psp.rhs, Symbol_new(x))
 				psp.alias = append(psp.alias, "")
+				psp.rhstext = append(psp.rhstext, x)
 				psp.nrhs++
 				if len(psp.rhs) != psp.nrhs || len(psp.alias) != psp.nrhs {
 					msg := fmt.Sprintf("BANG! nrhs=%d, len(rhs)=%d, len(alias)=%d", psp.nrhs, len(psp.rhs), len(psp.alias))
@@ -2065,13 +2319,30 @@ func parseonetoken(psp *pstate, runes []rune) {
 				psp.rhs[psp.nrhs-1] = msp
 			}
 			msp.subsym = append(msp.subsym, Symbol_new(string(runes[1:])))
+			psp.rhstext[psp.nrhs-1] = ebnf_symname(msp)
 			if islower(x1) || msp.subsym[0].name != "" && islower([]rune(msp.subsym[0].name)[0]) {
 				ErrorMsg(psp.filename, psp.tokenlineno,
 					"Cannot form a compound containing a non-terminal")
 				psp.errorcnt++
 			}
-		} else if x0 == '(' && len(psp.rhs) > 0 {
+		} else if x0 == '(' && len(psp.rhs) > 0 && psp.alias[psp.nrhs-1] == "" {
+			/* An aliased symbol cannot take a second alias, so after one
+			** this "(" can only begin a group */
 			psp.state = RHS_ALIAS_1
+		} else if x0 == '(' {
+			ebnf_open_group(psp)
+		} else if x0 == ')' && len(psp.groups) > 0 {
+			if psp.nrhs == 0 {
+				ErrorMsg(psp.filename, psp.tokenlineno, "Empty group on RHS of rule.")
+				psp.errorcnt++
+				psp.state = RESYNC_AFTER_RULE_ERROR
+			} else {
+				ebnf_close_group(psp)
+			}
+		} else if (x0 == '?' || x0 == '*' || x0 == '+') && psp.nrhs > 0 {
+			ebnf_wrap(psp, x, nil)
+		} else if x0 == '%' && psp.nrhs > 0 {
+			psp.state = RHS_SEPARATOR
 		} else {
 			ErrorMsg(psp.filename, psp.tokenlineno,
 				"Illegal character on RHS of rule: \"%s\".", x)
@@ -2083,6 +2354,11 @@ func parseonetoken(psp *pstate, runes []rune) {
 		if unicode.IsLetter(x0) {
 			psp.alias[psp.nrhs-1] = x
 			psp.state = RHS_ALIAS_2
+		} else if x0 == '(' {
+			/* "X ((": the first "(" began a group, and so does this one */
+			ebnf_open_group(psp)
+			ebnf_open_group(psp)
+			psp.state = IN_RHS
 		} else {
 			ErrorMsg(psp.filename, psp.tokenlineno,
 				"\"%s\" is not a valid alias for the RHS symbol \"%s\"\n",
@@ -2095,8 +2371,56 @@ func parseonetoken(psp *pstate, runes []rune) {
 		if x0 == ')' {
 			psp.state = IN_RHS
 		} else {
+			/* What looked like an alias was the first symbol of a group.
+			** Start the group, then handle this token as part of it. */
+			first := psp.alias[psp.nrhs-1]
+			psp.alias[psp.nrhs-1] = ""
+			ebnf_open_group(psp)
+			psp.state = IN_RHS
+			parseonetoken(psp, []rune(first))
+			parseonetoken(psp, runes)
+		}
+
+	case MACRO_ARGS:
+		if len(psp.calltoks) == 1 && x0 != '(' {
 			ErrorMsg(psp.filename, psp.tokenlineno,
-				"Missing \")\" following LHS alias name \"%s\".", psp.lhsalias)
+				"Macro \"%s\" used without arguments.", psp.calltoks[0])
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_RULE_ERROR
+		} else if x0 == '.' {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Missing \")\" in arguments of macro \"%s\".", psp.calltoks[0])
+			psp.errorcnt++
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else {
+			psp.calltoks = append(psp.calltoks, x)
+			if x0 == '(' {
+				psp.calldepth++
+			} else if x0 == ')' {
+				psp.calldepth--
+			}
+			if psp.calldepth == 0 {
+				psp.state = IN_RHS
+				sp := macro_term(psp, psp.calltoks)
+				if sp == nil {
+					psp.state = RESYNC_AFTER_RULE_ERROR
+				} else {
+					psp.rhs = append(psp.rhs, sp)
+					psp.alias = append(psp.alias, "")
+					psp.rhstext = append(psp.rhstext, strings.ReplaceAll(strings.Join(psp.calltoks, ""), ",", ", "))
+					psp.nrhs++
+					psp.hasEbnf = true
+				}
+			}
+		}
+
+	case RHS_SEPARATOR:
+		if unicode.IsLetter(x0) {
+			ebnf_wrap(psp, "%", Symbol_new(x))
+			psp.state = IN_RHS
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Expected a separator symbol after \"%%\"; got \"%s\".", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
@@ -2106,6 +2430,7 @@ func parseonetoken(psp *pstate, runes []rune) {
 			psp.declkeyword = x
 			psp.declargslot = nil
 			psp.decllinenoslot = nil
+			psp.declfileslot = nil
 			psp.insertLineMacro = true
 			psp.state = WAITING_FOR_DECL_ARG
 			if x == "name" {
@@ -2119,6 +2444,10 @@ func parseonetoken(psp *pstate, runes []rune) {
 				psp.declargslot = &psp.gp.tokendest
 			} else if x == "default_destructor" {
 				psp.declargslot = &psp.gp.vardest
+			} else if x == "token_copy" {
+				psp.declargslot = &psp.gp.tokencopy
+			} else if x == "default_copy" {
+				psp.declargslot = &psp.gp.varcopy
 			} else if x == "token_prefix" {
 				psp.declargslot = &psp.gp.tokenprefix
 				psp.insertLineMacro = false
@@ -2162,6 +2491,8 @@ func parseonetoken(psp *pstate, runes []rune) {
 				psp.state = WAITING_FOR_PRECEDENCE_SYMBOL
 			} else if x == "destructor" {
 				psp.state = WAITING_FOR_DESTRUCTOR_SYMBOL
+			} else if x == "copy" {
+				psp.state = WAITING_FOR_COPY_SYMBOL
 			} else if x == "type" {
 				psp.state = WAITING_FOR_DATATYPE_SYMBOL
 			} else if x == "fallback" {
@@ -2171,8 +2502,19 @@ func parseonetoken(psp *pstate, runes []rune) {
 				psp.state = WAITING_FOR_TOKEN_NAME
 			} else if x == "wildcard" {
 				psp.state = WAITING_FOR_WILDCARD_ID
+			} else if x == "sync" {
+				psp.state = WAITING_FOR_SYNC_ID
 			} else if x == "token_class" {
 				psp.state = WAITING_FOR_CLASS_ID
+			} else if x == "token_pattern" {
+				psp.state = WAITING_FOR_PATTERN_TOKEN
+			} else if x == "skip_pattern" {
+				psp.pattok = nil
+				psp.state = WAITING_FOR_PATTERN
+			} else if x == "macro" {
+				psp.state = WAITING_FOR_MACRO_NAME
+			} else if x == "include_file" || x == "import" {
+				psp.state = WAITING_FOR_INCLUDE_FILE
 			} else {
 				ErrorMsg(psp.filename, psp.tokenlineno,
 					"Unknown declaration keyword: \"%%%s\".", x)
@@ -2192,10 +2534,38 @@ func parseonetoken(psp *pstate, runes []rune) {
 				"Symbol name missing after %%destructor keyword")
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else if mp := psp.macros[x]; mp != nil {
+			psp.declargslot = &mp.destructor
+			psp.decllinenoslot = &mp.destLineno
+			psp.declfileslot = &mp.destFilename
+			psp.insertLineMacro = true
+			psp.state = WAITING_FOR_DECL_ARG
 		} else {
 			sp := Symbol_new(x)
 			psp.declargslot = &sp.destructor
 			psp.decllinenoslot = &sp.destLineno
+			psp.declfileslot = &sp.destFilename
+			psp.insertLineMacro = true
+			psp.state = WAITING_FOR_DECL_ARG
+		}
+
+	case WAITING_FOR_COPY_SYMBOL:
+		if !unicode.IsLetter(x0) {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Symbol name missing after %%copy keyword")
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else if mp := psp.macros[x]; mp != nil {
+			psp.declargslot = &mp.copycode
+			psp.decllinenoslot = &mp.copyLineno
+			psp.declfileslot = &mp.copyFilename
+			psp.insertLineMacro = true
+			psp.state = WAITING_FOR_DECL_ARG
+		} else {
+			sp := Symbol_new(x)
+			psp.declargslot = &sp.copycode
+			psp.decllinenoslot = &sp.copyLineno
+			psp.declfileslot = &sp.copyFilename
 			psp.insertLineMacro = true
 			psp.state = WAITING_FOR_DECL_ARG
 		}
@@ -2206,6 +2576,17 @@ func parseonetoken(psp *pstate, runes []rune) {
 				"Symbol name missing after %%type keyword")
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else if mp := psp.macros[x]; mp != nil {
+			if mp.datatype != "" {
+				ErrorMsg(psp.filename, psp.tokenlineno,
+					"Symbol %%type \"%s\" already defined", x)
+				psp.errorcnt++
+				psp.state = RESYNC_AFTER_DECL_ERROR
+			} else {
+				psp.declargslot = &mp.datatype
+				psp.insertLineMacro = false
+				psp.state = WAITING_FOR_DECL_ARG
+			}
 		} else {
 			sp := Symbol_find(x)
 			if sp != nil && sp.datatype != "" {
@@ -2251,19 +2632,19 @@ func parseonetoken(psp *pstate, runes []rune) {
 
 			addLineMacro := !psp.gp.nolinenosflag && psp.insertLineMacro && psp.tokenlineno > 1 && (psp.decllinenoslot == nil || *psp.decllinenoslot != 0)
 			if addLineMacro {
-				zLine := fmt.Sprintf("//line %d ", psp.tokenlineno)
+				zLine := fmt.Sprintf("//line %s:%d\n", linedir_name(psp.gp, psp.filename), psp.tokenlineno)
 
 				if *psp.declargslot != "" && !strings.HasSuffix(*psp.declargslot, "\n") {
 					*psp.declargslot += "\n"
 				}
 				*psp.declargslot += zLine
-				*psp.declargslot += "\""
-				*psp.declargslot += strings.ReplaceAll(psp.filename, "\\", "\\\\")
-				*psp.declargslot += "\"\n"
 
 			}
 			if psp.decllinenoslot != nil && *psp.decllinenoslot == 0 {
 				*psp.decllinenoslot = psp.tokenlineno
+				if psp.declfileslot != nil {
+					*psp.declfileslot = psp.filename
+				}
 			}
 			*psp.declargslot += zNew
 			psp.state = WAITING_FOR_DECL_OR_RULE
@@ -2333,6 +2714,19 @@ func parseonetoken(psp *pstate, runes []rune) {
 			}
 		}
 
+	case WAITING_FOR_SYNC_ID:
+		if x0 == '.' {
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else if !unicode.IsUpper(x0) {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"%%sync argument \"%s\" should be a token", x)
+			psp.errorcnt++
+		} else {
+			sp := Symbol_new(x)
+			sp.sync = true
+			psp.gp.has_sync = true
+		}
+
 	case WAITING_FOR_CLASS_ID:
 		if !islower(x0) {
 			ErrorMsg(psp.filename, psp.tokenlineno,
@@ -2366,6 +2760,88 @@ func parseonetoken(psp *pstate, runes []rune) {
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		}
 
+	case WAITING_FOR_PATTERN_TOKEN:
+		if !unicode.IsUpper(x0) {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"%%token_pattern must be followed by a token: %s", x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else {
+			psp.pattok = Symbol_new(x)
+			psp.state = WAITING_FOR_PATTERN
+		}
+
+	case WAITING_FOR_PATTERN:
+		if x0 == '"' {
+			pattern_add(psp, psp.pattok, string(runes[1:]))
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"The argument to %%%s must be a string: %s", psp.declkeyword, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+
+	case WAITING_FOR_INCLUDE_FILE:
+		if x0 == '"' && len(runes) > 1 {
+			include_grammar(psp, string(runes[1:]), psp.declkeyword == "import")
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Illegal argument to %%%s: %s", psp.declkeyword, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+
+	case WAITING_FOR_MACRO_NAME:
+		if unicode.IsLetter(x0) {
+			macro_declare(psp, x)
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Macro name missing after %%macro keyword")
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+
+	case WAITING_FOR_MACRO_LPAREN:
+		if x0 == '(' {
+			psp.state = WAITING_FOR_MACRO_PARAM
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Missing \"(\" after %%macro %s", psp.curmacro.name)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+
+	case WAITING_FOR_MACRO_PARAM:
+		if !unicode.IsLetter(x0) {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Illegal parameter name for %%macro %s: %s", psp.curmacro.name, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else {
+			for _, f := range psp.curmacro.formals {
+				if f == x {
+					ErrorMsg(psp.filename, psp.tokenlineno,
+						"Parameter %s appears twice in %%macro %s", x, psp.curmacro.name)
+					psp.errorcnt++
+				}
+			}
+			psp.curmacro.formals = append(psp.curmacro.formals, x)
+			psp.state = WAITING_FOR_MACRO_COMMA
+		}
+
+	case WAITING_FOR_MACRO_COMMA:
+		if x0 == ',' {
+			psp.state = WAITING_FOR_MACRO_PARAM
+		} else if x0 == ')' {
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Expected \",\" or \")\" in %%macro %s; got \"%s\".", psp.curmacro.name, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+
 	case RESYNC_AFTER_RULE_ERROR:
 		/*   //    if( x0=='.' ) {psp.state = WAITING_FOR_DECL_OR_RULE;}
 		 **  //    break; */
@@ -2378,210 +2854,387 @@ func parseonetoken(psp *pstate, runes []rune) {
 	}
 }
 
-/* The text in the input is part of the argument to an %ifdef or %ifndef.
-** Evaluate the text as a boolean expression.  Return true or false.
- */
-func eval_preprocessor_boolean(z []rune, lineno int) int {
-	neg := false
-	res := 0
-	var i int
-	var zi rune
-	okTerm := true
+/* A token of a preprocessor expression */
+type pptoken struct {
+	text string /* Text of the token; strings keep their quotes */
+	pos  int    /* Offset of the token in the expression */
+}
 
-	for i := 0; i < len(z); i++ {
-		zi = z[i]
-		var zi1 rune
-		if i+1 < len(z) {
-			zi1 = z[i+1]
-		}
-		if unicode.IsSpace(zi) {
-			continue
-		}
-		if zi == '!' {
-			if !okTerm {
-				goto pp_syntax_error
-			}
-			neg = !neg
+/* A value in a preprocessor expression */
+type ppvalue struct {
+	text    string /* The value, as a string */
+	defined bool   /* The value is true */
+}
+
+/* State of the parser for one preprocessor expression */
+type ppexpr struct {
+	filename string
+	lineno   int
+	z        []rune
+	toks     []pptoken
+	i        int
+	skip     int /* Nonzero while parsing an operand that is not evaluated */
+}
+
+/* Look up a name given a value by -D or %define.  Values from the command
+** line take precedence. */
+func pp_lookup(name string) (string, bool) {
+	if v, ok := azDefine[name]; ok {
+		return v, true
+	}
+	v, ok := ppDefines.mappings[name]
+	return v, ok
+}
+
+/* Handle "%define NAME VALUE", and return the value.  The value of NAME
+** given with -D, if any, overrides the one in the grammar. */
+func pp_define(name string, value string) string {
+	if v, ok := azDefine[name]; ok {
+		value = v
+	}
+	ppDefines.addDefine(name, value)
+	return value
+}
+
+/* Report a syntax error in a preprocessor expression at offset pos and
+** exit */
+func (e *ppexpr) syntaxError(pos int) {
+	ErrorMsg(e.filename, e.lineno, "%%if syntax error.")
+	fmt.Fprintf(os.Stderr, "  %.*s <-- syntax error here\n", pos+1, string(e.z))
+	lemon_exit(1)
+}
+
+func (e *ppexpr) peek() string {
+	if e.i < len(e.toks) {
+		return e.toks[e.i].text
+	}
+	return ""
+}
+
+func (e *ppexpr) pos() int {
+	if e.i < len(e.toks) {
+		return e.toks[e.i].pos
+	}
+	return len(e.z) - 1
+}
+
+/* Break a preprocessor expression into tokens */
+func (e *ppexpr) tokenize() {
+	z := e.z
+	for i := 0; i < len(z); {
+		c := z[i]
+		start := i
+		switch {
+		case unicode.IsSpace(c):
+			i++
 			continue
-		}
-		if zi == '|' && zi1 == '|' {
-			if okTerm {
-				goto pp_syntax_error
+		case c == '"':
+			for i++; i < len(z) && z[i] != '"'; i++ {
 			}
-			if res != 0 {
-				return 1
+			if i == len(z) {
+				e.syntaxError(start)
 			}
 			i++
-			okTerm = true
-			continue
-		}
-		if zi == '&' && zi1 == '&' {
-			if okTerm {
-				goto pp_syntax_error
+		case unicode.IsLetter(c) || c == '_':
+			for ; i < len(z) && (isalnum(z[i]) || z[i] == '_'); i++ {
 			}
-
-			if res == 0 {
-				return 0
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(z) && unicode.IsDigit(z[i+1])):
+			for i++; i < len(z) && unicode.IsDigit(z[i]); i++ {
 			}
+		case i+1 < len(z) && strings.Contains("|| && == != <= >=", string(z[i:i+2])):
+			i += 2
+		case strings.ContainsRune("!()<>", c):
 			i++
-			okTerm = true
-			continue
+		default:
+			e.syntaxError(i)
 		}
-		if zi == '(' {
-			n := 1
-			if !okTerm {
-				goto pp_syntax_error
-			}
-
-			for k := i + 1; k < len(z); k++ {
-				if z[k] == ')' {
-					n--
-					if n == 0 {
-						res = eval_preprocessor_boolean(z[i+1:k], -1)
-						if res < 0 {
-							i = i - res
-							goto pp_syntax_error
-						}
-						i = k
-						break
-					}
-				} else if z[k] == '(' {
-					n++
-				} else if z[k] == 0 {
-					i = k
-					goto pp_syntax_error
-				}
-			}
-			if neg {
-				if res != 0 {
-					res = 0
-				} else {
-					res = 1
-				}
-				neg = false
-			}
-			okTerm = false
-			continue
+		e.toks = append(e.toks, pptoken{string(z[start:i]), start})
+	}
+}
+
+/* expr ::= and ( "||" and )* */
+func (e *ppexpr) or() bool {
+	res := e.and()
+	for e.peek() == "||" {
+		e.i++
+		if res {
+			e.skip++
+			e.and()
+			e.skip--
+		} else {
+			res = e.and()
 		}
-		if unicode.IsLetter(zi) {
-			if !okTerm {
-				goto pp_syntax_error
-			}
+	}
+	return res
+}
 
-			var k int
-			for k = i + 1; k < len(z) && (isalnum(z[k]) || z[k] == '_'); k++ {
-			}
-			n := k - i
-			res = 0
-			if azDefine[string(z[i:i+n])] {
-				res = 1
-			}
-			i = k - 1
-			if neg {
-				if res != 0 {
-					res = 0
-				} else {
-					res = 1
-				}
-				neg = false
-			}
-			okTerm = false
-			continue
+/* and ::= not ( "&&" not )* */
+func (e *ppexpr) and() bool {
+	res := e.not()
+	for e.peek() == "&&" {
+		e.i++
+		if !res {
+			e.skip++
+			e.not()
+			e.skip--
+		} else {
+			res = e.not()
 		}
-		goto pp_syntax_error
 	}
 	return res
+}
 
-pp_syntax_error:
-	if lineno > 0 {
-		fmt.Fprintf(os.Stderr, "%%if syntax error on line %d.\n", lineno)
-		fmt.Fprintf(os.Stderr, "  %.*s <-- syntax error here\n", i+1, string(z))
-		os.Exit(1)
+/* not ::= "!" not | cmp */
+func (e *ppexpr) not() bool {
+	if e.peek() == "!" {
+		e.i++
+		return !e.not()
+	}
+	return e.cmp()
+}
+
+/* cmp ::= value ( OP value )?   where OP is one of == != < <= > >= */
+func (e *ppexpr) cmp() bool {
+	left := e.value()
+	op := e.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left.defined
+	}
+	pos := e.pos() + len(op)
+	e.i++
+	right := e.value()
+	if e.skip > 0 {
+		return false
+	}
+	l, lerr := strconv.Atoi(left.text)
+	r, rerr := strconv.Atoi(right.text)
+	if lerr == nil && rerr == nil {
+		switch op {
+		case "==":
+			return l == r
+		case "!=":
+			return l != r
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		default:
+			return l >= r
+		}
+	}
+	switch op {
+	case "==":
+		return left.text == right.text
+	case "!=":
+		return left.text != right.text
+	}
+	ErrorMsg(e.filename, e.lineno,
+		"Operands of \"%s\" must be integers, not \"%s\" and \"%s\".", op, left.text, right.text)
+	fmt.Fprintf(os.Stderr, "  %.*s <-- here\n", pos, string(e.z))
+	lemon_exit(1)
+	return false
+}
+
+/* value ::= NAME | INTEGER | "STRING" | "(" expr ")" */
+func (e *ppexpr) value() ppvalue {
+	tok := e.peek()
+	pos := e.pos()
+	e.i++
+	switch {
+	case tok == "(":
+		v := e.or()
+		if e.peek() != ")" {
+			e.syntaxError(e.pos())
+		}
+		e.i++
+		if v {
+			return ppvalue{"1", true}
+		}
+		return ppvalue{"0", false}
+	case tok == "":
+		e.syntaxError(pos)
+	case tok[0] == '"':
+		return ppvalue{tok[1 : len(tok)-1], true}
+	case unicode.IsLetter(rune(tok[0])) || tok[0] == '_':
+		v, ok := pp_lookup(tok)
+		return ppvalue{v, ok}
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '-':
+		return ppvalue{tok, tok != "0"}
+	default:
+		e.syntaxError(pos)
 	}
-	return -(i + 1)
+	return ppvalue{}
 }
 
-/* Run the preprocessor over the input file text.  The global variables
-** azDefine[0] through azDefine[nDefine-1] contains the names of all defined
-** macros.  This routine looks for "%ifdef" and "%ifndef" and "%endif" and
-** comments them out.  Text in between is also commented out as appropriate.
+/* The text in the input is part of the argument to an %if, %elif, %ifdef
+** or %ifndef.  Evaluate the text as a boolean expression.  Return 1 for
+** true or 0 for false.  On a syntax error, report it and exit.
+**
+** Operators, loosest binding first, are ||, &&, ! and the comparisons
+** == != < <= > >=.  A name on its own is true if it is defined.  In a
+** comparison it stands for its value, which is "1" for a name given with
+** -D but no value.  Two integers are compared as integers; anything else
+** may only be compared with == or !=, as strings.
  */
-func preprocess_input(z []rune) {
-	var j int
-	exclude := 0
-	start := 0
-	lineno := 1
-	start_lineno := 1
-	for i := range z {
-		if z[i] == '\n' {
-			lineno++
-		}
-		if z[i] != '%' || (i > 0 && z[i-1] != '\n') {
-			continue
-		}
-		if len(z) >= i+6 && string(z[i:i+6]) == "%endif" && (len(z) == i+6 || unicode.IsSpace(z[i+6])) {
-			if exclude != 0 {
-				exclude--
-				if exclude == 0 {
-					for j = start; j < i; j++ {
-						if z[j] != '\n' {
-							z[j] = ' '
-						}
-					}
-				}
+func eval_preprocessor_boolean(filename string, z []rune, lineno int) int {
+	e := &ppexpr{filename: filename, lineno: lineno, z: z}
+	e.tokenize()
+	res := e.or()
+	if e.i < len(e.toks) {
+		e.syntaxError(e.pos())
+	}
+	if res {
+		return 1
+	}
+	return 0
+}
+
+/* A %define kept by preprocess_input(), to be substituted into the code
+** blocks that follow it */
+type ppdefine struct {
+	lineno int    /* Line of the %define */
+	name   string /* The name defined */
+	value  string /* Its value, after any -D */
+}
+
+/* One level of %if nesting in preprocess_input() */
+type ppcond struct {
+	lineno int  /* Line of the %if */
+	outer  bool /* Text around the conditional is kept */
+	active bool /* Text in the current branch is kept */
+	done   bool /* Some branch has been taken */
+	inElse bool /* The %else has been seen */
+}
+
+/* If line is a preprocessor directive, return its keyword and argument */
+func pp_directive(line string) (string, string) {
+	if !strings.HasPrefix(line, "%") {
+		return "", ""
+	}
+	n := 1
+	for n < len(line) && unicode.IsLetter(rune(line[n])) {
+		n++
+	}
+	if n < len(line) && !unicode.IsSpace(rune(line[n])) {
+		return "", ""
+	}
+	switch word := line[1:n]; word {
+	case "if", "ifdef", "ifndef", "elif", "else", "endif", "define":
+		return word, strings.TrimSpace(line[n:])
+	}
+	return "", ""
+}
+
+/* Comment out a directive line, noting what it did */
+func pp_comment(line string, note string) string {
+	text := "// " + strings.TrimRight(line, "\r\n")
+	if note != "" {
+		text += "  [" + note + "]"
+	}
+	if strings.HasSuffix(line, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+/* Run the preprocessor over the input file text and return the result,
+** with the %define directives in the branches taken.
+** Directives must begin at the start of a line:
+**
+**     %ifdef EXPR, %ifndef EXPR, %if EXPR, %elif EXPR, %else, %endif
+**     %define NAME VALUE
+**
+** Text in branches not taken is removed.  Directive lines are turned into
+** comments that record whether each branch was taken, so that -E shows
+** the path taken through each conditional.  Line numbers are unchanged.
+**
+** A name given a value by %define is replaced by that value, as a whole
+** word, in the code blocks that follow the %define; see scan_input().
+ */
+func preprocess_input(filename string, z []rune) ([]rune, []ppdefine) {
+	lines := strings.SplitAfter(string(z), "\n")
+	var stack []ppcond
+	var defs []ppdefine
+	keep := func() bool {
+		return len(stack) == 0 || stack[len(stack)-1].active
+	}
+	taken := func(c *ppcond, cond func() bool) string {
+		switch {
+		case !c.outer:
+			return "skipped"
+		case c.done:
+			c.active = false
+			return "not taken"
+		case cond():
+			c.active, c.done = true, true
+			return "taken"
+		}
+		c.active = false
+		return "not taken"
+	}
+	for n, line := range lines {
+		lineno := n + 1
+		word, arg := pp_directive(line)
+		test := func() bool { return eval_preprocessor_boolean(filename, []rune(arg), lineno) != 0 }
+		note := ""
+		switch word {
+		case "if", "ifdef", "ifndef":
+			c := ppcond{lineno: lineno, outer: keep()}
+			if word == "ifndef" {
+				note = taken(&c, func() bool { return !test() })
+			} else {
+				note = taken(&c, test)
+			}
+			stack = append(stack, c)
+		case "elif", "else":
+			if len(stack) == 0 || stack[len(stack)-1].inElse {
+				ErrorMsg(filename, lineno, "%%%s without a matching %%if.", word)
+				lemon_exit(1)
+			}
+			c := &stack[len(stack)-1]
+			if word == "else" {
+				c.inElse = true
+				note = taken(c, func() bool { return true })
+			} else {
+				note = taken(c, test)
 			}
-			for j = i; j < len(z) && z[j] != '\n'; j++ {
-				z[j] = ' '
+		case "endif":
+			if len(stack) == 0 {
+				ErrorMsg(filename, lineno, "%%endif without a matching %%if.")
+				lemon_exit(1)
 			}
-		} else if len(z) >= i+6 && string(z[i:i+5]) == "%else" && unicode.IsSpace(z[i+5]) {
-			if exclude == 1 {
-				exclude = 0
-				for j = start; j < i; j++ {
-					if z[j] != '\n' {
-						z[j] = ' '
-					}
-				}
-			} else if exclude == 0 {
-				exclude = 1
-				start = i
-				start_lineno = lineno
+			stack = stack[:len(stack)-1]
+		case "define":
+			if !keep() {
+				break
 			}
-			for j = i; j < len(z) && z[j] != '\n'; j++ {
-				z[j] = ' '
+			name := arg
+			value := ""
+			if i := strings.IndexFunc(arg, unicode.IsSpace); i >= 0 {
+				name, value = arg[:i], strings.TrimSpace(arg[i:])
 			}
-		} else if (len(z) >= i+7 && string(z[i:i+7]) == "%ifdef ") || (len(z) >= i+4 && string(z[i:i+4]) == "%if ") || (len(z) >= i+8 && string(z[i:i+8]) == "%ifndef ") {
-			if exclude != 0 {
-				exclude++
-			} else {
-				for j = i; j < len(z) && !unicode.IsSpace(z[j]); j++ {
-				}
-				iBool := j
-				isNot := (j == i+7)
-				for j < len(z) && z[j] != '\n' {
-					j++
-				}
-				exclude = eval_preprocessor_boolean(z[iBool:j], lineno)
-				if !isNot {
-					if exclude == 0 {
-						exclude = 1
-					} else {
-						exclude = 0
-					}
-				}
-				if exclude != 0 {
-					start = i
-					start_lineno = lineno
-				}
+			if name == "" || !(unicode.IsLetter(rune(name[0])) || name[0] == '_') {
+				ErrorMsg(filename, lineno, "Illegal name for %%define: \"%s\".", name)
+				lemon_exit(1)
 			}
-			for j := i; j <= len(z) && z[j] != '\n'; j++ {
-				z[j] = ' '
+			defs = append(defs, ppdefine{lineno, name, pp_define(name, value)})
+		default:
+			if !keep() {
+				lines[n] = line[len(strings.TrimRight(line, "\n")):]
 			}
+			continue
 		}
+		lines[n] = pp_comment(line, note)
 	}
-	if exclude != 0 {
-		fmt.Fprintf(os.Stderr, "unterminated %%ifdef starting on line %d\n", start_lineno)
-		os.Exit(1)
+	if len(stack) != 0 {
+		ErrorMsg(filename, stack[len(stack)-1].lineno, "unterminated %%if starting on this line")
+		lemon_exit(1)
 	}
+	return []rune(strings.Join(lines, "")), defs
 }
 
 /* In spite of its name, this function is really a scanner.  It read
@@ -2591,7 +3244,6 @@ func preprocess_input(z []rune) {
  */
 func Parse(gp *lemon) {
 	var ps pstate
-	var startline int
 
 	ps.gp = gp
 	ps.filename = gp.filename
@@ -2599,7 +3251,15 @@ func Parse(gp *lemon) {
 	ps.state = INITIALIZE
 
 	/* Begin by reading the input file */
-	bytes, err := os.ReadFile(ps.filename)
+	var bytes []byte
+	var err error
+	if gp.source != nil {
+		bytes = gp.source
+	} else if gp.fromStdin {
+		bytes, err = io.ReadAll(os.Stdin)
+	} else {
+		bytes, err = os.ReadFile(ps.filename)
+	}
 	if err != nil {
 		ErrorMsg(ps.filename, 0, fmt.Sprintf("Can't read file: %v", err))
 		gp.errorcnt++
@@ -2609,154 +3269,184 @@ func Parse(gp *lemon) {
 	filebuf := []rune(string(bytes))
 
 	/* Make an initial pass through the file to handle %ifdef and %ifndef */
-	preprocess_input(filebuf)
+	filebuf, defs := preprocess_input(ps.filename, filebuf)
+	gp.inputHash = sha256.New()
+	io.WriteString(gp.inputHash, string(filebuf))
 	if gp.printPreprocessed {
 		fmt.Printf("%s\n", string(filebuf))
 		return
 	}
 
-	/* Now scan the text of the input file */
-	lineno := 1
-	nextcp := 0
-	for cp := 0; cp < len(filebuf); {
-		c := filebuf[cp]
+	include_push(&ps, ps.filename)
+	scan_input(&ps, filebuf, defs)
+	include_pop(&ps)
+	macro_finish(&ps)
+	ebnf_finish(&ps)
+	gp.rule = ps.firstrule
+	gp.errorcnt = ps.errorcnt
+}
 
-		/* Keep track of the line number */
-		if c == '\n' {
-			lineno++
-		}
+/* Kinds of token found by next_token() */
+const (
+	TK_SPACE   = iota /* White space */
+	TK_COMMENT        /* A C or C++ style comment */
+	TK_STRING         /* A string literal */
+	TK_CODE           /* A block of code in braces */
+	TK_ID             /* An identifier */
+	TK_ARROW          /* The operator "::=" */
+	TK_MULTI          /* "|X" or "/X", a further terminal of a multi-terminal */
+	TK_OP             /* Any other one-character operator */
+)
 
-		/* Skip all white space */
-		if unicode.IsSpace(c) {
-			cp++
-			continue
-		}
+/* Find the token that begins at filebuf[cp].  Return its kind, the end of
+** its text and the start of whatever follows it.  The text of a string
+** or a code block does not include the closing quote or brace, so end is
+** len(filebuf) only if it was not terminated. */
+func next_token(filebuf []rune, cp int) (kind int, end int, next int) {
+	c := filebuf[cp]
 
-		var cp1 rune
-		if cp < len(filebuf)-1 {
-			cp1 = filebuf[cp+1]
+	/* White space */
+	if unicode.IsSpace(c) {
+		for cp++; cp < len(filebuf) && unicode.IsSpace(filebuf[cp]); cp++ {
 		}
+		return TK_SPACE, cp, cp
+	}
 
-		/* Skip C++ style comments */
-		if c == '/' && cp1 == '/' {
-			cp += 2
-			for ; cp < len(filebuf) && filebuf[cp] != '\n'; cp++ {
-			}
-			continue
+	var cp1 rune
+	if cp < len(filebuf)-1 {
+		cp1 = filebuf[cp+1]
+	}
+
+	/* C++ style comments */
+	if c == '/' && cp1 == '/' {
+		cp += 2
+		for ; cp < len(filebuf) && filebuf[cp] != '\n'; cp++ {
 		}
+		return TK_COMMENT, cp, cp
+	}
 
-		if c == '/' && cp1 == '*' { /* Skip C style comments */
-			cp += 2
-			for ; cp < len(filebuf) && (filebuf[cp] != '/' || filebuf[cp-1] != '*'); cp++ {
-				if filebuf[cp] == '\n' {
-					lineno++
-				}
-			}
-			if cp < len(filebuf) {
-				cp++
-			}
-			continue
+	if c == '/' && cp1 == '*' { /* C style comments */
+		cp += 2
+		for ; cp < len(filebuf) && (filebuf[cp] != '/' || filebuf[cp-1] != '*'); cp++ {
+		}
+		if cp < len(filebuf) {
+			cp++
 		}
+		return TK_COMMENT, cp, cp
+	}
 
-		ps.tokenstart = cp      /* Mark the beginning of the token */
-		ps.tokenlineno = lineno /* Linenumber on which token begins */
+	var cp2 rune
+	if cp < len(filebuf)-2 {
+		cp2 = filebuf[cp+2]
+	}
 
-		var cp2 rune
-		if cp < len(filebuf)-2 {
-			cp2 = filebuf[cp+2]
+	if c == '"' { /* String literals */
+		cp++
+		for ; cp < len(filebuf) && filebuf[cp] != '"'; cp++ {
+		}
+		if cp == len(filebuf) {
+			return TK_STRING, cp, cp
 		}
+		return TK_STRING, cp, cp + 1
+	} else if c == '{' { /* A block of C code */
+		cp++
+		for level := 1; cp < len(filebuf) && (level > 1 || filebuf[cp] != '}'); cp++ {
+			c = filebuf[cp]
+			cp1 = 0
+			if cp < len(filebuf)-1 {
+				cp1 = filebuf[cp+1]
+			}
 
-		if c == '"' { /* String literals */
-			cp++
-			for ; cp < len(filebuf) && filebuf[cp] != '"'; cp++ {
-				if filebuf[cp] == '\n' {
-					lineno++
+			if c == '{' {
+				level++
+			} else if c == '}' {
+				level--
+			} else if c == '/' && cp1 == '*' {
+				/* Skip comments */
+				cp = cp + 2
+				prevc := rune(0)
+				for ; cp < len(filebuf) && (filebuf[cp] != '/' || prevc != '*'); cp++ {
+					prevc = filebuf[cp]
 				}
-			}
-			if cp == len(filebuf) {
-				ErrorMsg(ps.filename, startline, "String starting on this line is not terminated before the end of the file.")
-				ps.errorcnt++
-				nextcp = cp
-			} else {
-				nextcp = cp + 1
-			}
-		} else if c == '{' { /* A block of C code */
-			cp++
-			for level := 1; cp < len(filebuf) && (level > 1 || filebuf[cp] != '}'); cp++ {
-				c = filebuf[cp]
-				cp1 = 0
-				if cp < len(filebuf)-1 {
-					cp1 = filebuf[cp+1]
+			} else if c == '/' && cp1 == '/' {
+				/* Skip C++ style comments too */
+				cp = cp + 2
+				for ; cp < len(filebuf) && filebuf[cp] != '\n'; cp++ {
 				}
-
-				if c == '\n' {
-					lineno++
-				} else if c == '{' {
-					level++
-				} else if c == '}' {
-					level--
-				} else if c == '/' && cp1 == '*' {
-					/* Skip comments */
-					cp = cp + 2
-					prevc := rune(0)
-					for ; cp < len(filebuf) && (filebuf[cp] != '/' || prevc != '*'); cp++ {
-						if filebuf[cp] == '\n' {
-							lineno++
-						}
+			} else if c == '\'' || c == '"' || c == '`' {
+				/* String a character literals */
+				startchar := c
+				prevc := rune(0)
+				for cp++; cp < len(filebuf) && (filebuf[cp] != startchar || prevc == '\\'); cp++ {
+					if prevc == '\\' {
+						prevc = 0
+					} else {
 						prevc = filebuf[cp]
 					}
-				} else if c == '/' && cp1 == '/' {
-					/* Skip C++ style comments too */
-					cp = cp + 2
-					for ; cp <= len(filebuf) && filebuf[cp] != '\n'; cp++ {
-					}
-					if cp <= len(filebuf) {
-						lineno++
-					}
-				} else if c == '\'' || c == '"' || c == '`' {
-					/* String a character literals */
-					startchar := c
-					prevc := rune(0)
-					for cp++; cp < len(filebuf) && (filebuf[cp] != startchar || prevc == '\\'); cp++ {
-						if filebuf[cp] == '\n' {
-							lineno++
-						}
-						if prevc == '\\' {
-							prevc = 0
-						} else {
-							prevc = filebuf[cp]
-						}
-					}
 				}
 			}
-			if cp >= len(filebuf) {
-				ErrorMsg(ps.filename, ps.tokenlineno, "C code starting on this line is not terminated before the end of the file.")
+		}
+		if cp >= len(filebuf) {
+			return TK_CODE, len(filebuf), len(filebuf)
+		}
+		return TK_CODE, cp, cp + 1
+	} else if isalnum(c) { /* Identifiers */
+		for ; cp < len(filebuf) && (isalnum(filebuf[cp]) || filebuf[cp] == '_'); cp++ {
+		}
+		return TK_ID, cp, cp
+	} else if c == ':' && cp1 == ':' && cp2 == '=' { /* The operator "::=" */
+		return TK_ARROW, cp + 3, cp + 3
+	} else if (c == '/' || c == '|') && unicode.IsLetter(cp1) {
+		cp += 2
+		for ; cp < len(filebuf) && (isalnum(filebuf[cp]) || filebuf[cp] == '_'); cp++ {
+		}
+		return TK_MULTI, cp, cp
+	}
+	/* All other (one character) operators */
+	return TK_OP, cp + 1, cp + 1
+}
+
+/* Break the text of one input file into tokens and pass each token to
+** parseonetoken().  This is called once for the main input file, and
+** again for each file named by %include_file or %import.  Each of defs,
+** the %define directives of the file, takes effect for the code blocks
+** after its line, in this file and in those that follow.
+ */
+func scan_input(ps *pstate, filebuf []rune, defs []ppdefine) {
+	lineno := 1
+	for cp := 0; cp < len(filebuf); {
+		kind, end, next := next_token(filebuf, cp)
+		if kind != TK_SPACE && kind != TK_COMMENT {
+			for len(defs) > 0 && defs[0].lineno < lineno {
+				ps.defines.addDefine(defs[0].name, defs[0].value)
+				defs = defs[1:]
+			}
+			ps.tokenstart = cp      /* Mark the beginning of the token */
+			ps.tokenlineno = lineno /* Linenumber on which token begins */
+			if kind == TK_STRING && end == len(filebuf) {
+				ErrorMsg(ps.filename, lineno, "String starting on this line is not terminated before the end of the file.")
+				ps.errorcnt++
+			} else if kind == TK_CODE && end == len(filebuf) {
+				ErrorMsg(ps.filename, lineno, "C code starting on this line is not terminated before the end of the file.")
 				ps.errorcnt++
-				nextcp = cp
-			} else {
-				nextcp = cp + 1
 			}
-		} else if isalnum(c) { /* Identifiers */
-			for ; cp < len(filebuf) && (isalnum(filebuf[cp]) || filebuf[cp] == '_'); cp++ {
+			token := filebuf[cp:end]
+			if token[0] == '{' && len(ps.defines.mappings) > 0 {
+				token = []rune(ps.defines.replaceAll(string(token)))
 			}
-			nextcp = cp
-		} else if c == ':' && cp1 == ':' && cp2 == '=' { /* The operator "::=" */
-			cp += 3
-			nextcp = cp
-		} else if (c == '/' || c == '|') && unicode.IsLetter(cp1) {
-			cp += 2
-			for ; cp < len(filebuf) && (isalnum(filebuf[cp]) || filebuf[cp] == '_'); cp++ {
+			parseonetoken(ps, token) /* Parse the token */
+		}
+		/* Keep track of the line number */
+		for _, c := range filebuf[cp:next] {
+			if c == '\n' {
+				lineno++
 			}
-			nextcp = cp
-		} else { /* All other (one character) operators */
-			cp++
-			nextcp = cp
 		}
-		parseonetoken(&ps, filebuf[ps.tokenstart:cp]) /* Parse the token */
-		cp = nextcp
+		cp = next
+	}
+	for _, d := range defs {
+		ps.defines.addDefine(d.name, d.value)
 	}
-	gp.rule = ps.firstrule
-	gp.errorcnt = ps.errorcnt
 }
 
 /*************************** From the file "plink.c" *********************/
@@ -2828,6 +3518,9 @@ func Plink_delete(plp *plink) {
 ** function.
  */
 func file_makename(lemp *lemon, suffix string) string {
+	if path := outputPaths[suffix]; path != "" {
+		return path
+	}
 	filename := lemp.filename
 	if outputDir != "" {
 		last := strings.LastIndex(filename, "/")
@@ -2847,9 +3540,18 @@ func file_makename(lemp *lemon, suffix string) string {
 	return filename + suffix
 }
 
+/* An output file.  It is written to a temporary file in the same
+** directory, which replaces the real file only when the whole run has
+** succeeded; see file_commit(). */
+type outfile struct {
+	name string /* Name of the output file */
+	tmp  string /* Temporary file holding its new contents */
+}
+
 /* Open a file with a name based on the name of the input file,
 ** but with a different (specified) suffix, and return a pointer
-** to the stream */
+** to the stream.  Files opened for writing are temporary files until
+** file_commit() is called. */
 func file_open(lemp *lemon, suffix string, mode string) *os.File {
 	var flag int
 	switch mode {
@@ -2861,20 +3563,109 @@ func file_open(lemp *lemon, suffix string, mode string) *os.File {
 		assert(false, fmt.Sprintf(`want mode in {"rb,wb"}; got %q`, mode))
 	}
 
-	lemp.outname = file_makename(lemp, suffix)
-	fp, err := os.OpenFile(lemp.outname, flag, 0644)
+	lemp.outname = file_makename(lemp, suffix)
+	if mode == "wb" {
+		return file_create(lemp, lemp.outname)
+	}
+	fp, err := os.OpenFile(lemp.outname, flag, 0644)
+	if err != nil {
+		fmt.Println(err)
+		if mode == "rb" {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Can't open file \"%s\".\n", lemp.outname)
+		lemp.errorcnt++
+		return nil
+	}
+	return fp
+}
+
+/* Create a temporary file to hold the new contents of the output file
+** called name */
+func file_create(lemp *lemon, name string) *os.File {
+	dir, pattern := filepath.Dir(name), "."+filepath.Base(name)+".*"
+	if name == "-" || lemp.checkOnly {
+		dir, pattern = "", "golemon-"+filepath.Base(name)+"-*"
+	}
+	fp, err := os.CreateTemp(dir, pattern)
 	if err != nil {
 		fmt.Println(err)
-		if mode == "rb" {
-			return nil
-		}
-		fmt.Fprintf(os.Stderr, "Can't open file \"%s\".\n", lemp.outname)
+		fmt.Fprintf(os.Stderr, "Can't open file \"%s\".\n", name)
 		lemp.errorcnt++
 		return nil
 	}
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	fp.Chmod(perm)
+	lemp.outfiles = append(lemp.outfiles, &outfile{name: name, tmp: fp.Name()})
 	return fp
 }
 
+/* Called at the end of the run.  If there were no errors, move each
+** output file into place, unless it is identical to the file already
+** there, which is left alone so that its modification time is kept.
+** If there were errors, discard the new outputs, leaving the old ones
+** untouched. */
+func file_commit(lemp *lemon) {
+	for _, of := range lemp.outfiles {
+		if lemp.errorcnt > 0 {
+			os.Remove(of.tmp)
+			continue
+		}
+		data, err := os.ReadFile(of.tmp)
+		if of.name == "-" {
+			os.Remove(of.tmp)
+			if err == nil {
+				_, err = os.Stdout.Write(data)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Can't write to standard output: %v\n", err)
+				lemp.errorcnt++
+			}
+			continue
+		}
+		if err == nil {
+			if old, err := os.ReadFile(of.name); err == nil && bytes.Equal(data, old) {
+				os.Remove(of.tmp)
+				continue
+			}
+		}
+		if err := os.Rename(of.tmp, of.name); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't write file \"%s\": %v\n", of.name, err)
+			os.Remove(of.tmp)
+			lemp.errorcnt++
+		}
+	}
+	lemp.outfiles = nil
+}
+
+/* Called at the end of the run instead of file_commit() for -check.
+** Print a unified diff for each output that differs from the file on
+** disk, then discard the new outputs.  Return the number that differ. */
+func file_check(lemp *lemon) int {
+	ndiff := 0
+	for _, of := range lemp.outfiles {
+		data, err := os.ReadFile(of.tmp)
+		os.Remove(of.tmp)
+		if lemp.errorcnt > 0 || err != nil || of.name == "-" {
+			continue
+		}
+		old, err := os.ReadFile(of.name)
+		aname := "a/" + filepath.ToSlash(of.name)
+		if err != nil {
+			aname = "/dev/null"
+		}
+		if unified_diff(os.Stdout, aname, "b/"+filepath.ToSlash(of.name), string(old), string(data)) {
+			fmt.Fprintf(os.Stderr, "%s is out of date.\n", of.name)
+			ndiff++
+		}
+	}
+	lemp.outfiles = nil
+	return ndiff
+}
+
 /* Print the text of a rule
  */
 func rule_print(out io.Writer, rp *rule) {
@@ -2929,6 +3720,18 @@ func Reprint(lemp *lemon) {
 		fmt.Printf("\n")
 	}
 	for rp := lemp.rule; rp != nil; rp = rp.next {
+		/* Rules that came from EBNF operators are printed as written, followed
+		** by their desugared form as a comment.  Synthetic rules are printed
+		** only as comments, so that the output is still a valid grammar. */
+		if strings.ContainsRune(rp.lhs.name, '(') {
+			fmt.Printf("// ")
+		} else if rp.sugar != "" {
+			fmt.Printf("%s.", rp.sugar)
+			if rp.precsym != nil {
+				fmt.Printf(" [%s]", rp.precsym.name)
+			}
+			fmt.Printf("\n//   => ")
+		}
 		rule_print(os.Stdout, rp)
 		fmt.Printf(".")
 		if rp.precsym != nil {
@@ -3165,6 +3968,9 @@ func ReportOutput(lemp *lemon) {
 			fmt.Fprintf(fp, " [%s precedence=%d]", rp.precsym.name, rp.precsym.prec)
 		}
 		fmt.Fprintf(fp, "\n")
+		if rp.sugar != "" {
+			fmt.Fprintf(fp, "        (written as: %s.)\n", rp.sugar)
+		}
 	}
 	fp.Close()
 	return
@@ -3272,6 +4078,21 @@ func tplt_skip_header(in *bufio.Reader, lineno *int) {
 	}
 }
 
+/* Skip forward past a section of the template, to the next "%%", for a
+** driver that the parser does not need
+ */
+func tplt_skip(in *bufio.Reader) {
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return
+		}
+		if strings.HasPrefix(line, "%%") {
+			return
+		}
+	}
+}
+
 /* The next function finds the template file and opens it, returning
 ** a pointer to the opened file. */
 func tplt_open(lemp *lemon) *os.File {
@@ -3326,11 +4147,36 @@ func tplt_open(lemp *lemon) *os.File {
 	return in
 }
 
+/* Return filename as it should appear in a //line directive in the
+** generated parser.  The Go tools take a relative name in a directive to
+** be relative to the directory of the file that contains it. */
+func linedir_name(lemp *lemon, filename string) string {
+	goname := file_makename(lemp, ".go")
+	if goname == "-" {
+		/* The parser goes to standard output, and has no name of its own.
+		** Call it by the name it would have by default, as "-" would
+		** name no file at all. */
+		if filename == goname {
+			base := filepath.Base(lemp.filename)
+			return strings.TrimSuffix(base, filepath.Ext(base)) + ".go"
+		}
+		return filename
+	}
+	if filepath.Clean(filename) == filepath.Clean(goname) {
+		return filepath.Base(goname)
+	}
+	if rel, err := filepath.Rel(filepath.Dir(goname), filename); err == nil {
+		return rel
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
 /* Print a #line directive line to the output file. */
-func tplt_linedir(out *os.File, lineno int, filename string) {
-	fmt.Fprintf(out, "//line %d \"", lineno)
-	out.WriteString(strings.ReplaceAll(filename, "\\", "\\\\"))
-	fmt.Fprintf(out, "\"\n")
+func tplt_linedir(out *os.File, lemp *lemon, lineno int, filename string) {
+	fmt.Fprintf(out, "//line %s:%d\n", linedir_name(lemp, filename), lineno)
 }
 
 /* Print a string to the file and keep the linenumber up to date */
@@ -3351,11 +4197,31 @@ func tplt_print(out *os.File, lemp *lemon, str string, lineno *int) {
 	}
 	if !lemp.nolinenosflag {
 		(*lineno)++
-		tplt_linedir(out, *lineno, lemp.outname)
+		tplt_linedir(out, lemp, *lineno, lemp.outname)
 	}
 	return
 }
 
+/*
+** Emit a single case of yy_destructor() that matches each of the
+** symbols in syms, one to a line
+ */
+func emit_destructor_cases(out *os.File, syms []*symbol, lineno *int) {
+	for i, sp := range syms {
+		switch {
+		case len(syms) == 1:
+			fmt.Fprintf(out, "    case %d: /* %s */\n", sp.index, sp.name)
+		case i == 0:
+			fmt.Fprintf(out, "    case %d, /* %s */\n", sp.index, sp.name)
+		case i < len(syms)-1:
+			fmt.Fprintf(out, "      %d, /* %s */\n", sp.index, sp.name)
+		default:
+			fmt.Fprintf(out, "      %d: /* %s */\n", sp.index, sp.name)
+		}
+		(*lineno)++
+	}
+}
+
 /*
 ** The following routine emits code for the destructor for the
 ** symbol sp
@@ -3381,7 +4247,7 @@ func emit_destructor_code(
 		(*lineno)++
 		if !lemp.nolinenosflag {
 			(*lineno)++
-			tplt_linedir(out, sp.destLineno, lemp.filename)
+			tplt_linedir(out, lemp, sp.destLineno, sp.destFilename)
 		}
 	} else if lemp.vardest != "" {
 		cp = lemp.vardest
@@ -3409,7 +4275,7 @@ func emit_destructor_code(
 	(*lineno)++
 	if !lemp.nolinenosflag {
 		(*lineno)++
-		tplt_linedir(out, *lineno, lemp.outname)
+		tplt_linedir(out, lemp, *lineno, lemp.outname)
 	}
 	fmt.Fprintf(out, "}\n")
 	(*lineno)++
@@ -3482,7 +4348,7 @@ func translate_code(lemp *lemon, rp *rule) int {
 		lhsused = true
 		used[0] = true
 		if rp.lhs.dtnum != rp.rhs[0].dtnum {
-			ErrorMsg(lemp.filename, rp.ruleline,
+			ErrorMsg(rp.filename, rp.ruleline,
 				"%s(%s) and %s(%s) share the same label but have "+
 					"different datatypes.",
 				rp.lhs.name, rp.lhsalias, rp.rhs[0].name, rp.rhsalias[0])
@@ -3534,7 +4400,7 @@ func translate_code(lemp *lemon, rp *rule) int {
 				for i := range rp.rhs {
 					if rp.rhsalias[i] != "" && runesStringEqual(substr, rp.rhsalias[i]) {
 						if i == 0 && dontUseRhs0 {
-							ErrorMsg(lemp.filename, rp.ruleline,
+							ErrorMsg(rp.filename, rp.ruleline,
 								"Label %s used after '%s'.",
 								rp.rhsalias[0], zOvwrt)
 							lemp.errorcnt++
@@ -3574,7 +4440,7 @@ func translate_code(lemp *lemon, rp *rule) int {
 
 	/* Check to make sure the LHS has been used */
 	if rp.lhsalias != "" && !lhsused {
-		ErrorMsg(lemp.filename, rp.ruleline,
+		ErrorMsg(rp.filename, rp.ruleline,
 			"Label \"%s\" for \"%s(%s)\" is never USED.",
 			rp.lhsalias, rp.lhs.name, rp.lhsalias)
 		lemp.errorcnt++
@@ -3587,7 +4453,7 @@ func translate_code(lemp *lemon, rp *rule) int {
 		if rp.rhsalias[i] != "" {
 			if i > 0 {
 				if rp.lhsalias != "" && rp.lhsalias == rp.rhsalias[i] {
-					ErrorMsg(lemp.filename, rp.ruleline,
+					ErrorMsg(rp.filename, rp.ruleline,
 						"%s(%s) has the same label as the LHS but is not the left-most "+
 							"symbol on the RHS.",
 						rp.rhs[i].name, rp.rhsalias[i])
@@ -3595,7 +4461,7 @@ func translate_code(lemp *lemon, rp *rule) int {
 				}
 				for j := 0; j < i; j++ {
 					if rp.rhsalias[j] != "" && rp.rhsalias[j] == rp.rhsalias[i] {
-						ErrorMsg(lemp.filename, rp.ruleline,
+						ErrorMsg(rp.filename, rp.ruleline,
 							"Label %s used for multiple symbols on the RHS of a rule.",
 							rp.rhsalias[i])
 						lemp.errorcnt++
@@ -3604,7 +4470,7 @@ func translate_code(lemp *lemon, rp *rule) int {
 				}
 			}
 			if !used[i] {
-				ErrorMsg(lemp.filename, rp.ruleline,
+				ErrorMsg(rp.filename, rp.ruleline,
 					"Label %s for \"%s(%s)\" is never used.",
 					rp.rhsalias[i], rp.rhs[i].name, rp.rhsalias[i])
 				lemp.errorcnt++
@@ -3659,17 +4525,21 @@ func emit_code(
 
 	/* Generate code to do the reduce action */
 	if rp.code != "" {
+		/* The directive goes inside the braces, because gofmt puts the
+		** first statement of a one-line action on a line of its own */
+		fmt.Fprintf(out, "{")
 		if !lemp.nolinenosflag {
-			(*lineno)++
-			tplt_linedir(out, rp.line, lemp.filename)
+			fmt.Fprintf(out, "\n")
+			(*lineno) += 2
+			tplt_linedir(out, lemp, rp.line, rp.filename)
 		}
-		fmt.Fprintf(out, "{%s", rp.code)
+		fmt.Fprintf(out, "%s", rp.code)
 		addNewlines(rp.code)
 		fmt.Fprintf(out, "}\n")
 		(*lineno)++
 		if !lemp.nolinenosflag {
 			(*lineno)++
-			tplt_linedir(out, *lineno, lemp.outname)
+			tplt_linedir(out, lemp, *lineno, lemp.outname)
 		}
 	}
 
@@ -3757,7 +4627,7 @@ func print_stack_union(
 	lineno := *plineno
 	tokentype := lemp.tokentype
 	if tokentype == "" {
-		tokentype = "void*"
+		tokentype = "interface{}"
 	}
 	fmt.Fprintf(out, "type %sTOKENTYPE = %s\n", name, tokentype)
 	lineno++
@@ -3783,6 +4653,116 @@ func print_stack_union(
 	*plineno = lineno
 }
 
+/*
+** Print the type of the value of the start symbol, which ParseAll()
+** returns, and the method that takes it from the parser's stack.  Must
+** be called after print_stack_union() has set the ".dtnum" fields.
+ */
+func print_result_type(
+	out *os.File, /* The output stream */
+	lemp *lemon, /* The main info structure for this parser */
+	plineno *int, /* Pointer to the line number */
+) {
+	name := lemp.name
+	if name == "" {
+		name = "Parse"
+	}
+	var sp *symbol
+	if lemp.start != "" {
+		sp = Symbol_find(lemp.start)
+	}
+	if sp == nil {
+		sp = lemp.startRule.lhs
+	}
+	typ := name + "TOKENTYPE"
+	if sp.dtnum != 0 {
+		typ = sp.datatype
+		if typ == "" {
+			typ = lemp.vartype
+		}
+		typ = strings.TrimSpace(typ)
+	}
+	fmt.Fprintf(out, "type %sRESULTTYPE = %s\n\n", name, typ)
+	fmt.Fprintf(out, "/* The value of the start symbol is left just above the top of the stack */\n")
+	if lemp.cst && typ == cst_nodetype(lemp) {
+		/* The text after the last token goes with the root of the tree */
+		fmt.Fprintf(out, "func (yypParser *yyParser) yyresult() %sRESULTTYPE {\n", name)
+		fmt.Fprintf(out, "\tyyroot := yypParser.yystack[1].minor.yy%d\n", sp.dtnum)
+		fmt.Fprintf(out, "\tif yyroot != nil {\n\t\tyyroot.Trivia = yypParser.yytrivia\n\t}\n")
+		fmt.Fprintf(out, "\treturn yyroot\n}\n\n")
+		*plineno += 11
+	} else {
+		fmt.Fprintf(out, "func (yypParser *yyParser) yyresult() %sRESULTTYPE { return yypParser.yystack[1].minor.yy%d }\n\n", name, sp.dtnum)
+		*plineno += 5
+	}
+}
+
+/*
+** Print the method that ParseClone(), ParseSnapshot() and ParseRestore()
+** call to give each value they copy from one stack to another a copy of
+** its own, by way of the %copy, %token_copy and %default_copy code.  In
+** that code, "$$" is the value, which the code replaces with its copy.
+** A symbol without such code shares its value between the copies.  Must
+** be called after print_stack_union() has set the ".dtnum" fields.
+ */
+func print_copy_func(
+	out *os.File, /* The output stream */
+	lemp *lemon, /* The main info structure for this parser */
+	plineno *int, /* Pointer to the line number */
+) {
+	copycode := func(sp *symbol) string {
+		switch {
+		case sp.typ == TERMINAL:
+			return lemp.tokencopy
+		case sp.typ != NONTERMINAL || sp == lemp.errsym:
+			return ""
+		case sp.copycode != "":
+			return sp.copycode
+		}
+		return lemp.varcopy
+	}
+	fmt.Fprintf(out, "/* Give the value of a symbol its own copy, as its %%copy code does */\n")
+	fmt.Fprintf(out, "func (yypParser *yyParser) yy_copy(yymajor YYCODETYPE, yypminor *YYMINORTYPE) {\n")
+	fmt.Fprintf(out, "\tswitch yymajor {\n")
+	*plineno += 3
+	done := make([]bool, lemp.nsymbol)
+	for i := 0; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		cp := copycode(sp)
+		if cp == "" || done[i] {
+			continue
+		}
+		/* Combine the symbols with the same code and type into one case */
+		fmt.Fprintf(out, "\tcase %d: /* %s */\n", sp.index, sp.name)
+		(*plineno)++
+		for j := i + 1; j < lemp.nsymbol; j++ {
+			sp2 := lemp.symbols[j]
+			if !done[j] && sp2.dtnum == sp.dtnum && copycode(sp2) == cp {
+				fmt.Fprintf(out, "\t\tfallthrough\n\tcase %d: /* %s */\n", sp2.index, sp2.name)
+				*plineno += 2
+				done[j] = true
+			}
+		}
+		fmt.Fprintf(out, "\t\t{\n")
+		(*plineno)++
+		if cp == sp.copycode && !lemp.nolinenosflag {
+			(*plineno)++
+			tplt_linedir(out, lemp, sp.copyLineno, sp.copyFilename)
+		}
+		cp = strings.ReplaceAll(cp, "$$", fmt.Sprintf("(yypminor.yy%d)", sp.dtnum))
+		fmt.Fprintf(out, "%s\n", cp)
+		*plineno += strings.Count(cp, "\n") + 1
+		if !lemp.nolinenosflag {
+			(*plineno)++
+			tplt_linedir(out, lemp, *plineno, lemp.outname)
+		}
+		fmt.Fprintf(out, "\t\t}\n")
+		(*plineno)++
+	}
+	fmt.Fprintf(out, "\t}\n}\n\n")
+	*plineno += 3
+}
+
 /*
 ** Return the name of a C datatype able to represent values between
 ** lwr and upr, inclusive.  If pnByte!=NULL then also write the sizeof
@@ -3815,6 +4795,99 @@ func minimum_size_type(lwr int, upr int, pnByte *int) string {
 	return zType
 }
 
+/*
+** Write one of the parser tables to "out", together with an accessor
+** function NAME_at(i) that the template uses to read entry i.
+**
+** By default the table is a Go slice literal of type zType.  If the
+** -tables=string option was given, the table is instead a string constant
+** holding the nByte-wide little-endian encoding of each entry.  Strings
+** are cheaper for the Go compiler than large composite literals, and
+** they live in read-only data rather than the initialized data section.
+ */
+func emit_table(
+	out *os.File, /* The output stream */
+	lemp *lemon, /* The main info structure for this parser */
+	name string, /* Name of the table, such as "yy_action" */
+	zType string, /* Go type of a single entry */
+	nByte int, /* Size of zType in bytes */
+	signed bool, /* True if zType is a signed type */
+	values []int, /* The table entries */
+	lineno *int, /* Pointer to the line number */
+) {
+	if !lemp.stringTables {
+		fmt.Fprintf(out, "var %s = []%s{\n", name, zType)
+		(*lineno)++
+		for i, j := 0, 0; i < len(values); i++ {
+			if j == 0 {
+				fmt.Fprintf(out, "\t/* %d */", i)
+			}
+			fmt.Fprintf(out, " %d,", values[i])
+			if j == 9 || i == len(values)-1 {
+				fmt.Fprintf(out, "\n")
+				(*lineno)++
+				j = 0
+			} else {
+				j++
+			}
+		}
+		fmt.Fprintf(out, "}\n\n")
+		fmt.Fprintf(out, "func %s_at(i int) %s { return %s[i] }\n\n", name, zType, name)
+		*lineno += 4
+		return
+	}
+
+	fmt.Fprintf(out, "const %s_data = \"\" +\n", name)
+	(*lineno)++
+	const perLine = 32 /* Encoded bytes per line of output */
+	var buf bytes.Buffer
+	for i, v := range values {
+		for k := 0; k < nByte; k++ {
+			fmt.Fprintf(&buf, "\\x%02x", byte(v>>(8*k)))
+		}
+		if (i+1)*nByte%perLine == 0 || i == len(values)-1 {
+			sep := " +"
+			if i == len(values)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(out, "\t\"%s\"%s\n", drain(&buf), sep)
+			(*lineno)++
+		}
+	}
+	if len(values) == 0 {
+		fmt.Fprintf(out, "\t\"\"\n")
+		(*lineno)++
+	}
+	fmt.Fprintf(out, "\n")
+	(*lineno)++
+
+	/* Build the expression that decodes entry i from the string */
+	var expr string
+	switch nByte {
+	case 1:
+		expr = fmt.Sprintf("%s_data[i]", name)
+		if signed {
+			expr = fmt.Sprintf("int8(%s)", expr)
+		}
+	case 2:
+		expr = fmt.Sprintf("uint16(%s_data[2*i]) | uint16(%s_data[2*i+1])<<8", name, name)
+		if signed {
+			expr = fmt.Sprintf("int16(%s)", expr)
+		}
+	default:
+		expr = fmt.Sprintf("uint32(%s_data[4*i]) | uint32(%s_data[4*i+1])<<8 | uint32(%s_data[4*i+2])<<16 | uint32(%s_data[4*i+3])<<24",
+			name, name, name, name)
+		if signed {
+			expr = fmt.Sprintf("int32(%s)", expr)
+		}
+	}
+	if !signed {
+		expr = fmt.Sprintf("%s(%s)", zType, expr)
+	}
+	fmt.Fprintf(out, "func %s_at(i int) %s { return %s }\n\n", name, zType, expr)
+	*lineno += 2
+}
+
 /*
 ** Each state contains a set of token transaction and a set of
 ** nonterminal transactions.  Each of these sets makes an instance
@@ -3883,16 +4956,26 @@ func ReportTable(lemp *lemon,
 		inFile.Close()
 		return
 	}
+	outname := lemp.outname
+	input, err := io.ReadAll(inFile)
+	if err != nil {
+		inFile.Close()
+		out.Close()
+		return
+	}
 
 	if !sqlFlag {
 		sql = nil
 	} else {
 		sql = file_open(lemp, ".sql", "wb")
+		lemp.outname = outname
 		if sql == nil {
 			inFile.Close()
 			out.Close()
 			return
 		}
+		fmt.Fprintf(sql, "-- Code generated by golemon from %s. DO NOT EDIT.\n", lemp.filename)
+		fmt.Fprintf(sql, "%s\n", strings.Join(generated_header(lemp, "-- ", inFile.Name(), input), "\n"))
 		fmt.Fprintf(sql,
 			"BEGIN;\n"+
 				"CREATE TABLE symbol(\n"+
@@ -4003,24 +5086,47 @@ func ReportTable(lemp *lemon,
 		defines.addDefine("ParseCTX_FETCH", "")
 		defines.addDefine("ParseCTX_STORE", "")
 	}
-
-	input, err := io.ReadAll(inFile)
-	if err != nil {
-		return
+	if lemp.recover {
+		defines.addDefine("ParseRECOVER_SDECL", "yyRecoverState")
+		defines.addDefine("ParseRECOVER_INIT", "yypParser.yy_recover_init()")
+		defines.addDefine("ParseRECOVER_COPY", "pParser.yy_recover_copy()")
+		defines.addDefine("ParseRECOVER_FINALIZE", "pParser.yy_drop_held()")
+	} else {
+		defines.addDefine("ParseRECOVER_SDECL", "")
+		defines.addDefine("ParseRECOVER_INIT", "")
+		defines.addDefine("ParseRECOVER_COPY", "")
+		defines.addDefine("ParseRECOVER_FINALIZE", "")
+	}
+	if lemp.pull {
+		defines.addDefine("ParsePULL_IMPORT", "yycontext \"context\" /* Named so as not to clash with an import in %include */")
+		defines.addDefine("ParsePULL_SDECL", "yyPullState")
+		defines.addDefine("ParsePULL_EDECL", "yyPullEntry")
+		defines.addDefine("ParsePULL_SHIFT", "yypParser.yy_shift_loc(yytos)")
+		defines.addDefine("ParsePULL_REDUCE", "yypParser.yy_reduce_loc(yymsp, yysize)")
+	} else {
+		defines.addDefine("ParsePULL_IMPORT", "")
+		defines.addDefine("ParsePULL_SDECL", "")
+		defines.addDefine("ParsePULL_EDECL", "")
+		defines.addDefine("ParsePULL_SHIFT", "")
+		defines.addDefine("ParsePULL_REDUCE", "")
 	}
+
 	replaced := defines.replaceAll(string(input))
 	in := bufio.NewReader(bytes.NewBufferString(replaced))
 
+	fmt.Fprintf(out, "// Code generated by golemon from %s. DO NOT EDIT.\n\n", lemp.filename)
 	fmt.Fprintf(out,
 		"/* This file is automatically generated by Lemon from input grammar\n"+
-			"** source file \"%s\". */\n", lemp.filename)
-	lineno += 2
+			"** source file \"%s\".\n**\n", lemp.filename)
+	header := generated_header(lemp, "** ", inFile.Name(), input)
+	fmt.Fprintf(out, "%s\n*/\n", strings.Join(header, "\n"))
+	lineno += 6 + len(header)
 
 	/* The first %include directive begins with a C-language comment,
 	 ** then skip over the header comment of the template file
 	 */
 	includeRunes := []rune(lemp.include)
-	for i := 0; unicode.IsSpace(includeRunes[i]); i++ {
+	for i := 0; i < len(includeRunes) && unicode.IsSpace(includeRunes[i]); i++ {
 		if includeRunes[i] == '\n' {
 			includeRunes = includeRunes[i+1:]
 			lemp.include = string(includeRunes)
@@ -4028,7 +5134,7 @@ func ReportTable(lemp *lemon,
 		}
 	}
 
-	if includeRunes[0] == '/' && !strings.HasPrefix(lemp.include, "//line ") {
+	if len(includeRunes) > 0 && includeRunes[0] == '/' && !strings.HasPrefix(lemp.include, "//line ") {
 		tplt_skip_header(in, &lineno)
 	} else {
 		tplt_xfer(lemp.name, in, out, &lineno)
@@ -4063,6 +5169,10 @@ func ReportTable(lemp *lemon,
 	lineno++
 
 	print_stack_union(out, lemp, &lineno)
+	if lemp.pull {
+		print_result_type(out, lemp, &lineno)
+	}
+	print_copy_func(out, lemp, &lineno)
 
 	wildcard := 0
 	if lemp.wildcard != nil {
@@ -4100,7 +5210,8 @@ func ReportTable(lemp *lemon,
 	lineno++
 	fmt.Fprintf(out, "const YYTRACKMAXSTACKDEPTH = false\n")
 	lineno++
-	fmt.Fprintf(out, "const NDEBUG = false\n")
+	_, ndebug := azDefine["NDEBUG"]
+	fmt.Fprintf(out, "const NDEBUG = %v\n", ndebug)
 	lineno++
 
 	errsym := 0
@@ -4112,6 +5223,12 @@ func ReportTable(lemp *lemon,
 
 	fmt.Fprintf(out, "const YYFALLBACK = %v\n", lemp.has_fallback)
 	lineno++
+	fmt.Fprintf(out, "const YYSYNC = %v\n", lemp.has_sync)
+	lineno++
+	fmt.Fprintf(out, "const YYFUZZ = %v\n", lemp.fuzz)
+	lineno++
+	fmt.Fprintf(out, "const YYINCREMENTAL = %v\n", lemp.incremental)
+	lineno++
 
 	/* Compute the action table, but do not output it yet.  The action
 	 ** table must be computed before generating the YYNSTATE macro because
@@ -4283,76 +5400,38 @@ func ReportTable(lemp *lemon,
 	lemp.tablesize += n * szActionType
 	fmt.Fprintf(out, "const YY_ACTTAB_COUNT = %d\n\n", n)
 	lineno += 2
-	fmt.Fprintf(out, "var yy_action = []YYACTIONTYPE{\n")
-	lineno++
-	for i, j := 0, 0; i < n; i++ {
+	values := make([]int, n)
+	for i := 0; i < n; i++ {
 		action := acttab_yyaction(pActtab, i)
 		if action < 0 {
 			action = lemp.noAction
 		}
-		if j == 0 {
-			fmt.Fprintf(out, "\t/* %d */", i)
-		}
-		fmt.Fprintf(out, " %d,", action)
-		if j == 9 || i == n-1 {
-			fmt.Fprintf(out, "\n")
-			lineno++
-			j = 0
-		} else {
-			j++
-		}
+		values[i] = action
 	}
-	fmt.Fprintf(out, "}\n")
-	lineno++
+	emit_table(out, lemp, "yy_action", "YYACTIONTYPE", szActionType, false, values, &lineno)
 
 	/* Output the yy_lookahead table */
 	n = acttab_lookahead_size(pActtab)
 	lemp.nlookaheadtab = n
 	lemp.tablesize += n * szCodeType
-	fmt.Fprintf(out, "var yy_lookahead = []YYCODETYPE{\n")
-	lineno++
-	i, j := 0, 0
-	for i, j = 0, 0; i < n; i++ {
+	values = values[:0]
+	for i := 0; i < n; i++ {
 		la := acttab_yylookahead(pActtab, i)
 		if la < 0 {
 			la = lemp.nsymbol
 		}
-		if j == 0 {
-			fmt.Fprintf(out, "\t/* %d */", i)
-		}
-		fmt.Fprintf(out, " %d,", la)
-		if j == 9 {
-			fmt.Fprintf(out, "\n")
-			lineno++
-			j = 0
-		} else {
-			j++
-		}
+		values = append(values, la)
 	}
 	/* Add extra entries to the end of the yy_lookahead[] table so that
 	 ** yy_shift_ofst[]+iToken will always be a valid index into the array,
 	 ** even for the largest possible value of yy_shift_ofst[] and iToken. */
 	nLookAhead := lemp.nterminal + lemp.nactiontab
-	for i < nLookAhead {
-		if j == 0 {
-			fmt.Fprintf(out, " /* %d */", i)
-		}
-		fmt.Fprintf(out, " %d,", lemp.nterminal)
-		if j == 9 {
-			fmt.Fprintf(out, "\n")
-			lineno++
-			j = 0
-		} else {
-			j++
-		}
-		i++
-	}
-	if j > 0 {
-		fmt.Fprintf(out, "\n")
-		lineno++
+	for len(values) < nLookAhead {
+		values = append(values, lemp.nterminal)
 	}
-	fmt.Fprintf(out, "}\n\n")
+	fmt.Fprintf(out, "const YY_NLOOKAHEAD = %d\n\n", len(values))
 	lineno += 2
+	emit_table(out, lemp, "yy_lookahead", "YYCODETYPE", szCodeType, false, values, &lineno)
 
 	/* Output the yy_shift_ofst[] table */
 	n = lemp.nxstate
@@ -4367,30 +5446,18 @@ func ReportTable(lemp *lemon,
 	lineno++
 	fmt.Fprintf(out, "\n")
 	lineno++
-	fmt.Fprintf(out, "var yy_shift_ofst = []%s{\n",
-		minimum_size_type(mnTknOfst, lemp.nterminal+lemp.nactiontab, &sz))
-	lineno++
+	zType := minimum_size_type(mnTknOfst, lemp.nterminal+lemp.nactiontab, &sz)
 	lemp.tablesize += n * sz
-	for i, j = 0, 0; i < n; i++ {
+	values = values[:0]
+	for i := 0; i < n; i++ {
 		stp := lemp.sorted[i]
 		ofst := stp.iTknOfst
 		if ofst == NO_OFFSET {
 			ofst = lemp.nactiontab
 		}
-		if j == 0 {
-			fmt.Fprintf(out, "\t/* %d */", i)
-		}
-		fmt.Fprintf(out, " %d,", ofst)
-		if j == 9 || i == n-1 {
-			fmt.Fprintf(out, "\n")
-			lineno++
-			j = 0
-		} else {
-			j++
-		}
+		values = append(values, ofst)
 	}
-	fmt.Fprintf(out, "}\n\n")
-	lineno += 2
+	emit_table(out, lemp, "yy_shift_ofst", zType, sz, mnTknOfst < 0, values, &lineno)
 
 	/* Output the yy_reduce_ofst[] table */
 	n = lemp.nxstate
@@ -4405,56 +5472,32 @@ func ReportTable(lemp *lemon,
 	lineno++
 	fmt.Fprintf(out, "\n")
 	lineno++
-	fmt.Fprintf(out, "var yy_reduce_ofst = []%s{\n",
-		minimum_size_type(mnNtOfst-1, mxNtOfst, &sz))
-	lineno++
+	zType = minimum_size_type(mnNtOfst-1, mxNtOfst, &sz)
 	lemp.tablesize += n * sz
-	for i, j = 0, 0; i < n; i++ {
+	values = values[:0]
+	for i := 0; i < n; i++ {
 		stp := lemp.sorted[i]
 		ofst := stp.iNtOfst
 		if ofst == NO_OFFSET {
 			ofst = mnNtOfst - 1
 		}
-		if j == 0 {
-			fmt.Fprintf(out, "\t/* %d */", i)
-		}
-		fmt.Fprintf(out, " %d,", ofst)
-		if j == 9 || i == n-1 {
-			fmt.Fprintf(out, "\n")
-			lineno++
-			j = 0
-		} else {
-			j++
-		}
+		values = append(values, ofst)
 	}
-	fmt.Fprintf(out, "}\n")
-	lineno++
+	emit_table(out, lemp, "yy_reduce_ofst", zType, sz, mnNtOfst-1 < 0, values, &lineno)
 
 	/* Output the default action table */
-	fmt.Fprintf(out, "var yy_default = []YYACTIONTYPE{\n")
-	lineno++
 	n = lemp.nxstate
 	lemp.tablesize += n * szActionType
-	for i, j = 0, 0; i < n; i++ {
+	values = values[:0]
+	for i := 0; i < n; i++ {
 		stp := lemp.sorted[i]
-		if j == 0 {
-			fmt.Fprintf(out, "\t/* %d */", i)
-		}
 		if stp.iDfltReduce < 0 {
-			fmt.Fprintf(out, " %d,", lemp.errAction)
-		} else {
-			fmt.Fprintf(out, " %d,", stp.iDfltReduce+lemp.minReduce)
-		}
-		if j == 9 || i == n-1 {
-			fmt.Fprintf(out, "\n")
-			lineno++
-			j = 0
+			values = append(values, lemp.errAction)
 		} else {
-			j++
+			values = append(values, stp.iDfltReduce+lemp.minReduce)
 		}
 	}
-	fmt.Fprintf(out, "}\n")
-	lineno++
+	emit_table(out, lemp, "yy_default", "YYACTIONTYPE", szActionType, false, values, &lineno)
 	tplt_xfer(lemp.name, in, out, &lineno)
 
 	/* Generate the table of fallback tokens.
@@ -4478,6 +5521,18 @@ func ReportTable(lemp *lemon,
 	}
 	tplt_xfer(lemp.name, in, out, &lineno)
 
+	/* Generate the table of %sync tokens.
+	 */
+	if lemp.has_sync {
+		lemp.tablesize += lemp.nterminal
+		for i = 0; i < lemp.nterminal; i++ {
+			p := lemp.symbols[i]
+			fmt.Fprintf(out, "\t%v,  /* %10s */\n", p.sync, p.name)
+			lineno++
+		}
+	}
+	tplt_xfer(lemp.name, in, out, &lineno)
+
 	/* Generate a table containing the symbolic name of every symbol
 	 */
 	for i = 0; i < lemp.nsymbol; i++ {
@@ -4505,19 +5560,18 @@ func ReportTable(lemp *lemon,
 	 ** (In other words, generate the %destructor actions)
 	 */
 	if lemp.tokendest != "" {
-		once := true
+		var cases []*symbol
 		for i := 0; i < lemp.nsymbol; i++ {
 			sp := lemp.symbols[i]
 			if sp == nil || sp.typ != TERMINAL {
 				continue
 			}
-			if once {
-				fmt.Fprintf(out, "      /* TERMINAL Destructor */\n")
-				lineno++
-				once = false
-			}
-			fmt.Fprintf(out, "    case %d: /* %s */\n", sp.index, sp.name)
+			cases = append(cases, sp)
+		}
+		if len(cases) > 0 {
+			fmt.Fprintf(out, "      /* TERMINAL Destructor */\n")
 			lineno++
+			emit_destructor_cases(out, cases, &lineno)
 		}
 		for i = 0; i < lemp.nsymbol && lemp.symbols[i].typ != TERMINAL; i++ {
 		}
@@ -4528,25 +5582,20 @@ func ReportTable(lemp *lemon,
 		}
 	}
 	if lemp.vardest != "" {
-		var dflt_sp *symbol
-		once := true
+		var cases []*symbol
 		for i := 0; i < lemp.nsymbol; i++ {
 			sp := lemp.symbols[i]
 			if sp == nil || sp.typ == TERMINAL ||
 				sp.index <= 0 || sp.destructor != "" {
 				continue
 			}
-			if once {
-				fmt.Fprintf(out, "      /* Default NON-TERMINAL Destructor */\n")
-				lineno++
-				once = false
-			}
-			fmt.Fprintf(out, "    case %d: /* %s */\n", sp.index, sp.name)
-			lineno++
-			dflt_sp = sp
+			cases = append(cases, sp)
 		}
-		if dflt_sp != nil {
-			emit_destructor_code(out, dflt_sp, lemp, &lineno)
+		if len(cases) > 0 {
+			fmt.Fprintf(out, "      /* Default NON-TERMINAL Destructor */\n")
+			lineno++
+			emit_destructor_cases(out, cases, &lineno)
+			emit_destructor_code(out, cases[len(cases)-1], lemp, &lineno)
 		}
 		fmt.Fprintf(out, "      break\n")
 		lineno++
@@ -4559,21 +5608,18 @@ func ReportTable(lemp *lemon,
 		if sp.destLineno < 0 {
 			continue /* Already emitted */
 		}
-		fmt.Fprintf(out, "    case %d: /* %s */\n", sp.index, sp.name)
-		lineno++
-
 		/* Combine duplicate destructors into a single case */
+		cases := []*symbol{sp}
 		for j := i + 1; j < lemp.nsymbol; j++ {
 			sp2 := lemp.symbols[j]
 			if sp2 != nil && sp2.typ != TERMINAL && sp2.destructor != "" &&
 				sp2.dtnum == sp.dtnum &&
 				sp.destructor == sp2.destructor {
-				fmt.Fprintf(out, "    case %d: /* %s */\n",
-					sp2.index, sp2.name)
-				lineno++
+				cases = append(cases, sp2)
 				sp2.destLineno = -1 /* Avoid emitting this destructor again */
 			}
 		}
+		emit_destructor_cases(out, cases, &lineno)
 
 		emit_destructor_code(out, lemp.symbols[i], lemp, &lineno)
 		fmt.Fprintf(out, "      break\n")
@@ -4683,12 +5729,57 @@ func ReportTable(lemp *lemon,
 	/* Append any addition code the user desires */
 	tplt_print(out, lemp, lemp.extracode, &lineno)
 
+	/* Append ParseAll, in -pull mode or for what needs it */
+	if lemp.pull {
+		tplt_xfer(lemp.name, in, out, &lineno)
+	} else {
+		tplt_skip(in)
+	}
+
+	/* Append the lexer, if the grammar has patterns for its tokens */
+	if len(lemp.patterns) > 0 {
+		lexer_output(out, lemp, &lineno)
+	}
+
+	/* Append the types of labelled rules */
+	if len(lemp.astdecls) > 0 {
+		ast_output(out, lemp, &lineno)
+	}
+
+	/* Append the syntax tree types, in -cst mode */
+	if lemp.cst {
+		cst_output(out, lemp, &lineno)
+	}
+
+	/* Append ParseRecover, in -recover mode or for %sync */
+	if lemp.recover {
+		tplt_xfer(lemp.name, in, out, &lineno)
+	} else {
+		tplt_skip(in)
+	}
+
+	/* Append ParseIncremental, in -incremental mode */
+	if lemp.incremental {
+		tplt_xfer(lemp.name, in, out, &lineno)
+	} else {
+		tplt_skip(in)
+	}
+
 	// acttab_free(pActtab)
 	inFile.Close()
 	out.Close()
 	if sql != nil {
 		sql.Close()
 	}
+	/* Type-check the parser before gofmt splits the lines of the actions,
+	 ** which would move the errors in them off their lines in the grammar */
+	if lemp.typecheck {
+		typecheck_output(lemp, out.Name(), outname)
+	}
+	format_output(lemp, out.Name(), outname)
+	if lemp.fuzz && lemp.errorcnt == 0 {
+		fuzz_output(lemp, out.Name(), outname, generated_header(lemp, "// ", inFile.Name(), input))
+	}
 }
 
 /* Reduce the size of the action tables, if possible, by making use
@@ -5386,7 +6477,7 @@ func assert(condition bool, debug string) {
 		} else {
 			fmt.Fprintf(os.Stderr, "assert failed: %s\n", debug)
 		}
-		os.Exit(1)
+		lemon_exit(1)
 	}
 }
 
@@ -5399,19 +6490,34 @@ func firstRuneIsUpper(s string) bool {
 
 /// For working with -D repeated commandline option.
 
-type setFlag map[string]bool
+type setFlag map[string]string
 
 func (s setFlag) String() string {
 	var keys []string
-	for k := range s {
-		keys = append(keys, k)
+	for k, v := range s {
+		keys = append(keys, k+"="+v)
 	}
 	sort.Strings(keys)
 	return "{" + strings.Join(keys, ",") + "}"
 }
 
 func (s setFlag) Set(value string) error {
-	s[value] = true
+	if i := strings.Index(value, "="); i >= 0 {
+		s[value[:i]] = value[i+1:]
+	} else {
+		s[value] = "1"
+	}
+	return nil
+}
+
+type pathFlag []string
+
+func (p *pathFlag) String() string {
+	return strings.Join(*p, string(filepath.ListSeparator))
+}
+
+func (p *pathFlag) Set(value string) error {
+	*p = append(*p, filepath.SplitList(value)...)
 	return nil
 }
 
@@ -5423,6 +6529,11 @@ func (s unsetFlag) String() string {
 	return "[unset flag wrapper]"
 }
 
+func (s unsetFlag) Set(value string) error {
+	delete(s.sf, value)
+	return nil
+}
+
 func Exists(name string) (bool, error) {
 	_, err := os.Stat(name)
 	if err == nil {
@@ -5676,7 +6787,7 @@ type defines struct {
 }
 
 // replaceAll replaces all known defines in a string with their mappings.
-func (d defines) replaceAll(s string) string {
+func (d *defines) replaceAll(s string) string {
 	if len(d.mappings) == 0 {
 		return s
 	}
@@ -5693,7 +6804,7 @@ func (d defines) replaceAll(s string) string {
 	return strings.Join(lines, "\n")
 }
 
-func (d defines) replaceFunc(match string) string {
+func (d *defines) replaceFunc(match string) string {
 	return d.mappings[match]
 }
 
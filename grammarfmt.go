@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+** The "fmt" subcommand, which reprints grammar files in a canonical
+** layout:
+**
+**     golemon fmt [-w] [-l] [-d] [FILE ...]
+**
+** The grammar is broken into tokens by next_token(), the tokenizer used
+** by scan_input(), and each declaration and rule is reprinted:
+**
+**   *  Tokens are separated by single spaces.  There is no space inside
+**      an alias, a precedence mark, a label or the arguments of a macro,
+**      as in "expr(A)", "[PLUS]", "<BinaryExpr>" and "seplist(COMMA,
+**      expr)", while a group is written "( A B )".  "A/B" is written "A|B".
+**   *  The "::=" of consecutive rules is aligned.  A blank line or a
+**      declaration ends a run of rules; a comment does not.
+**   *  Line breaks stay where they are, except that a code block always
+**      starts on the line of its rule or declaration.  Continuation lines
+**      are indented by two spaces, and a run of blank lines becomes one.
+**   *  Comments are kept, and so are %if, %ifdef, %ifndef, %elif, %else,
+**      %endif and %define lines, which start in column one.
+**   *  Rule actions, %include, %code, the destructors, the %copy code,
+**      %syntax_error, %parse_accept, %parse_failure and %stack_overflow
+**      are formatted with go/format if they parse as Go.  Other code
+**      blocks, such as %type and %extra_argument, and blocks that do not
+**      parse are passed through verbatim.
+**
+** Formatting a formatted grammar leaves it unchanged.
+ */
+
+/* The kind of token of a preprocessor line, besides the TK_* kinds */
+const TK_PP = -1
+
+/* Ways of printing a code block */
+const (
+	FMT_VERBATIM = iota /* As written */
+	FMT_STMTS           /* As a list of Go statements, indented by a tab */
+	FMT_DECLS           /* As a list of Go declarations, not indented */
+)
+
+/* One token of a grammar being formatted */
+type fmttoken struct {
+	kind   int    /* TK_* */
+	text   string /* Text of the token, as it is to be printed */
+	nl     int    /* Number of newlines in the white space before it */
+	space  bool   /* True if there is white space before it */
+	lineno int    /* Line on which the token starts */
+	offset int    /* Offset of the token in the text, in runes */
+	tight  bool   /* For "(" and ")", no space inside the parentheses */
+}
+
+/* A declaration, rule, comment or preprocessor line being formatted */
+type fmtstmt struct {
+	toks  []fmttoken
+	arrow int /* Index of "::=" if the rule can be aligned, otherwise -1 */
+	width int /* Width of the text before the "::=" */
+	pad   int /* Number of spaces to print before the "::=" */
+}
+
+/* Declarations whose code block is formatted, and how */
+var fmtBlockModes = map[string]int{
+	"include":            FMT_DECLS,
+	"code":               FMT_DECLS,
+	"destructor":         FMT_STMTS,
+	"token_destructor":   FMT_STMTS,
+	"default_destructor": FMT_STMTS,
+	"copy":               FMT_STMTS,
+	"token_copy":         FMT_STMTS,
+	"default_copy":       FMT_STMTS,
+	"syntax_error":       FMT_STMTS,
+	"parse_accept":       FMT_STMTS,
+	"parse_failure":      FMT_STMTS,
+	"stack_overflow":     FMT_STMTS,
+}
+
+/* Break the text of a grammar into tokens.  Return false if a string or
+** code block is not terminated. */
+func fmt_tokenize(filename string, src []rune) ([]fmttoken, bool) {
+	var toks []fmttoken
+	lineno, nl, space := 1, 0, false
+	for cp := 0; cp < len(src); {
+		if cp == 0 || src[cp-1] == '\n' {
+			eol := cp
+			for eol < len(src) && src[eol] != '\n' {
+				eol++
+			}
+			if word, arg := pp_directive(string(src[cp:eol])); word != "" {
+				text := "%" + word
+				if arg != "" {
+					text += " " + arg
+				}
+				toks = append(toks, fmttoken{kind: TK_PP, text: text, nl: nl, space: space, lineno: lineno, offset: cp})
+				nl, space = 0, false
+				cp = eol
+				continue
+			}
+		}
+		kind, end, next := next_token(src, cp)
+		text := string(src[cp:next])
+		switch {
+		case kind == TK_SPACE:
+			nl += strings.Count(text, "\n")
+			space = true
+		case kind == TK_STRING && end == len(src):
+			ErrorMsg(filename, lineno, "String starting on this line is not terminated before the end of the file.")
+			return nil, false
+		case kind == TK_CODE && end == len(src):
+			ErrorMsg(filename, lineno, "C code starting on this line is not terminated before the end of the file.")
+			return nil, false
+		default:
+			if kind == TK_MULTI {
+				text = "|" + text[1:]
+			} else if kind == TK_COMMENT {
+				text = strings.TrimRight(text, " \t\r")
+			}
+			toks = append(toks, fmttoken{kind: kind, text: text, nl: nl, space: space, lineno: lineno, offset: cp})
+			nl, space = 0, false
+		}
+		lineno += strings.Count(text, "\n")
+		cp = next
+	}
+	return toks, true
+}
+
+/* Return the index just past the end of the declaration or rule that
+** starts at toks[i].  Comments and preprocessor lines within it are part
+** of it. */
+func fmt_statement_end(toks []fmttoken, i int) int {
+	next := func(j int) int {
+		for j < len(toks) && (toks[j].kind == TK_COMMENT || toks[j].kind == TK_PP) {
+			j++
+		}
+		return j
+	}
+	is := func(j int, kind int, text string) bool {
+		return j < len(toks) && toks[j].kind == kind && (text == "" || toks[j].text == text)
+	}
+	closing := func(j int, open string, close string) int {
+		depth := 0
+		for ; j < len(toks); j++ {
+			if is(j, TK_OP, open) {
+				depth++
+			} else if is(j, TK_OP, close) {
+				if depth--; depth == 0 {
+					return j
+				}
+			}
+		}
+		return len(toks) - 1
+	}
+
+	if is(i, TK_OP, "%") && is(i+1, TK_ID, "") && !toks[i+1].space {
+		j := i + 2
+		nargs := 1
+		switch toks[i+1].text {
+		case "type", "destructor", "copy", "token_pattern":
+			nargs = 2
+		case "left", "right", "nonassoc", "token", "fallback", "wildcard", "sync", "token_class":
+			for j = next(j); j < len(toks) && !is(j, TK_OP, "."); j = next(j + 1) {
+				if is(j, TK_OP, "%") {
+					return j
+				}
+			}
+			if j < len(toks) {
+				j++
+			}
+			return j
+		case "macro":
+			if k := next(j); is(k, TK_ID, "") {
+				j = k + 1
+				if k = next(j); is(k, TK_OP, "(") {
+					j = closing(k, "(", ")") + 1
+				}
+			}
+			return j
+		}
+		for ; nargs > 0; nargs-- {
+			k := next(j)
+			if !is(k, TK_ID, "") && !is(k, TK_STRING, "") && !is(k, TK_CODE, "") {
+				break
+			}
+			j = k + 1
+		}
+		return j
+	}
+
+	if !is(i, TK_ID, "") {
+		return i + 1
+	}
+	j := next(i + 1)
+	if is(j, TK_OP, "(") {
+		j = next(closing(j, "(", ")") + 1)
+	}
+	if !is(j, TK_ARROW, "") {
+		return i + 1
+	}
+	depth := 0
+	for j = next(j + 1); j < len(toks); j = next(j + 1) {
+		if is(j, TK_OP, "(") {
+			depth++
+		} else if is(j, TK_OP, ")") {
+			depth--
+		} else if is(j, TK_OP, ".") && depth <= 0 {
+			break
+		}
+	}
+	if j == len(toks) {
+		return j
+	}
+	j++
+	for {
+		if k := next(j); is(k, TK_OP, "[") {
+			j = closing(k, "[", "]") + 1
+		} else if is(k, TK_OP, "<") {
+			j = closing(k, "<", ">") + 1
+		} else {
+			break
+		}
+	}
+	if k := next(j); is(k, TK_CODE, "") {
+		j = k + 1
+	}
+	return j
+}
+
+/* Return the formatted text of a list of Go statements or declarations,
+** without indentation, or false if it does not parse. */
+func fmt_code(code string) (string, bool) {
+	if strings.Contains(code, "`") {
+		return "", false /* Indenting would change raw strings */
+	}
+	out, err := format.Source([]byte(code))
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(strings.TrimRight(string(out), " \t\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	prefix := ""
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if i == 0 {
+			prefix = indent
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = line[len(prefix):]
+		}
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+/* Return the text of a code block, including its braces, printed as mode
+** says.  A block written on one line stays on one line if it can. */
+func fmt_block(text string, mode int) string {
+	if mode == FMT_VERBATIM {
+		return text
+	}
+	code := text[1 : len(text)-1]
+	if strings.TrimSpace(code) == "" {
+		return "{}"
+	}
+	body, ok := fmt_code(code)
+	if !ok {
+		return text
+	}
+	if !strings.Contains(code, "\n") && !strings.Contains(body, "\n") {
+		return "{ " + body + " }"
+	}
+	if mode == FMT_STMTS {
+		lines := strings.Split(body, "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = "\t" + line
+			}
+		}
+		body = strings.Join(lines, "\n")
+	}
+	return "{\n" + body + "\n}"
+}
+
+/* Prepare the tokens of one declaration, rule, comment or preprocessor
+** line for printing */
+func fmt_statement(toks []fmttoken) *fmtstmt {
+	st := &fmtstmt{toks: toks, arrow: -1}
+	prevsig := func(j int) int {
+		for j--; j >= 0 && toks[j].kind == TK_COMMENT; j-- {
+		}
+		return j
+	}
+
+	/* Decide which parentheses are written without spaces inside.  That
+	** is an alias, or the arguments of a macro if they were written
+	** against its name. */
+	var open []int
+	for k, t := range toks {
+		if t.kind == TK_OP && t.text == "(" {
+			open = append(open, k)
+		} else if t.kind == TK_OP && t.text == ")" && len(open) > 0 {
+			o := open[len(open)-1]
+			open = open[:len(open)-1]
+			var prev *fmttoken
+			if p := prevsig(o); p >= 0 {
+				prev = &toks[p]
+			}
+			var inside []fmttoken
+			for _, u := range toks[o+1 : k] {
+				if u.kind != TK_COMMENT {
+					inside = append(inside, u)
+				}
+			}
+			tight := false
+			if prev != nil && (prev.kind == TK_ID || prev.kind == TK_MULTI || (prev.kind == TK_OP && strings.Contains(")?*+", prev.text))) {
+				tight = len(inside) == 1 && inside[0].kind == TK_ID
+			}
+			if prev != nil && (prev.kind == TK_ID || (prev.kind == TK_OP && prev.text == ")")) && !toks[o].space {
+				tight = true
+			}
+			toks[o].tight, toks[k].tight = tight, tight
+		}
+	}
+
+	/* Format the code blocks */
+	mode := FMT_VERBATIM
+	if len(toks) > 1 && toks[0].kind == TK_OP && toks[0].text == "%" && toks[1].kind == TK_ID {
+		mode = fmtBlockModes[toks[1].text]
+	} else if toks[0].kind == TK_ID {
+		mode = FMT_STMTS
+	}
+	for k := range toks {
+		if toks[k].kind == TK_CODE {
+			toks[k].text = fmt_block(toks[k].text, mode)
+		}
+	}
+
+	/* A rule can be aligned with its neighbours if its left-hand side and
+	** "::=" are on one line */
+	if toks[0].kind == TK_ID {
+		for k := 1; k < len(toks) && toks[k].nl == 0 && toks[k].kind != TK_COMMENT && toks[k].kind != TK_PP; k++ {
+			if toks[k].kind == TK_ARROW {
+				var b strings.Builder
+				fmt_print(&b, toks[:k], 0)
+				st.arrow = k
+				st.width = utf8.RuneCountInString(b.String())
+				break
+			}
+		}
+	}
+	return st
+}
+
+/* Return the space to print between the tokens prev and t */
+func fmt_space(prev *fmttoken, t *fmttoken) string {
+	switch {
+	case t.kind == TK_CODE || t.kind == TK_COMMENT || prev.kind == TK_COMMENT:
+		return " "
+	case t.kind == TK_OP && (t.text == "(" || t.text == ")"):
+		if t.tight {
+			return ""
+		}
+	case prev.kind == TK_OP && prev.text == "(":
+		if prev.tight {
+			return ""
+		}
+	case t.kind == TK_OP && t.text == ".":
+		if prev.kind != TK_ARROW {
+			return ""
+		}
+	case t.kind == TK_OP && strings.Contains("?*+,]>", t.text):
+		return ""
+	case prev.kind == TK_OP && (prev.text == "[" || prev.text == "<"):
+		return ""
+	case t.kind == TK_MULTI:
+		return ""
+	}
+	return " "
+}
+
+/* Print the tokens of a statement.  If pad is not zero, print that many
+** spaces before the "::=" of a rule. */
+func fmt_print(b *strings.Builder, toks []fmttoken, pad int) {
+	for k := range toks {
+		t := &toks[k]
+		if k > 0 {
+			prev := &toks[k-1]
+			afterLine := prev.kind == TK_PP || (prev.kind == TK_COMMENT && strings.HasPrefix(prev.text, "//"))
+			switch {
+			case t.kind == TK_PP || afterLine || (t.nl > 0 && t.kind != TK_CODE):
+				b.WriteString("\n")
+				if t.nl > 1 {
+					b.WriteString("\n")
+				}
+				if t.kind != TK_PP {
+					b.WriteString("  ")
+				}
+			case k == 1 && toks[0].kind == TK_OP && toks[0].text == "%":
+				/* The keyword of a declaration */
+			case t.kind == TK_ARROW && pad > 0:
+				b.WriteString(strings.Repeat(" ", pad))
+			default:
+				b.WriteString(fmt_space(prev, t))
+			}
+		}
+		b.WriteString(t.text)
+	}
+}
+
+/* Align the "::=" of each run of consecutive rules */
+func fmt_align(stmts []*fmtstmt) {
+	var run []*fmtstmt
+	flush := func() {
+		width := 0
+		for _, st := range run {
+			if st.width > width {
+				width = st.width
+			}
+		}
+		for _, st := range run {
+			st.pad = width - st.width + 1
+		}
+		run = nil
+	}
+	for k, st := range stmts {
+		first := st.toks[0]
+		if first.nl > 1 {
+			flush()
+		}
+		switch {
+		case st.arrow >= 0 && (first.nl > 0 || k == 0):
+			run = append(run, st)
+		case first.kind == TK_COMMENT && (first.nl > 0 || k == 0):
+			/* A comment on a line of its own does not end the run */
+		default:
+			flush()
+		}
+	}
+	flush()
+}
+
+/* Return the text of the grammar src, called filename, in canonical form.
+** Return false, having reported an error, if it can't be tokenized. */
+func format_grammar(filename string, src []byte) ([]byte, bool) {
+	toks, ok := fmt_tokenize(filename, []rune(string(src)))
+	if !ok {
+		return nil, false
+	}
+	var stmts []*fmtstmt
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		if t.kind == TK_COMMENT && t.nl == 0 && len(stmts) > 0 {
+			/* A comment at the end of a line belongs to the line */
+			last := stmts[len(stmts)-1]
+			last.toks = append(last.toks, t)
+			i++
+			continue
+		}
+		end := i + 1
+		if t.kind != TK_COMMENT && t.kind != TK_PP {
+			end = fmt_statement_end(toks, i)
+		}
+		stmts = append(stmts, fmt_statement(toks[i:end:end]))
+		i = end
+	}
+	fmt_align(stmts)
+
+	var b strings.Builder
+	for k, st := range stmts {
+		if k > 0 {
+			first := st.toks[0]
+			prev := stmts[k-1].toks[len(stmts[k-1].toks)-1]
+			if first.nl == 0 && prev.kind != TK_PP && !(prev.kind == TK_COMMENT && strings.HasPrefix(prev.text, "//")) {
+				b.WriteString(" ")
+			} else if first.nl > 1 {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString("\n")
+			}
+		}
+		pad := 0
+		if st.arrow >= 0 {
+			pad = st.pad
+		}
+		fmt_print(&b, st.toks, pad)
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), true
+}
+
+/* Run "golemon fmt" with the given arguments.  Return the exit status. */
+func fmt_command(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "Write the result back to each file instead of to standard output.")
+	list := fs.Bool("l", false, "List the files whose formatting differs.")
+	diff := fs.Bool("d", false, "Print a diff of the changes instead of the formatted grammar.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s fmt [-w] [-l] [-d] [FILE ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	status := 0
+	for _, name := range names {
+		var src []byte
+		var err error
+		filename := name
+		if name == "-" {
+			if *write {
+				fmt.Fprintf(os.Stderr, "Can't use -w with standard input.\n")
+				status = 1
+				continue
+			}
+			filename = "<stdin>"
+			src, err = io.ReadAll(os.Stdin)
+		} else {
+			src, err = os.ReadFile(name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't read file \"%s\": %v\n", name, err)
+			status = 1
+			continue
+		}
+		res, ok := format_grammar(filename, src)
+		if !ok {
+			status = 1
+			continue
+		}
+		changed := !bytes.Equal(src, res)
+		if *list && changed {
+			fmt.Println(filename)
+		}
+		if *diff {
+			unified_diff(os.Stdout, "a/"+filepath.ToSlash(filename), "b/"+filepath.ToSlash(filename), string(src), string(res))
+		}
+		if *write && changed {
+			perm := os.FileMode(0644)
+			if info, err := os.Stat(name); err == nil {
+				perm = info.Mode().Perm()
+			}
+			if err := os.WriteFile(name, res, perm); err != nil {
+				fmt.Fprintf(os.Stderr, "Can't write file \"%s\": %v\n", name, err)
+				status = 1
+			}
+		}
+		if !*write && !*list && !*diff {
+			os.Stdout.Write(res)
+		}
+	}
+	return status
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+** Splitting a grammar across several files.
+**
+**     %include_file "expr.y"
+**     %import "tokens.y"
+**
+** Both read the named file at that point, as though its declarations
+** and rules appeared there.  %import does nothing if the file has
+** already been read, so a file of shared declarations can be imported by
+** every file that needs it.  %include_file always reads the file.  A
+** relative name is looked for first in the directory of the file that
+** names it, and then in each directory given with -I.
+**
+** Each file is run through the %ifdef preprocessor separately and must
+** hold only complete declarations and rules.  Diagnostics and //line
+** directives name the file in which the text appears.  A file that
+** includes itself, directly or indirectly, is an error.
+ */
+
+/* The name under which a file is remembered in psp.includes and
+** psp.imported, so that different paths to one file compare equal */
+func include_key(name string) string {
+	if p, err := filepath.EvalSymlinks(name); err == nil {
+		name = p
+	}
+	if p, err := filepath.Abs(name); err == nil {
+		name = p
+	}
+	return name
+}
+
+/* Note that the file called name is being read */
+func include_push(psp *pstate, name string) {
+	key := include_key(name)
+	psp.includes = append(psp.includes, key)
+	if psp.imported == nil {
+		psp.imported = make(map[string]bool)
+	}
+	if !psp.imported[key] {
+		psp.gp.files = append(psp.gp.files, name)
+	}
+	psp.imported[key] = true
+}
+
+/* Note that the innermost file has been read */
+func include_pop(psp *pstate) {
+	psp.includes = psp.includes[:len(psp.includes)-1]
+}
+
+/* Find the file called name, named in psp.filename.  Return its path,
+** or "" if it cannot be found. */
+func include_find(psp *pstate, name string) string {
+	if filepath.IsAbs(name) {
+		if ok, _ := Exists(name); ok {
+			return name
+		}
+		return ""
+	}
+	dirs := append([]string{filepath.Dir(psp.filename)}, includePath...)
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if ok, _ := Exists(path); ok {
+			return path
+		}
+	}
+	return ""
+}
+
+/* Handle "%include_file NAME" or, if once is true, "%import NAME" */
+func include_grammar(psp *pstate, name string, once bool) {
+	psp.state = WAITING_FOR_DECL_OR_RULE
+	path := include_find(psp, name)
+	if path == "" {
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"Can't find \"%s\" in the directory of %s or the -I path.", name, psp.filename)
+		psp.errorcnt++
+		return
+	}
+	key := include_key(path)
+	for i, f := range psp.includes {
+		if f == key {
+			chain := append(append([]string{}, psp.includes[i:]...), key)
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Cycle in %%%s: %s", psp.declkeyword, strings.Join(chain, " -> "))
+			psp.errorcnt++
+			return
+		}
+	}
+	if once && psp.imported[key] {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "Can't read file: %v", err)
+		psp.errorcnt++
+		return
+	}
+	filebuf := []rune(string(data))
+	filebuf, defs := preprocess_input(path, filebuf)
+	io.WriteString(psp.gp.inputHash, string(filebuf))
+
+	filename, lineno := psp.filename, psp.tokenlineno
+	psp.filename = path
+	psp.prevrule = nil
+	include_push(psp, path)
+	scan_input(psp, filebuf, defs)
+	include_pop(psp)
+	macro_record_finish(psp)
+	switch psp.state {
+	case WAITING_FOR_DECL_OR_RULE, RESYNC_AFTER_DECL_ERROR, RESYNC_AFTER_RULE_ERROR:
+	default:
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"Incomplete declaration or rule at the end of the file.")
+		psp.errorcnt++
+	}
+	psp.filename, psp.tokenlineno = filename, lineno
+	psp.prevrule = nil
+	psp.state = WAITING_FOR_DECL_OR_RULE
+}
@@ -19,6 +19,10 @@
 ** of this template is copied straight through into the generate parser
 ** source file.
 **
+** The sections after the last "%%", where the %code of the grammar goes,
+** are drivers that only some parsers have.  Each is copied only if the
+** parser needs it, and skipped otherwise.
+**
 ** The following is the concatenation of all %include directives from the
 ** input grammar file:
  */
@@ -26,6 +30,7 @@
 package main
 
 import (
+	ParsePULL_IMPORT
 	"fmt"
 	"io"
 	"os"
@@ -70,14 +75,28 @@ import (
 **                       This is typically a union of many types, one of
 **                       which is ParseTOKENTYPE.  The entry in the union
 **                       for terminal symbols is called "yy0".
-**    YYSTACKDEPTH       is the maximum depth of the parser's stack.  If
-**                       zero the stack is dynamically sized using realloc()
+**    ParseRESULTTYPE    is the data type of the value of the start symbol,
+**                       which ParseAll() returns, with "golemon -pull"
+**    YYSTACKDEPTH       is the maximum depth of the parser's stack.
+**    YYGROWABLESTACK    is true if instead the stack grows as needed, as
+**                       it does with "%stack_size 0"
+**    YYFUZZ             is true if the parser was made with "golemon -fuzz",
+**                       so that the values on its stack can be followed
+**    YYINCREMENTAL      is true if the parser was made with "golemon
+**                       -incremental", so that it keeps the steps that
+**                       ParseIncremental needs
 **    ParseARG_SDECL     A static variable declaration for the %extra_argument
 **    ParseARG_PDECL     A parameter declaration for the %extra_argument
 **    ParseARG_PARAM     Code to pass %extra_argument as a subroutine parameter
 **    ParseARG_STORE     Code to store %extra_argument into yypParser
 **    ParseARG_FETCH     Code to extract %extra_argument from yypParser
 **    ParseCTX_*         As ParseARG_ except for %extra_context
+**    ParseRECOVER_*     The state of ParseRecover() in the parser, and
+**                       the code to set it up, copy it and finalize it,
+**                       or nothing without "golemon -recover"
+**    ParsePULL_*        The import of ParseAll(), the location of each
+**                       token on the stack and the code to keep it, or
+**                       nothing without "golemon -pull"
 **    YYERRORSYMBOL      is the code number of the error symbol.  If not
 **                       defined, then do no error processing.
 **    YYNSTATE           the combined number of states.
@@ -178,6 +197,19 @@ var yyFallback = []YYCODETYPE{
 %%
 }
 
+/* The next table marks the tokens declared with
+**
+**      %sync SEMI RBRACE.
+**
+** After a syntax error, a parser with the Sync strategy of
+** ParseRecovery discards tokens up to the next of these, then pops its
+** stack to a state that can take it.
+ */
+var yySyncToken = []bool{
+	//
+%%
+}
+
 /* The following structure represents a single element of the
 ** parser's stack.  Information stored includes:
 **
@@ -200,6 +232,7 @@ type yyStackEntry struct {
 	 ** number for the token at this stack level */
 	minor YYMINORTYPE /* The user-supplied minor token value.  This
 	 ** is the value of the token  */
+	ParsePULL_EDECL/* Where the symbol starts in the input */
 }
 
 /* The state of the parser is completely contained in an instance of
@@ -212,11 +245,66 @@ type yyParser struct {
 	// #ifndef YYNOERRORRECOVERY
 	yyerrcnt int /* Shifts left before out of the error */
 	// #endif
+	yystatus  int /* One of the YYSTATUS_ values below */
+	yynsyntax int /* Number of syntax errors reported */
+	ParsePULL_SDECL/* The location of the token given to Parse() */
+	yylimits  ParseLimits   /* Limits on the work of the parser */
+	yyntoken  int           /* Tokens given to Parse() since ParseInit() */
+	yynreduce int           /* Reductions since ParseInit() */
+	yynrecover int          /* Error recoveries since ParseInit() */
+	yylimiterr *ParseLimitError /* The limit exceeded, if any */
+	yyerr      error            /* Why Parse() did not take its last token, or nil */
+	yyreducing int          /* One more than the rule being reduced, or 0 */
+	ParseRECOVER_SDECL/* The state of ParseRecover() */
+	// #ifdef YYINCREMENTAL
+	yylow int /* The lowest entry of the stack changed or popped since it
+	 ** was last set, for ParseIncremental */
+	// #endif
+	// #ifdef YYFUZZ
+	yyvaluehook func(yypParser *yyParser, event int, index int, value *YYMINORTYPE) /* Follows
+	 ** the values on the stack, for the fuzz test */
+	// #endif
 	ParseARG_SDECL/* A place to hold %extra_argument */
 	ParseCTX_SDECL/* A place to hold %extra_context */
 	yystack []yyStackEntry
 }
 
+/* Values of yyParser.yystatus */
+const (
+	YYSTATUS_PARSING  = iota /* No accept or failure since ParseInit() */
+	YYSTATUS_ACCEPTED        /* The input was accepted */
+	YYSTATUS_FAILED          /* The %parse_failure code has run */
+	YYSTATUS_OVERFLOW        /* The %stack_overflow code has run */
+	YYSTATUS_LIMIT           /* A limit of ParseSetLimits() was exceeded */
+	YYSTATUS_PANICKED        /* A rule's action panicked */
+)
+
+/* Limits on the work a parser does, for input that cannot be trusted.
+** Zero means no limit.  Each limit counts from ParseInit().
+ */
+type ParseLimits struct {
+	MaxDepth      int /* Entries on the stack, which then never grows past it */
+	MaxTokens     int /* Tokens given to Parse(), not counting the end of input */
+	MaxReductions int /* Rules reduced */
+	MaxRecoveries int /* Passes through error recovery, of which there are
+	 ** one or more for each token that is a syntax error */
+}
+
+/* The error that ends a parse when a limit of ParseLimits is exceeded.
+** Limit is "stack entries", "tokens", "reductions" or "error
+** recoveries", for the field of ParseLimits that was exceeded, and Max is
+** that field's value.
+ */
+type ParseLimitError struct {
+	Token YYCODETYPE /* The token being parsed, or 0 for the end of input */
+	Limit string     /* Which limit was exceeded */
+	Max   int        /* The value of the limit */
+}
+
+func (e *ParseLimitError) Error() string {
+	return fmt.Sprintf("parse limit exceeded: more than %d %s", e.Max, e.Limit)
+}
+
 var yyTraceFILE *os.File
 var yyTracePrompt string
 
@@ -247,6 +335,26 @@ func ParseTrace(TraceFILE *os.File, zTracePrompt string) {
 	}
 }
 
+/* In a parser made by "golemon -fuzz", the values on the stack can be
+** followed by setting the yyvaluehook field of a parser, as the fuzz test
+** does to check that each value is destroyed, or passed to a rule's
+** action, exactly once.  The hook is called:
+**
+**   +  With YYVALUE_PUSH and the stack index, when a value is pushed.
+**
+**   +  With YYVALUE_RELEASE and the rule number, when a reduce by that
+**      rule takes the values of its right-hand side off the top of the
+**      stack, after the rule's action has run.
+**
+**   +  With YYVALUE_DESTROY and a pointer to the value, when the value
+**      is passed to yy_destructor().
+ */
+const (
+	YYVALUE_PUSH = iota
+	YYVALUE_RELEASE
+	YYVALUE_DESTROY
+)
+
 /* For tracing shifts, the names of all terminals and nonterminals
 ** are required.  The following table supplies these names */
 var yyTokenName = []string{
@@ -290,16 +398,58 @@ func (p *yyParser) yyGrowStack(){
 /* Initialize a new parser that has already been allocated.
  */
 func (yypParser *yyParser) ParseInit(ParseCTX_PDECL) {
+	if yypParser.yyreducing > 0 {
+		yypParser.yy_action_panicked()
+	}
 	ParseCTX_STORE
 	if !YYNOERRORRECOVERY {
 		yypParser.yyerrcnt = -1
 	}
-	if YYSTACKDEPTH > 0 {
+	if !YYGROWABLESTACK {
 		yypParser.yystack = make([]yyStackEntry, YYSTACKDEPTH)
 	} else {
 		yypParser.yystack = []yyStackEntry{{}}
 	}
 	yypParser.yytos = 0
+	yypParser.yystatus = YYSTATUS_PARSING
+	yypParser.yynsyntax = 0
+	yypParser.yyntoken = 0
+	yypParser.yynreduce = 0
+	yypParser.yynrecover = 0
+	yypParser.yylimiterr = nil
+	yypParser.yyerr = nil
+	ParseRECOVER_INIT
+}
+
+/* Set limits on the work of the parser.  When one is exceeded, the
+** parser destroys the values on its stack, without running the
+** %stack_overflow or %parse_failure code, and ignores the tokens given
+** to it until ParseInit() is called again.  ParseLimitErr() then says
+** which limit it was.
+ */
+func (yypParser *yyParser) ParseSetLimits(limits ParseLimits) {
+	yypParser.yylimits = limits
+}
+
+/* Return the *ParseLimitError for the limit that ended the parse, or nil
+** if none has.
+ */
+func (yypParser *yyParser) ParseLimitErr() error {
+	if yypParser.yylimiterr == nil {
+		return nil
+	}
+	return yypParser.yylimiterr
+}
+
+/* Return the error for the last token given to Parse(), if the parser
+** did not take it: because the token is not a terminal, because the
+** parser was not set up by ParseAlloc() or ParseInit(), or because it
+** has accepted its input, exceeded a limit of ParseSetLimits() or seen a
+** rule's action panic since ParseInit().  A syntax error is not such an
+** error, but handled by error recovery.
+ */
+func (yypParser *yyParser) ParseErr() error {
+	return yypParser.yyerr
 }
 
 /*
@@ -334,6 +484,9 @@ func (yypParser *yyParser) yy_destructor(
 ) {
 	ParseARG_FETCH
 	ParseCTX_FETCH
+	if YYFUZZ && yypParser.yyvaluehook != nil {
+		yypParser.yyvaluehook(yypParser, YYVALUE_DESTROY, 0, yypminor)
+	}
 	switch yymajor {
 	/* Here is inserted the actions which take place when a
 	 ** terminal or non-terminal is destroyed.  This can happen
@@ -361,7 +514,10 @@ func (yypParser *yyParser) yy_destructor(
  */
 func (pParser *yyParser) yy_pop_parser_stack() {
 	assert(pParser.yytos>0, "pParser.yytos>0")
-	yytos := pParser.yystack[pParser.yytos]
+	yytos := &pParser.yystack[pParser.yytos]
+	if YYINCREMENTAL {
+		pParser.yy_touch(pParser.yytos)
+	}
 	pParser.yytos--
 	if !NDEBUG {
 		if yyTraceFILE != nil {
@@ -373,14 +529,27 @@ func (pParser *yyParser) yy_pop_parser_stack() {
 	pParser.yy_destructor(yytos.major, &yytos.minor)
 }
 
+/*
+** Note that the entry at index yyidx of the stack has been changed or
+** popped, for the steps kept by ParseIncremental.
+ */
+func (pParser *yyParser) yy_touch(yyidx int) {
+	if yyidx < pParser.yylow {
+		pParser.yylow = yyidx
+	}
+}
+
 /*
 ** Clear all secondary memory allocations from the parser
  */
 func (pParser *yyParser) ParseFinalize() {
+	if pParser.yyreducing > 0 {
+		pParser.yy_action_panicked()
+	}
 	/* In-lined version of calling yy_pop_parser_stack() for each
 	** element left in the stack */
-	yytos := pParser.yystack[pParser.yytos];
 	for pParser.yytos>0 {
+		yytos := &pParser.yystack[pParser.yytos];
 		if !NDEBUG {
 			if yyTraceFILE != nil {
 				fmt.Fprintf(yyTraceFILE,"%sPopping %s\n",
@@ -393,6 +562,7 @@ func (pParser *yyParser) ParseFinalize() {
 		}
 		pParser.yytos--;
 	}
+	ParseRECOVER_FINALIZE
 }
 
 /*
@@ -414,6 +584,74 @@ func (pParser *yyParser) ParseStackPeak() int {
 	return pParser.yyhwm
 }
 
+/*
+** Make pParser, which must hold no values, a copy of pFrom.  The stack
+** is copied, and each value on it is given a copy of its own by the
+** %copy code of its symbol, so that the destructors of the two parsers
+** can each destroy their own values.  A value without %copy code is
+** shared by the two.
+ */
+func (pParser *yyParser) yy_copy_from(pFrom *yyParser) {
+	yystack := make([]yyStackEntry, len(pFrom.yystack))
+	copy(yystack, pFrom.yystack)
+	*pParser = *pFrom
+	pParser.yystack = yystack
+	for i := 1; i <= pParser.yytos; i++ {
+		pParser.yy_copy(yystack[i].major, &yystack[i].minor)
+		if YYFUZZ && pParser.yyvaluehook != nil {
+			pParser.yyvaluehook(pParser, YYVALUE_PUSH, i, &yystack[i].minor)
+		}
+	}
+	ParseRECOVER_COPY
+}
+
+/*
+** Return a new parser in the same state as pParser.  Tokens can be given
+** to either without changing the other, so a caller can try a sequence
+** of tokens on the clone and throw it away with ParseFree().
+ */
+func (pParser *yyParser) ParseClone() *yyParser {
+	pNew := &yyParser{}
+	pNew.yy_copy_from(pParser)
+	return pNew
+}
+
+/* The state of a parser, saved by ParseSnapshot() */
+type ParseSnapshot struct {
+	yyparser yyParser
+}
+
+/*
+** Save the state of pParser, to be brought back by ParseRestore() as
+** many times as needed.
+ */
+func (pParser *yyParser) ParseSnapshot() *ParseSnapshot {
+	s := &ParseSnapshot{}
+	s.yyparser.yy_copy_from(pParser)
+	return s
+}
+
+/*
+** Put pParser back in the state saved by ParseSnapshot(), destroying the
+** values now on its stack.  The snapshot is unchanged.
+ */
+func (pParser *yyParser) ParseRestore(s *ParseSnapshot) {
+	yyhwm := pParser.yyhwm
+	pParser.ParseFinalize()
+	pParser.yy_copy_from(&s.yyparser)
+	if yyhwm > pParser.yyhwm {
+		pParser.yyhwm = yyhwm
+	}
+}
+
+/*
+** Destroy the values saved in a snapshot that is no longer needed.  A
+** parser restored from it afterwards has an empty stack.
+ */
+func (s *ParseSnapshot) Free() {
+	s.yyparser.ParseFinalize()
+}
+
 /* This array of booleans keeps track of the parser statement
 ** coverage.  The element yycoverage[X][Y] is set when the parser
 ** is in state X and has a lookahead token Y.  In a well-tested
@@ -432,9 +670,9 @@ var yycoverage = [YYNSTATE][YYNTOKEN]bool{}
 func ParseCoverage(out io.Writer) int {
 	nMissed := 0
 	for stateno := 0; stateno < YYNSTATE; stateno++ {
-		i := yy_shift_ofst[stateno]
+		i := yy_shift_ofst_at(stateno)
 		for iLookAhead := 0; iLookAhead < YYNTOKEN; iLookAhead++ {
-			if yy_lookahead[int(i)+iLookAhead] != YYCODETYPE(iLookAhead) {
+			if yy_lookahead_at(int(i)+iLookAhead) != YYCODETYPE(iLookAhead) {
 				continue
 			}
 			if !yycoverage[stateno][iLookAhead] {
@@ -456,11 +694,13 @@ func ParseCoverage(out io.Writer) int {
 
 /*
 ** Find the appropriate action for a parser given the terminal
-** look-ahead token iLookAhead.
+** look-ahead token iLookAhead.  Unless quiet, the state and token are
+** noted for ParseCoverage(), and a fallback or wildcard is traced.
  */
 func yy_find_shift_action(
 	lookAhead YYCODETYPE, /* The look-ahead token */
 	stateno YYACTIONTYPE, /* Current state number */
+	quiet bool, /* True to leave no trace of the lookup */
 ) YYACTIONTYPE {
 	iLookAhead := int(lookAhead)
 
@@ -468,25 +708,25 @@ func yy_find_shift_action(
 		return stateno
 	}
 	assert(stateno <= YY_SHIFT_COUNT, "stateno <= YY_SHIFT_COUNT")
-	if YYCOVERAGE {
+	if YYCOVERAGE && !quiet {
 		yycoverage[stateno][iLookAhead] = true
 	}
 	for {
-		i := int(yy_shift_ofst[stateno])
+		i := int(yy_shift_ofst_at(int(stateno)))
 		assert(i >= 0, "i>=0")
 		assert(i <= YY_ACTTAB_COUNT, "i<=YY_ACTTAB_COUNT")
-		assert(i+YYNTOKEN <= len(yy_lookahead), "i+YYNTOKEN<=len(yy_lookahead)")
+		assert(i+YYNTOKEN <= YY_NLOOKAHEAD, "i+YYNTOKEN<=YY_NLOOKAHEAD")
 		assert(iLookAhead != YYNOCODE, "iLookAhead!=YYNOCODE")
 		assert(iLookAhead < YYNTOKEN, "iLookAhead < YYNTOKEN")
 		i += iLookAhead
-		assert(i < len(yy_lookahead), "i<len(yy_lookahead)")
-		if int(yy_lookahead[i]) != iLookAhead {
+		assert(i < YY_NLOOKAHEAD, "i<YY_NLOOKAHEAD")
+		if int(yy_lookahead_at(i)) != iLookAhead {
 			if YYFALLBACK {
 				assert(iLookAhead < len(yyFallback), "iLookAhead<len(yyfallback)")
 				iFallback := int(yyFallback[iLookAhead])
 				if iFallback != 0 {
 					if !NDEBUG {
-						if yyTraceFILE != nil {
+						if yyTraceFILE != nil && !quiet {
 							fmt.Fprintf(yyTraceFILE, "%sFALLBACK %s => %s\n",
 								yyTracePrompt, yyTokenName[iLookAhead], yyTokenName[iFallback])
 						}
@@ -499,23 +739,23 @@ func yy_find_shift_action(
 			if YYWILDCARD > 0 {
 				{
 					j := i - iLookAhead + YYWILDCARD
-					assert(j < len(yy_lookahead), "j < len(yy_lookahead)")
-					if int(yy_lookahead[j]) == YYWILDCARD && iLookAhead > 0 {
+					assert(j < YY_NLOOKAHEAD, "j < YY_NLOOKAHEAD")
+					if int(yy_lookahead_at(j)) == YYWILDCARD && iLookAhead > 0 {
 						if !NDEBUG {
-							if yyTraceFILE != nil {
+							if yyTraceFILE != nil && !quiet {
 								fmt.Fprintf(yyTraceFILE, "%sWILDCARD %s => %s\n",
 									yyTracePrompt, yyTokenName[iLookAhead],
 									yyTokenName[YYWILDCARD])
 							}
 						} /* NDEBUG */
-						return yy_action[j]
+						return yy_action_at(j)
 					}
 				}
 			} /* YYWILDCARD */
-			return yy_default[stateno]
+			return yy_default_at(int(stateno))
 		} else {
-			assert(i >= 0 && i < len(yy_action), "i >= 0 && i < len(yy_action)")
-			return yy_action[i]
+			assert(i >= 0 && i < YY_ACTTAB_COUNT, "i >= 0 && i < YY_ACTTAB_COUNT")
+			return yy_action_at(i)
 		}
 	}
 }
@@ -531,23 +771,23 @@ func yy_find_reduce_action(
 	iLookAhead := int(lookAhead)
 	if YYERRORSYMBOL > 0 {
 		if stateno > YY_REDUCE_COUNT {
-			return yy_default[stateno]
+			return yy_default_at(int(stateno))
 		}
 	} else {
 		assert(stateno <= YY_REDUCE_COUNT, "stateno <= YY_REDUCE_COUNT")
 	}
-	i := int(yy_reduce_ofst[stateno])
+	i := int(yy_reduce_ofst_at(int(stateno)))
 	assert(iLookAhead != YYNOCODE, "iLookAhead != YYNOCODE")
 	i += iLookAhead
 	if YYERRORSYMBOL > 0 {
-		if i < 0 || i >= YY_ACTTAB_COUNT || int(yy_lookahead[i]) != iLookAhead {
-			return yy_default[stateno]
+		if i < 0 || i >= YY_ACTTAB_COUNT || int(yy_lookahead_at(i)) != iLookAhead {
+			return yy_default_at(int(stateno))
 		}
 	} else {
 		assert(i >= 0 && i < YY_ACTTAB_COUNT, "i >= 0 && i < YY_ACTTAB_COUNT")
-		assert(int(yy_lookahead[i]) == iLookAhead, "int(yy_lookahead[i]) == iLookAhead")
+		assert(int(yy_lookahead_at(i)) == iLookAhead, "int(yy_lookahead_at(i)) == iLookAhead")
 	}
-	return yy_action[i]
+	return yy_action_at(i)
 }
 
 /*
@@ -564,6 +804,7 @@ func (yypParser *yyParser) yyStackOverflow() {
 	for yypParser.yytos > 0 {
 		yypParser.yy_pop_parser_stack()
 	}
+	yypParser.yystatus = YYSTATUS_OVERFLOW
 	/* Here code is inserted which will execute if the parser
 	 ** stack every overflows */
 	/******** Begin %stack_overflow code ******************************************/
@@ -573,6 +814,57 @@ func (yypParser *yyParser) yyStackOverflow() {
 	ParseCTX_STORE
 }
 
+/*
+** The following routine is called if a limit of ParseSetLimits() is
+** exceeded, while the parser has the token yymajor, which it destroys.
+** The limit is the name of the limit, as in ParseLimitError, and max its
+** value.
+ */
+func (yypParser *yyParser) yy_limit_exceeded(
+	yymajor YYCODETYPE, /* The token being parsed */
+	yyminor ParseTOKENTYPE, /* Its value */
+	limit string, /* The name of the limit */
+	max int, /* The value of the limit */
+) {
+	if !NDEBUG {
+		if yyTraceFILE != nil {
+			fmt.Fprintf(yyTraceFILE, "%sLimit of %d %s exceeded!\n", yyTracePrompt, max, limit)
+		}
+	}
+	for yypParser.yytos > 0 {
+		yypParser.yy_pop_parser_stack()
+	}
+	if int(yymajor) < YYNTOKEN {
+		yyminorunion := YYMINORTYPE{yy0: yyminor}
+		yypParser.yy_destructor(yymajor, &yyminorunion)
+	}
+	yypParser.yystatus = YYSTATUS_LIMIT
+	yypParser.yylimiterr = &ParseLimitError{Token: yymajor, Limit: limit, Max: max}
+	yypParser.yyerr = yypParser.yylimiterr
+}
+
+/*
+** The following routine is called when the action of a rule panicked,
+** as the next call to Parse(), ParseInit() or ParseFinalize() finds, to
+** leave the parser failed until ParseInit() is called.  The values of
+** the rule's right-hand side were given to the action, so are not
+** destroyed; the values below them on the stack are.
+ */
+func (yypParser *yyParser) yy_action_panicked() {
+	yyruleno := YYACTIONTYPE(yypParser.yyreducing - 1)
+	if !NDEBUG {
+		if yyTraceFILE != nil {
+			fmt.Fprintf(yyTraceFILE, "%sPanic in the action of rule %d!\n", yyTracePrompt, yyruleno)
+		}
+	}
+	yypParser.yyreducing = 0
+	yypParser.yystatus = YYSTATUS_PANICKED
+	yypParser.yytos += int(yyRuleInfoNRhs[yyruleno])
+	for yypParser.yytos > 0 {
+		yypParser.yy_pop_parser_stack()
+	}
+}
+
 /*
 ** Print tracing information for a SHIFT action
  */
@@ -608,8 +900,14 @@ func (yypParser *yyParser) yy_shift(
 			assert(yypParser.yyhwm == yypParser.yytos, "yypParser.yyhwm == yypParser.yytos")
 		}
 	}
-	if YYSTACKDEPTH > 0 {
+	if max := yypParser.yylimits.MaxDepth; max > 0 && yypParser.yytos > max {
+		yypParser.yytos--
+		yypParser.yy_limit_exceeded(yyMajor, yyMinor, "stack entries", max)
+		return
+	}
+	if !YYGROWABLESTACK {
 		if yypParser.yytos >= YYSTACKDEPTH {
+			yypParser.yytos--
 			yypParser.yyStackOverflow()
 			return
 		}
@@ -623,10 +921,17 @@ func (yypParser *yyParser) yy_shift(
 		yyNewState += YY_MIN_REDUCE - YY_MIN_SHIFTREDUCE
 	}
 
+	if YYINCREMENTAL {
+		yypParser.yy_touch(yypParser.yytos)
+	}
 	yytos := &yypParser.yystack[yypParser.yytos]
 	yytos.stateno = yyNewState
 	yytos.major = yyMajor
 	yytos.minor.yy0 = yyMinor
+	ParsePULL_SHIFT
+	if YYFUZZ && yypParser.yyvaluehook != nil {
+		yypParser.yyvaluehook(yypParser, YYVALUE_PUSH, yypParser.yytos, &yytos.minor)
+	}
 
 	yypParser.yyTraceShift(int(yyNewState), "Shift")
 }
@@ -696,10 +1001,20 @@ func (yypParser *yyParser) yy_reduce(
 	/* It is not possible for a REDUCE to be followed by an error */
 	assert(yyact != YY_ERROR_ACTION, "yyact != YY_ERROR_ACTION")
 
+	if YYFUZZ && yypParser.yyvaluehook != nil {
+		yypParser.yyvaluehook(yypParser, YYVALUE_RELEASE, int(yyruleno), nil)
+	}
 	yymsp += yysize+1
 	yypParser.yytos = yymsp
+	if YYINCREMENTAL {
+		yypParser.yy_touch(yymsp)
+	}
 	yypParser.yystack[yymsp].stateno = yyact
 	yypParser.yystack[yymsp].major = yygoto
+	ParsePULL_REDUCE
+	if YYFUZZ && yypParser.yyvaluehook != nil {
+		yypParser.yyvaluehook(yypParser, YYVALUE_PUSH, yymsp, &yypParser.yystack[yymsp].minor)
+	}
 	yypParser.yyTraceShift(int(yyact), "... then shift")
 	return yyact
 }
@@ -718,6 +1033,7 @@ func (yypParser *yyParser) yy_parse_failed() {
 	for yypParser.yytos > 0 {
 		yypParser.yy_pop_parser_stack()
 	}
+	yypParser.yystatus = YYSTATUS_FAILED
 	/* Here code is inserted which will be executed whenever the
 	 ** parser fails */
 	/************ Begin %parse_failure code ***************************************/
@@ -739,6 +1055,7 @@ func (yypParser *yyParser) yy_syntax_error(
 	ParseCTX_FETCH
 	TOKEN := yyminor
 	_ = TOKEN
+	yypParser.yynsyntax++
 	/************ Begin %syntax_error code ****************************************/
 %%
 
@@ -761,7 +1078,8 @@ func (yypParser *yyParser) yy_accept() {
 	if !YYNOERRORRECOVERY {
 		yypParser.yyerrcnt = -1
 	}
-	assert(yypParser.yytos==0, fmt.Sprintf("want yypParser.yytos == 0; got %d", yypParser.yytos))
+	assert(yypParser.yytos == 0, "yypParser.yytos == 0")
+	yypParser.yystatus = YYSTATUS_ACCEPTED
 	/* Here code is inserted which will be executed whenever the
 	 ** parser accepts */
 	/*********** Begin %parse_accept code *****************************************/
@@ -772,6 +1090,79 @@ func (yypParser *yyParser) yy_accept() {
 	ParseCTX_STORE
 }
 
+/*
+** Return true if the parser, in its present state, can take the token
+** yymajor next: if Parse() would shift it, after any reductions that
+** must come first, or accept the input at it.  Return false if it would
+** be a syntax error.  The reductions are simulated on the states of the
+** stack alone, so no action or destructor is run and the parser is left
+** as it was.  A lexer can use this to choose between tokens, such as a
+** keyword and an identifier, by what the grammar allows at that point.
+ */
+func (yypParser *yyParser) ParseCanShift(yymajor YYCODETYPE) bool {
+	if int(yymajor) >= YYNTOKEN || yypParser.yystack == nil {
+		return false
+	}
+	return yypParser.yy_can_take(yypParser.yytos, yymajor)
+}
+
+/*
+** Return true if the parser, with its stack cut down to the entries up
+** to yytos, could take the tokens yymajors one after another, which
+** ParseCanShift() says of a single token.  Nothing is changed.
+ */
+func (yypParser *yyParser) yy_can_take(yytos int, yymajors ...YYCODETYPE) bool {
+	return yypParser.yy_can_take_after(yytos, YY_NO_ACTION, yymajors)
+}
+
+/*
+** As yy_can_take(), but with the state yygoto pushed onto the stack
+** after its entry yytos, unless yygoto is YY_NO_ACTION.
+ */
+func (yypParser *yyParser) yy_can_take_after(yytos int, yygoto YYACTIONTYPE, yymajors []YYCODETYPE) bool {
+	var yybuf [16]YYACTIONTYPE
+	yypushed := yybuf[:0] /* States pushed by the simulated reductions */
+	yyact := yypParser.yystack[yytos].stateno
+	if yygoto != YY_NO_ACTION {
+		yypushed = append(yypushed, yygoto)
+		yyact = yygoto
+	}
+	for i, yymajor := range yymajors {
+		for {
+			yyact = yy_find_shift_action(yymajor, yyact, true)
+			if yyact < YY_MIN_REDUCE {
+				break
+			}
+			yyruleno := yyact - YY_MIN_REDUCE
+			yysize := -int(yyRuleInfoNRhs[yyruleno])
+			if yysize <= len(yypushed) {
+				yypushed = yypushed[:len(yypushed)-yysize]
+			} else {
+				yytos -= yysize - len(yypushed)
+				yypushed = yypushed[:0]
+			}
+			if len(yypushed) > 0 {
+				yyact = yypushed[len(yypushed)-1]
+			} else {
+				yyact = yypParser.yystack[yytos].stateno
+			}
+			yyact = yy_find_reduce_action(yyact, yyRuleInfoLhs[yyruleno])
+			yypushed = append(yypushed, yyact)
+		}
+		if yyact == YY_ACCEPT_ACTION {
+			return yymajor == 0 && i == len(yymajors)-1
+		}
+		if yyact > YY_MAX_SHIFTREDUCE {
+			return false
+		}
+		if yyact > YY_MAX_SHIFT {
+			yyact += YY_MIN_REDUCE - YY_MIN_SHIFTREDUCE
+		}
+		yypushed = append(yypushed, yyact)
+	}
+	return true
+}
+
 /* The main parser program.
 ** The first argument is a pointer to a structure obtained from
 ** "ParseAlloc" which describes the current state of the parser.
@@ -789,7 +1180,12 @@ func (yypParser *yyParser) yy_accept() {
 ** </ul>
 **
 ** Outputs:
-** None.
+** None.  If the parser cannot take the token, ParseErr() says why, and
+** the token is destroyed if it is a terminal.
+**
+** If the action of a rule panics, the panic goes on up to the caller.
+** The next call to Parse(), ParseInit() or ParseFinalize() destroys the
+** values left on the stack; Parse() then finds the parser failed.
  */
 func (yypParser *yyParser) Parse(
 	yymajor YYCODETYPE, /* The major token code number */
@@ -806,7 +1202,29 @@ func (yypParser *yyParser) Parse(
 	ParseCTX_FETCH
 	ParseARG_STORE
 
-	assert(yypParser.yystack != nil, "yypParser.yystack != nil")
+	yypParser.yyerr = nil
+	if yypParser.yyreducing > 0 {
+		yypParser.yy_action_panicked()
+	}
+	if int(yymajor) >= YYNTOKEN {
+		yypParser.yyerr = fmt.Errorf("token code %d is not a terminal", yymajor)
+		return
+	}
+	/* After a failure or a stack overflow, the parse starts again */
+	if yypParser.yystack == nil || yypParser.yystatus == YYSTATUS_ACCEPTED ||
+		yypParser.yystatus == YYSTATUS_LIMIT || yypParser.yystatus == YYSTATUS_PANICKED {
+		yyminorunion.yy0 = yyminor
+		yypParser.yy_destructor(yymajor, &yyminorunion)
+		yypParser.yyerr = yypParser.yy_cannot_parse()
+		return
+	}
+	if yymajor != 0 {
+		yypParser.yyntoken++
+		if max := yypParser.yylimits.MaxTokens; max > 0 && yypParser.yyntoken > max {
+			yypParser.yy_limit_exceeded(yymajor, yyminor, "tokens", max)
+			return
+		}
+	}
 	if YYERRORSYMBOL == 0 && !YYNOERRORRECOVERY {
 		yyendofinput = (yymajor == 0)
 	}
@@ -827,7 +1245,7 @@ func (yypParser *yyParser) Parse(
 	for { /* Exit by "break" */
 		assert(yypParser.yytos >= 0, "yypParser.yytos >= 0")
 		assert(yyact == yypParser.yystack[yypParser.yytos].stateno, "yyact == yypParser.yystack[yypParser.yytos].stateno")
-		yyact = yy_find_shift_action(yymajor, yyact)
+		yyact = yy_find_shift_action(yymajor, yyact, false)
 		if yyact >= YY_MIN_REDUCE {
 			yyruleno := yyact - YY_MIN_REDUCE /* Reduce by this rule */
 			if !NDEBUG {
@@ -852,17 +1270,27 @@ func (yypParser *yyParser) Parse(
 				}
 			} /* NDEBUG */
 
+			yypParser.yynreduce++
+			if max := yypParser.yylimits.MaxReductions; max > 0 && yypParser.yynreduce > max {
+				yypParser.yy_limit_exceeded(yymajor, yyminor, "reductions", max)
+				break
+			}
+
 			/* Check that the stack is large enough to grow by a single entry
 			 ** if the RHS of the rule is empty.  This ensures that there is room
 			 ** enough on the stack to push the LHS value */
 			if yyRuleInfoNRhs[yyruleno] == 0 {
+				if max := yypParser.yylimits.MaxDepth; max > 0 && yypParser.yytos >= max {
+					yypParser.yy_limit_exceeded(yymajor, yyminor, "stack entries", max)
+					break
+				}
 				if YYTRACKMAXSTACKDEPTH {
 					if yypParser.yytos > yypParser.yyhwm {
 						yypParser.yyhwm++
 						assert(yypParser.yyhwm == yypParser.yytos, "yypParser.yyhwm == yypParser.yytos")
 					}
 				}
-				if YYSTACKDEPTH > 0 {
+				if !YYGROWABLESTACK {
 					if yypParser.yytos >= YYSTACKDEPTH-1 {
 						yypParser.yyStackOverflow()
 						break
@@ -873,8 +1301,10 @@ func (yypParser *yyParser) Parse(
 					}
 				}
 			}
+			yypParser.yyreducing = int(yyruleno) + 1
 			yyact = yypParser.yy_reduce(yyruleno, yymajor, yyminor,
 			ParseCTX_PARAM)
+			yypParser.yyreducing = 0
 		} else if yyact <= YY_MAX_SHIFTREDUCE {
 			yypParser.yy_shift(yyact, yymajor, yyminor)
 			if !YYNOERRORRECOVERY {
@@ -882,12 +1312,20 @@ func (yypParser *yyParser) Parse(
 			}
 			break
 		} else if yyact == YY_ACCEPT_ACTION {
+			if YYINCREMENTAL {
+				yypParser.yy_touch(yypParser.yytos)
+			}
 			yypParser.yytos--
 			yypParser.yy_accept()
 			return
 		} else {
 			assert(yyact == YY_ERROR_ACTION, "yyact == YY_ERROR_ACTION")
 			yyminorunion.yy0 = yyminor
+			yypParser.yynrecover++
+			if max := yypParser.yylimits.MaxRecoveries; max > 0 && yypParser.yynrecover > max {
+				yypParser.yy_limit_exceeded(yymajor, yyminor, "error recoveries", max)
+				break
+			}
 
 			if !NDEBUG {
 				if yyTraceFILE != nil {
@@ -1003,13 +1441,33 @@ func (yypParser *yyParser) Parse(
 	return
 }
 
+/* Return the error for a token given to Parse() when the parser cannot
+** take any */
+func (yypParser *yyParser) yy_cannot_parse() error {
+	msg := ""
+	switch yypParser.yystatus {
+	case YYSTATUS_LIMIT:
+		return yypParser.yylimiterr
+	case YYSTATUS_ACCEPTED:
+		msg = "the parser has accepted its input"
+	case YYSTATUS_PANICKED:
+		msg = "the parser failed when an action panicked"
+	}
+	if yypParser.yystack == nil {
+		msg = "the parser was not set up by ParseAlloc() or ParseInit()"
+	}
+	return fmt.Errorf("%s; call ParseInit() to parse again", msg)
+}
+
 /*
 ** Return the fallback token corresponding to canonical token iToken, or
-** 0 if iToken has no fallback.
+** 0 if iToken has no fallback or is not a token.
  */
 func ParseFallback(iToken int) YYCODETYPE {
 	if YYFALLBACK {
-		assert(iToken < len(yyFallback), "iToken < len(yyFallback)")
+		if iToken < 0 || iToken >= len(yyFallback) {
+			return 0
+		}
 		return yyFallback[iToken]
 	} else {
 		return 0
@@ -1017,9 +1475,10 @@ func ParseFallback(iToken int) YYCODETYPE {
 }
 
 // assert is used in various places in the generated and template code
-// to check invariants.
+// to check invariants.  With "golemon -D NDEBUG" it does nothing, and
+// the compiler drops the checks.
 func assert(condition bool, message ...string) {
-	if !condition {
+	if !NDEBUG && !condition {
 		if len(message) > 0 {
 			panic(message[0])
 		} else {
@@ -1027,3 +1486,1104 @@ func assert(condition bool, message ...string) {
 		}
 	}
 }
+%%
+/************ Begin the pull-mode driver, with -pull **************************/
+/*
+** ParseAll() reads the tokens from a ParseLexer and gives them to
+** Parse() itself, up to the end of input, and returns the value of the
+** start symbol, or the first error.  The parser keeps the location of
+** each token on its stack, in yyPullState and yyPullEntry, for the
+** errors and the syntax tree.
+ */
+
+/* The location of the token given to Parse(), kept in the parser */
+type yyPullState struct {
+	yyloc    ParseLocation /* Location of the token given to Parse() */
+	yytrivia string        /* Text skipped before that token */
+}
+
+/* The location of a symbol on the stack */
+type yyPullEntry struct {
+	loc    ParseLocation /* Where the symbol starts in the input */
+	trivia string        /* Text skipped before a token, if known */
+}
+
+/* Give the token just shifted onto the stack at yytos its location, for
+** yy_shift() */
+func (yypParser *yyParser) yy_shift_loc(yytos *yyStackEntry) {
+	yytos.loc = yypParser.yyloc
+	yytos.trivia = yypParser.yytrivia
+}
+
+/* Give the nonterminal just pushed onto the stack at yymsp, in place of
+** the yysize symbols of its rule, its location, for yy_reduce().  It
+** starts where the first of them did, or at the lookahead if there are
+** none. */
+func (yypParser *yyParser) yy_reduce_loc(yymsp int, yysize int) {
+	if yysize == 0 {
+		yypParser.yystack[yymsp].loc = yypParser.yyloc
+	}
+	yypParser.yystack[yymsp].trivia = ""
+}
+
+/* Give the location of the next token passed to Parse(), and the text,
+** such as white space and comments, skipped before it.  The parser keeps
+** them with the token on its stack, for the syntax tree built by
+** "golemon -cst".  ParseAll() calls this for each token.
+ */
+func (yypParser *yyParser) ParseSetLocation(loc ParseLocation, trivia string) {
+	yypParser.yyloc = loc
+	yypParser.yytrivia = trivia
+}
+
+/* A position in the input, as reported by a ParseLexer.  Line and
+** Column count from one; zero means they are not known.
+ */
+type ParseLocation struct {
+	Offset int /* Byte offset from the start of the input */
+	Line   int /* Line number */
+	Column int /* Column number within the line */
+}
+
+func (loc ParseLocation) String() string {
+	if loc.Line == 0 {
+		return fmt.Sprintf("offset %d", loc.Offset)
+	}
+	if loc.Column == 0 {
+		return fmt.Sprintf("%d", loc.Line)
+	}
+	return fmt.Sprintf("%d:%d", loc.Line, loc.Column)
+}
+
+/* The source of tokens for ParseAll().  Next() returns the major code
+** and the value of the next token, and where the token starts.  At the
+** end of the input it returns the major code 0.  An error from Next()
+** ends the parse.
+ */
+type ParseLexer interface {
+	Next() (major YYCODETYPE, minor ParseTOKENTYPE, loc ParseLocation, err error)
+}
+
+/* A ParseLexer that also implements ParseTrivia gives, through Trivia(),
+** the text it skipped before the token that Next() last returned.
+ */
+type ParseTrivia interface {
+	Trivia() string
+}
+
+/* A syntax error, parse failure or stack overflow found by ParseAll(),
+** or a token from its lexer that Parse() cannot take
+ */
+type ParseError struct {
+	Loc   ParseLocation /* Where the offending token starts */
+	Token YYCODETYPE    /* The offending token, or 0 for the end of input */
+	Msg   string        /* What went wrong */
+	Err   error         /* The error of the parser behind Msg, if any */
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Loc, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+/* Return the error for a problem found on the token major at loc */
+func yy_parse_error(major YYCODETYPE, loc ParseLocation, msg string) *ParseError {
+	if major == 0 {
+		msg += " at the end of input"
+	} else {
+		msg += " near " + yyTokenName[major]
+	}
+	return &ParseError{Loc: loc, Token: major, Msg: msg}
+}
+
+/* Parse all the tokens from lex, up to and including the end of input,
+** and return the value of the start symbol.
+**
+** The error returned is the first of: an error from lex, the first
+** syntax error, or a failure of the parse.  If the grammar recovers
+** from syntax errors with the "error" token, the value of the start
+** symbol is returned together with the first syntax error.  The parse
+** stops early if lex fails or gives a code that is not a token, if the
+** parse fails (after the %parse_failure code) or if the stack overflows
+** (after the %stack_overflow code).
+ */
+func ParseAll(lex ParseLexer, ParseCTX_PDECL) (ParseRESULTTYPE, error) {
+	return ParseAllContext(yycontext.Background(), lex, ParseLimits{}, ParseCTX_PARAM)
+}
+
+/* As ParseAll(), for input that cannot be trusted.  The parse also stops
+** early, with the error from yyctx.Err(), if yyctx is cancelled or its
+** deadline passes, which is checked before each token is read; and with
+** a *ParseError wrapping a *ParseLimitError if one of limits is
+** exceeded.
+ */
+func ParseAllContext(yyctx yycontext.Context, lex ParseLexer, limits ParseLimits, ParseCTX_PDECL) (ParseRESULTTYPE, error) {
+	yypParser := ParseAlloc(ParseCTX_PARAM)
+	yypParser.ParseSetLimits(limits)
+	return yypParser.yy_parse_all(yyctx, lex, (*yyParser).Parse)
+}
+
+/* Give each token from lex to the parser with yyparse, which is Parse()
+** or ParseRecover(), for ParseAllContext() and ParseAllRecover().  If
+** the action of a rule panics, the values on the stack and the token
+** are destroyed before the panic goes on. */
+func (yypParser *yyParser) yy_parse_all(yyctx yycontext.Context, lex ParseLexer,
+	yyparse func(*yyParser, YYCODETYPE, ParseTOKENTYPE)) (ParseRESULTTYPE, error) {
+	var result ParseRESULTTYPE
+	var firstErr error
+	var yymajor YYCODETYPE
+	var yyminor ParseTOKENTYPE
+	defer func() {
+		if yypParser.yyreducing > 0 {
+			yypParser.yy_action_panicked()
+			yyminorunion := YYMINORTYPE{yy0: yyminor}
+			yypParser.yy_destructor(yymajor, &yyminorunion)
+		}
+	}()
+	yydone := yyctx.Done()
+	for {
+		if yydone != nil {
+			select {
+			case <-yydone:
+				yypParser.ParseFinalize()
+				return result, yyctx.Err()
+			default:
+			}
+		}
+		var loc ParseLocation
+		var err error
+		yymajor, yyminor, loc, err = lex.Next()
+		if err != nil {
+			yypParser.ParseFinalize()
+			return result, err
+		}
+		trivia := ""
+		if t, ok := lex.(ParseTrivia); ok {
+			trivia = t.Trivia()
+		}
+		yypParser.ParseSetLocation(loc, trivia)
+		nsyntax := yypParser.yynsyntax
+		yyparse(yypParser, yymajor, yyminor)
+		if yypParser.yynsyntax > nsyntax && firstErr == nil {
+			firstErr = yy_parse_error(yymajor, loc, "syntax error")
+		}
+		switch yypParser.yystatus {
+		case YYSTATUS_ACCEPTED:
+			result = yypParser.yyresult()
+			return result, firstErr
+		case YYSTATUS_FAILED:
+			if firstErr == nil {
+				firstErr = yy_parse_error(yymajor, loc, "parse failed")
+			}
+			yypParser.ParseFinalize()
+			return result, firstErr
+		case YYSTATUS_OVERFLOW:
+			return result, yy_parse_error(yymajor, loc, "parser stack overflow")
+		case YYSTATUS_LIMIT:
+			yyerr := yypParser.yylimiterr
+			return result, &ParseError{Loc: loc, Token: yyerr.Token, Msg: yyerr.Error(), Err: yyerr}
+		}
+		if err := yypParser.yyerr; err != nil {
+			/* lex gave a code that is not a token */
+			yypParser.ParseFinalize()
+			return result, &ParseError{Loc: loc, Token: yymajor, Msg: err.Error(), Err: err}
+		}
+		if yymajor == 0 {
+			/* Error recovery discarded the end of input */
+			yypParser.ParseFinalize()
+			if firstErr == nil {
+				firstErr = yy_parse_error(yymajor, loc, "syntax error")
+			}
+			return result, firstErr
+		}
+	}
+}
+%%
+/************ Begin ParseRecover(), with -recover or %sync ********************/
+/*
+** ParseRecover() gives a token to Parse(), but first tries, on a token
+** that the parser cannot take, the strategies of ParseRecovery: inserting
+** a token before it, deleting it if the next token can be taken in its
+** place, or discarding tokens up to a %sync token.  Where none applies,
+** Parse() recovers as lempar.c does.  Each syntax error reported is kept,
+** with how the parser recovered from it, for ParseDiagnostics(), and
+** ParseAllRecover() returns them all.  The state of ParseRecover() is
+** kept in the parser, in yyRecoverState.
+ */
+
+/* How ParseRecover() recovers from syntax errors, as set by
+** ParseSetRecovery().  The strategies are tried in the order of the
+** fields, and those that do not apply fall back to the classic scheme of
+** Parse() and the zero value: pop the stack to a state that can shift
+** the grammar's error token, if it has one, or else discard the token in
+** error.
+ */
+type ParseRecovery struct {
+	Insert []YYCODETYPE /* Tokens that may be inserted before the token in
+	 ** error, in order of preference; the first after which the parser
+	 ** can take that token is inserted, with the zero value */
+	Delete bool /* Delete the token in error if the parser can take the
+	 ** token after it */
+	Sync bool /* Discard tokens up to one declared with %sync, or the end
+	 ** of input, and pop the stack to a state that can take it,
+	 ** perhaps after a nonterminal with the zero value standing for
+	 ** what was popped */
+	Window int /* Tokens shifted after a syntax error before another is
+	 ** reported, one more with the error token: 3 if zero, and none if
+	 ** negative */
+}
+
+/* A syntax error reported by the parser, and how it recovered.  Recovery
+** is one of:
+**
+**   +  "insert": Fix was inserted before Token.
+**   +  "delete": Token was deleted.
+**   +  "sync": Token and the tokens after it, Skipped in all, were
+**      discarded up to Fix, a %sync token or the end of input (0), and
+**      the stack popped to a state that could take Fix.  If none could,
+**      a %sync token was discarded too, and counted in Skipped, and the
+**      discarding went on.
+**   +  "error": the grammar's error token was shifted.
+**   +  "discard": Token was discarded.
+**   +  "fail": the parse failed.
+**   +  "none": nothing was done, with YYNOERRORRECOVERY.
+ */
+type ParseDiagnostic struct {
+	Loc      ParseLocation /* Where Token starts */
+	Token    YYCODETYPE    /* The token in error, or 0 for the end of input */
+	Recovery string        /* How the parser went on */
+	Fix      YYCODETYPE    /* The token inserted or synchronised on */
+	Skipped  int           /* Tokens discarded, for "sync" */
+}
+
+func (d ParseDiagnostic) String() string {
+	msg := yy_parse_error(d.Token, d.Loc, "syntax error").Error()
+	switch d.Recovery {
+	case "insert":
+		msg += ", inserted " + yyTokenName[d.Fix]
+	case "delete":
+		msg += ", deleted it"
+	case "sync":
+		to := "the end of input"
+		if d.Fix != 0 {
+			to = yyTokenName[d.Fix]
+		}
+		msg += fmt.Sprintf(", skipped %d tokens to %s", d.Skipped, to)
+	case "error":
+		msg += ", recovered with the error token"
+	case "discard":
+		msg += ", discarded it"
+	case "fail":
+		msg += ", parse failed"
+	}
+	return msg
+}
+
+/* A token given to ParseRecover() that is not on the stack */
+type yyToken struct {
+	major  YYCODETYPE     /* Its code, or YYNOCODE for none */
+	minor  ParseTOKENTYPE /* Its value */
+	loc    ParseLocation  /* Where it starts */
+	trivia string         /* The text skipped before it */
+}
+
+/* The state of ParseRecover(), kept in the parser */
+type yyRecoverState struct {
+	yyrecovery ParseRecovery     /* How to recover from syntax errors */
+	yydiags    []ParseDiagnostic /* Syntax errors reported since ParseInit() */
+	yyheld     yyToken /* A token in error, held back until the next shows
+	 ** whether deleting it repairs the error */
+	yyhelddiag int  /* The index in yydiags of its error, or -1 */
+	yysyncing  bool /* True while discarding tokens up to a %sync token */
+	yysyncdiag int  /* The index in yydiags of the error that began it, or -1 */
+}
+
+/* Clear the state of ParseRecover(), for ParseInit() */
+func (yypParser *yyParser) yy_recover_init() {
+	yypParser.yydiags = nil
+	yypParser.yyheld = yyToken{major: YYNOCODE}
+	yypParser.yysyncing = false
+}
+
+/* Give pParser, just made a copy of another parser, copies of its own
+** of the held token and of the diagnostics, for yy_copy_from() */
+func (pParser *yyParser) yy_recover_copy() {
+	if pParser.yyheld.major != YYNOCODE {
+		yyminorunion := YYMINORTYPE{yy0: pParser.yyheld.minor}
+		pParser.yy_copy(pParser.yyheld.major, &yyminorunion)
+		pParser.yyheld.minor = yyminorunion.yy0
+	}
+	pParser.yydiags = append([]ParseDiagnostic(nil), pParser.yydiags...)
+}
+
+/* Set how ParseRecover() recovers from syntax errors.  Each error it
+** reports, by running the %syntax_error code, is also kept with how it
+** recovered, for ParseDiagnostics().
+ */
+func (yypParser *yyParser) ParseSetRecovery(recovery ParseRecovery) {
+	yypParser.yyrecovery = recovery
+}
+
+/* Return the syntax errors reported since ParseInit(), in order.  The
+** last may not yet say how the parser recovered, if it is waiting for
+** the next token to know.
+ */
+func (yypParser *yyParser) ParseDiagnostics() []ParseDiagnostic {
+	return yypParser.yydiags
+}
+
+/*
+** Give the token yymajor to the parser, as Parse() does, and recover from
+** a syntax error on it with the strategies of ParseSetRecovery().  A
+** token held back by the Delete strategy is parsed, or deleted, when the
+** next is given.  Each syntax error reported is kept, with how the parser
+** recovered, for ParseDiagnostics().  If the parser cannot take the
+** token, ParseErr() says why, as for Parse().
+ */
+func (yypParser *yyParser) ParseRecover(
+	yymajor YYCODETYPE, /* The major token code number */
+	yyminor ParseTOKENTYPE, /* The value for the token */
+) {
+	yypParser.yyerr = nil
+	if yypParser.yyreducing > 0 {
+		yypParser.yy_action_panicked()
+	}
+	if int(yymajor) >= YYNTOKEN || yypParser.yy_refused() {
+		yypParser.Parse(yymajor, yyminor)
+		return
+	}
+	if !yypParser.yy_count_token(yymajor, yyminor) {
+		yypParser.yy_drop_held()
+		return
+	}
+	if yypParser.yyheld.major != YYNOCODE {
+		/* The token held back by the Delete strategy is deleted if the
+		 ** parser can take this one in its place.  If not, the parser
+		 ** recovers from its error as Parse() would have, then goes on to
+		 ** this one. */
+		yyheld := yypParser.yyheld
+		yypParser.yyheld = yyToken{major: YYNOCODE}
+		if yypParser.yy_can_take(yypParser.yytos, yymajor) {
+			if !NDEBUG {
+				if yyTraceFILE != nil {
+					fmt.Fprintf(yyTraceFILE, "%sDelete input token %s\n",
+						yyTracePrompt, yyTokenName[yyheld.major])
+				}
+			}
+			yypParser.yy_recovered(yypParser.yyhelddiag, "delete", 0)
+			yyminorunion := YYMINORTYPE{yy0: yyheld.minor}
+			yypParser.yy_destructor(yyheld.major, &yyminorunion)
+		} else {
+			yyloc, yytrivia := yypParser.yyloc, yypParser.yytrivia
+			yypParser.ParseSetLocation(yyheld.loc, yyheld.trivia)
+			yypParser.yy_parse_token(yyheld.major, yyheld.minor, yypParser.yyhelddiag, true)
+			yypParser.ParseSetLocation(yyloc, yytrivia)
+			if yypParser.yy_refused() {
+				yypParser.yy_parse_token(yymajor, yyminor, -1, false)
+				return
+			}
+		}
+	}
+	yysynced := false /* True once yymajor has been given to yy_sync() */
+	if yypParser.yysyncing {
+		if !yypParser.yy_sync(yymajor, yyminor) {
+			return
+		}
+		yysynced = true
+	}
+	if !YYNOERRORRECOVERY && !yypParser.yy_can_take(yypParser.yytos, yymajor) {
+		yyins := yypParser.yy_find_insertion(yymajor)
+		yydel := yypParser.yyrecovery.Delete && yymajor != 0
+		if yyins != YYNOCODE || yydel || YYSYNC && yypParser.yyrecovery.Sync && !yysynced {
+			yypParser.yy_recover(yymajor, yyminor, yyins, yydel)
+			return
+		}
+	}
+	yypParser.yy_parse_token(yymajor, yyminor, -1, false)
+}
+
+/* Return true if Parse() would refuse any token, until ParseInit() is
+** called */
+func (yypParser *yyParser) yy_refused() bool {
+	return yypParser.yystack == nil || yypParser.yystatus == YYSTATUS_ACCEPTED ||
+		yypParser.yystatus == YYSTATUS_LIMIT || yypParser.yystatus == YYSTATUS_PANICKED
+}
+
+/*
+** Count the token yymajor against ParseLimits.MaxTokens, as Parse()
+** would, for ParseRecover(), which may not give it to Parse().  If the
+** limit is exceeded, the token is destroyed and false returned.
+ */
+func (yypParser *yyParser) yy_count_token(yymajor YYCODETYPE, yyminor ParseTOKENTYPE) bool {
+	if yymajor != 0 {
+		yypParser.yyntoken++
+		if max := yypParser.yylimits.MaxTokens; max > 0 && yypParser.yyntoken > max {
+			yypParser.yy_limit_exceeded(yymajor, yyminor, "tokens", max)
+			return false
+		}
+	}
+	return true
+}
+
+/*
+** Recover from the syntax error on the token yymajor, which the parser
+** cannot take, by the first strategy of ParseRecovery that applies:
+** insert yyins, unless it is YYNOCODE; or else hold the token back, if
+** yydel; or else discard tokens up to a %sync token.
+ */
+func (yypParser *yyParser) yy_recover(yymajor YYCODETYPE, yyminor ParseTOKENTYPE, yyins YYCODETYPE, yydel bool) {
+	yypParser.yynrecover++
+	if max := yypParser.yylimits.MaxRecoveries; max > 0 && yypParser.yynrecover > max {
+		yypParser.yy_limit_exceeded(yymajor, yyminor, "error recoveries", max)
+		return
+	}
+	if !NDEBUG {
+		if yyTraceFILE != nil {
+			fmt.Fprintf(yyTraceFILE, "%sSyntax Error!\n", yyTracePrompt)
+		}
+	}
+	yydiag := -1 /* The index in yydiags of yymajor's error */
+	if yypParser.yy_reporting() {
+		yydiag = yypParser.yy_report(yymajor, yyminor)
+	}
+	yypParser.yyerrcnt = yypParser.yy_window()
+	if yyins != YYNOCODE {
+		if !NDEBUG {
+			if yyTraceFILE != nil {
+				fmt.Fprintf(yyTraceFILE, "%sInsert token %s\n",
+					yyTracePrompt, yyTokenName[yyins])
+			}
+		}
+		yypParser.yy_recovered(yydiag, "insert", yyins)
+		var yyzero ParseTOKENTYPE /* The value of the inserted token */
+		yytrivia := yypParser.yytrivia
+		yypParser.yytrivia = ""
+		yypParser.yyntoken-- /* The inserted token is not counted */
+		yypParser.Parse(yyins, yyzero)
+		yypParser.yytrivia = yytrivia
+		yypParser.yy_parse_token(yymajor, yyminor, -1, false)
+		return
+	}
+	if yydel {
+		if !NDEBUG {
+			if yyTraceFILE != nil {
+				fmt.Fprintf(yyTraceFILE, "%sHold back input token %s\n",
+					yyTracePrompt, yyTokenName[yymajor])
+			}
+		}
+		yypParser.yyheld = yyToken{yymajor, yyminor, yypParser.yyloc, yypParser.yytrivia}
+		yypParser.yyhelddiag = yydiag
+		return
+	}
+	yypParser.yy_recovered(yydiag, "sync", 0)
+	yypParser.yysyncing = true
+	yypParser.yysyncdiag = yydiag
+	if yypParser.yy_sync(yymajor, yyminor) {
+		yypParser.yy_parse_token(yymajor, yyminor, yydiag, !yypParser.yy_can_take(yypParser.yytos, yymajor))
+	}
+}
+
+/*
+** Give Parse() the token yymajor, which ParseRecover() has counted, and
+** keep the syntax error that Parse() reports on it, if any, with how the
+** parser recovered.  If yyfound, the error was found by ParseRecover(),
+** and reported as yydiag, or not at all if yydiag is -1, so Parse() is
+** kept from reporting it again.
+ */
+func (yypParser *yyParser) yy_parse_token(yymajor YYCODETYPE, yyminor ParseTOKENTYPE, yydiag int, yyfound bool) {
+	if yymajor != 0 {
+		yypParser.yyntoken-- /* Parse() counts it again */
+	}
+	yyhow := "discard" /* How Parse() recovers from an error on yymajor */
+	if YYNOERRORRECOVERY {
+		yyhow = "none"
+	} else if YYERRORSYMBOL > 0 {
+		/* The token is discarded if the error token is on top of the stack
+		 ** when the error is found; else the error token is shifted */
+		yytop := &yypParser.yystack[yypParser.yytos]
+		if int(yytop.major) != YYERRORSYMBOL || yy_find_shift_action(yymajor, yytop.stateno, true) >= YY_MIN_REDUCE {
+			yyhow = "error"
+		}
+	} else if yymajor == 0 {
+		yyhow = "fail"
+	}
+	if yyfound {
+		yypParser.yyerrcnt = 1 /* So that Parse() does not report it again */
+	}
+	yynsyntax, yynrecover := yypParser.yynsyntax, yypParser.yynrecover
+	yypParser.Parse(yymajor, yyminor)
+	if yypParser.yynsyntax > yynsyntax {
+		yypParser.yydiags = append(yypParser.yydiags, ParseDiagnostic{Loc: yypParser.yyloc, Token: yymajor})
+		yydiag = len(yypParser.yydiags) - 1
+	}
+	if yypParser.yynrecover > yynrecover && yypParser.yystatus != YYSTATUS_LIMIT {
+		if YYERRORSYMBOL > 0 && yypParser.yystatus == YYSTATUS_FAILED && yypParser.yytos == 0 {
+			yyhow = "fail"
+		}
+		yypParser.yy_recovered(yydiag, yyhow, 0)
+		/* Parse() leaves yyerrcnt at 3 after an error, less the tokens
+		 ** shifted since, or at -1 if the parse failed without the error
+		 ** token; the window of ParseRecovery is counted from there */
+		if yypParser.yyrecovery.Window < 0 {
+			yypParser.yyerrcnt = -1
+		} else if YYERRORSYMBOL > 0 || yypParser.yyerrcnt >= 0 {
+			yypParser.yyerrcnt += yypParser.yy_window() - 3
+		}
+	}
+}
+
+/*
+** Return true if a syntax error found now is to be reported: if enough
+** tokens have been shifted since the last, as ParseRecovery.Window says.
+ */
+func (yypParser *yyParser) yy_reporting() bool {
+	if YYERRORSYMBOL > 0 {
+		return yypParser.yyerrcnt < 0
+	} else if YYNOERRORRECOVERY {
+		return true
+	}
+	return yypParser.yyerrcnt <= 0
+}
+
+/*
+** Return the number of tokens to shift after a syntax error before
+** another is reported.
+ */
+func (yypParser *yyParser) yy_window() int {
+	if w := yypParser.yyrecovery.Window; w < 0 {
+		return -1
+	} else if w > 0 {
+		return w
+	}
+	return 3
+}
+
+/*
+** Report the syntax error found on the token yymajor, and return the
+** index in yydiags of its diagnostic.
+ */
+func (yypParser *yyParser) yy_report(yymajor YYCODETYPE, yyminor ParseTOKENTYPE) int {
+	yypParser.yy_syntax_error(yymajor, yyminor)
+	yypParser.yydiags = append(yypParser.yydiags, ParseDiagnostic{Loc: yypParser.yyloc, Token: yymajor})
+	return len(yypParser.yydiags) - 1
+}
+
+/*
+** Say how the parser recovered from the syntax error at index yydiag of
+** yydiags, unless it was not reported (-1) or it has been said already.
+ */
+func (yypParser *yyParser) yy_recovered(yydiag int, yyhow string, yyfix YYCODETYPE) {
+	if yydiag >= 0 && yypParser.yydiags[yydiag].Recovery == "" {
+		yypParser.yydiags[yydiag].Recovery = yyhow
+		yypParser.yydiags[yydiag].Fix = yyfix
+	}
+}
+
+/*
+** Return the first token of ParseRecovery.Insert after which the parser
+** can take the token yymajor, or YYNOCODE if there is none.
+ */
+func (yypParser *yyParser) yy_find_insertion(yymajor YYCODETYPE) YYCODETYPE {
+	for _, yyins := range yypParser.yyrecovery.Insert {
+		if yyins == 0 || int(yyins) >= YYNTOKEN || int(yyins) == YYERRORSYMBOL {
+			continue
+		}
+		if yypParser.yy_can_take(yypParser.yytos, yyins, yymajor) {
+			return yyins
+		}
+	}
+	return YYNOCODE
+}
+
+/*
+** Return a nonterminal that the parser could shift onto its stack cut
+** down to the entries up to yytos, and then take the token yymajor, and
+** the state it would go to; or YYNOCODE if there is none.
+ */
+func (yypParser *yyParser) yy_find_goto(yytos int, yymajor YYCODETYPE) (YYCODETYPE, YYACTIONTYPE) {
+	stateno := yypParser.yystack[yytos].stateno
+	if stateno > YY_REDUCE_COUNT {
+		return YYNOCODE, YY_NO_ACTION
+	}
+	for yylhs := YYNTOKEN; yylhs < YYNOCODE; yylhs++ {
+		i := int(yy_reduce_ofst_at(int(stateno))) + yylhs
+		if i < 0 || i >= YY_ACTTAB_COUNT || int(yy_lookahead_at(i)) != yylhs {
+			continue
+		}
+		yygoto := yy_action_at(i)
+		if yypParser.yy_can_take_after(yytos, yygoto, []YYCODETYPE{yymajor}) {
+			return YYCODETYPE(yylhs), yygoto
+		}
+	}
+	return YYNOCODE, YY_NO_ACTION
+}
+
+/*
+** Called, while the parser discards tokens up to a %sync token, with
+** the token yymajor.  A %sync token, or the end of input, ends the
+** discarding: the stack is popped to the deepest state that can take
+** it, and true returned for it to be parsed.  The state may take it
+** only after a nonterminal, which is then pushed with the zero value,
+** in place of what was popped.  If no state can, a %sync token is
+** discarded too, but the end of input is still parsed, to fail.  Any
+** other token is discarded.
+ */
+func (yypParser *yyParser) yy_sync(yymajor YYCODETYPE, yyminor ParseTOKENTYPE) bool {
+	var yydiag *ParseDiagnostic
+	if yypParser.yysyncdiag >= 0 {
+		yydiag = &yypParser.yydiags[yypParser.yysyncdiag]
+	}
+	if yymajor == 0 || YYSYNC && yySyncToken[yymajor] {
+		if yydiag != nil {
+			yydiag.Fix = yymajor
+		}
+		for yytos := yypParser.yytos; yytos >= 0; yytos-- {
+			yylhs, yygoto := YYCODETYPE(YYNOCODE), YYACTIONTYPE(YY_NO_ACTION)
+			if !yypParser.yy_can_take(yytos, yymajor) {
+				if yytos == yypParser.yytos {
+					continue
+				}
+				if yylhs, yygoto = yypParser.yy_find_goto(yytos, yymajor); yylhs == YYNOCODE {
+					continue
+				}
+			}
+			if !NDEBUG {
+				if yyTraceFILE != nil {
+					fmt.Fprintf(yyTraceFILE, "%sSynchronise on %s\n",
+						yyTracePrompt, yyTokenName[yymajor])
+				}
+			}
+			for yypParser.yytos > yytos {
+				yypParser.yy_pop_parser_stack()
+			}
+			if yylhs != YYNOCODE {
+				yypParser.yytos++
+				if YYINCREMENTAL {
+					yypParser.yy_touch(yypParser.yytos)
+				}
+				yyent := &yypParser.yystack[yypParser.yytos]
+				yyent.stateno = yygoto
+				yyent.major = yylhs
+				yyent.minor = YYMINORTYPE{}
+				yyent.loc = yypParser.yyloc
+				yyent.trivia = ""
+				if YYFUZZ && yypParser.yyvaluehook != nil {
+					yypParser.yyvaluehook(yypParser, YYVALUE_PUSH, yypParser.yytos, &yyent.minor)
+				}
+				yypParser.yyTraceShift(int(yygoto), "... push")
+			}
+			yypParser.yysyncing = false
+			return true
+		}
+		if yymajor == 0 {
+			yypParser.yysyncing = false
+			return true
+		}
+	}
+	if !NDEBUG {
+		if yyTraceFILE != nil {
+			fmt.Fprintf(yyTraceFILE, "%sSkip input token %s\n",
+				yyTracePrompt, yyTokenName[yymajor])
+		}
+	}
+	if yydiag != nil {
+		yydiag.Skipped++
+	}
+	yyminorunion := YYMINORTYPE{yy0: yyminor}
+	yypParser.yy_destructor(yymajor, &yyminorunion)
+	return false
+}
+
+/*
+** Destroy the token held back by the Delete strategy of ParseRecovery,
+** if there is one.
+ */
+func (pParser *yyParser) yy_drop_held() {
+	if pParser.yyheld.major != YYNOCODE {
+		yyminorunion := YYMINORTYPE{yy0: pParser.yyheld.minor}
+		pParser.yy_destructor(pParser.yyheld.major, &yyminorunion)
+		pParser.yyheld = yyToken{major: YYNOCODE}
+	}
+}
+
+/* As ParseAllContext(), recovering from syntax errors as recovery says,
+** and returning, besides the first error, every syntax error reported
+** and how the parser recovered from it.
+ */
+func ParseAllRecover(yyctx yycontext.Context, lex ParseLexer, limits ParseLimits, recovery ParseRecovery, ParseCTX_PDECL) (ParseRESULTTYPE, []ParseDiagnostic, error) {
+	yypParser := ParseAlloc(ParseCTX_PARAM)
+	yypParser.ParseSetLimits(limits)
+	yypParser.ParseSetRecovery(recovery)
+	result, err := yypParser.yy_parse_all(yyctx, lex, (*yyParser).ParseRecover)
+	return result, yypParser.yydiags, err
+}
+%%
+/************ Begin ParseIncremental, with -incremental ***********************/
+/*
+** The parser keeps, for each token, the entries of the stack that the
+** token changed, and ParseIncremental uses these to parse a document
+** again after each edit from the last point at which the two parses can
+** differ, up to where they converge.  The steps are recorded in
+** yy_shift(), yy_reduce() and yy_pop_parser_stack() when YYINCREMENTAL
+** is true.  The tokens are given to ParseRecover().  ParseTokens() reads
+** the tokens of a document from a ParseLexer.
+ */
+
+/* A token of the input of a ParseIncremental, as a ParseLexer gives it */
+type ParseToken struct {
+	Major  YYCODETYPE     /* The token's code, or 0 for the end of input */
+	Minor  ParseTOKENTYPE /* Its value */
+	Loc    ParseLocation  /* Where it starts */
+	Trivia string         /* The text skipped before it */
+}
+
+/* Read the tokens from lex, up to and including the end of input, for
+** ParseIncremental.Edit().  An error from lex is returned with the
+** tokens read before it.
+ */
+func ParseTokens(lex ParseLexer) ([]ParseToken, error) {
+	var tokens []ParseToken
+	for {
+		major, minor, loc, err := lex.Next()
+		if err != nil {
+			return tokens, err
+		}
+		trivia := ""
+		if t, ok := lex.(ParseTrivia); ok {
+			trivia = t.Trivia()
+		}
+		tokens = append(tokens, ParseToken{major, minor, loc, trivia})
+		if major == 0 {
+			return tokens, nil
+		}
+	}
+}
+
+/* The state of the parser after one token of the input of a
+** ParseIncremental.  Only the entries of the stack that the token
+** changed are kept, those from low up; the entries below are those of
+** the steps before, so the stack after any token can be rebuilt by
+** going back through the steps.
+ */
+type yyStep struct {
+	low     int            /* The lowest entry of the stack changed or popped */
+	entries []yyStackEntry /* The entries from low to the top of the stack */
+	errcnt  int            /* yyerrcnt after the token */
+	ndiags  int            /* Syntax errors reported up to the token */
+	clean   bool           /* True if the parser is still parsing, holds no
+	 ** token back and is not discarding tokens, so that a parse can
+	 ** start again, or converge with another, here */
+}
+
+/* Return the index of the top of the stack after the step */
+func (s *yyStep) top() int {
+	return s.low + len(s.entries) - 1
+}
+
+/* Return the step for the token just given to yypParser */
+func (yypParser *yyParser) yy_step() yyStep {
+	s := yyStep{low: yypParser.yylow, errcnt: yypParser.yyerrcnt, ndiags: len(yypParser.yydiags)}
+	if s.errcnt < -1 {
+		/* yyerrcnt goes on down with each shift, but every count below
+		 ** zero is the same to the parser */
+		s.errcnt = -1
+	}
+	if yypParser.yytos >= s.low {
+		s.entries = make([]yyStackEntry, yypParser.yytos-s.low+1)
+		copy(s.entries, yypParser.yystack[s.low:])
+	}
+	s.clean = yypParser.yystatus == YYSTATUS_PARSING &&
+		yypParser.yyheld.major == YYNOCODE && !yypParser.yysyncing
+	return s
+}
+
+/* Set the stack of yypParser, from the entry yyfloor up, to that after
+** steps[k] */
+func (yypParser *yyParser) yy_rebuild(steps []yyStep, k int, yyfloor int) {
+	yytos := steps[k].top()
+	if YYGROWABLESTACK {
+		for yytos+1 >= len(yypParser.yystack) {
+			yypParser.yyGrowStack()
+		}
+	}
+	for yylimit := yytos + 1; yylimit > yyfloor; k-- {
+		s := &steps[k]
+		for yylimit > s.low && yylimit > yyfloor {
+			yylimit--
+			yypParser.yystack[yylimit] = s.entries[yylimit-s.low]
+		}
+	}
+	yypParser.yytos = yytos
+}
+
+/* Return true if the stack of yypParser has, from the entry yyfloor up,
+** the same states and symbols as that after steps[k] */
+func (yypParser *yyParser) yy_same_stack(steps []yyStep, k int, yyfloor int) bool {
+	if steps[k].top() != yypParser.yytos {
+		return false
+	}
+	for yylimit := yypParser.yytos + 1; yylimit > yyfloor; k-- {
+		s := &steps[k]
+		for yylimit > s.low && yylimit > yyfloor {
+			yylimit--
+			a, b := &yypParser.yystack[yylimit], &s.entries[yylimit-s.low]
+			if a.stateno != b.stateno || a.major != b.major {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/* Put yypParser in the state after steps[k], with the syntax errors
+** reported up to then, out of diags */
+func (yypParser *yyParser) yy_restart(steps []yyStep, k int, diags []ParseDiagnostic) {
+	ParseCTX_FETCH
+	yypParser.ParseInit(ParseCTX_PARAM)
+	yypParser.yy_rebuild(steps, k, 0)
+	yypParser.yyerrcnt = steps[k].errcnt
+	yypParser.yydiags = append(yypParser.yydiags, diags[:steps[k].ndiags]...)
+}
+
+/*
+** A parser for a document that is parsed again after each change, as
+** by a language server.  It keeps the tokens of the document and, for
+** each, the entries of the stack that the token changed.  Edit()
+** replaces some of the tokens, and starts the parse again from the
+** state after the last token before them.  Once the stack, after a
+** token following the new ones, has the same states as after that
+** token in the last parse, the parse has converged: from there on,
+** only the tokens whose reductions take in a value built again are
+** given to the parser, and the values built from the others, and the
+** syntax errors found on them, are those of the last parse.
+**
+** This gives the same result as parsing all the tokens again, if the
+** actions of the grammar build their values only from the values of
+** their right-hand sides, as in -cst mode, and do nothing else.  The
+** values are shared with the last parse, so no destructor is run for
+** them, and the locations of the tokens after an edit, and of the
+** values built from them, are not moved.
+ */
+type ParseIncremental struct {
+	yyparser *yyParser
+	yytokens []ParseToken
+	yysteps  []yyStep /* yysteps[0] is the state before the first token,
+	 ** and yysteps[i+1] that after yytokens[i], for each token parsed */
+	yyparsed int /* Tokens given to the parser by the last Edit() */
+}
+
+/* Return a ParseIncremental for an empty document, which recovers from
+** syntax errors as recovery says */
+func ParseNewIncremental(recovery ParseRecovery, ParseCTX_PDECL) *ParseIncremental {
+	inc := &ParseIncremental{yyparser: ParseAlloc(ParseCTX_PARAM)}
+	inc.yyparser.ParseSetRecovery(recovery)
+	inc.yyparser.yylow = 0
+	inc.yysteps = []yyStep{inc.yyparser.yy_step()}
+	return inc
+}
+
+/* Return the tokens of the document */
+func (inc *ParseIncremental) Tokens() []ParseToken {
+	return inc.yytokens
+}
+
+/* Return the syntax errors found by the last Edit() in the whole
+** document, and how the parser recovered from each */
+func (inc *ParseIncremental) Diagnostics() []ParseDiagnostic {
+	return inc.yyparser.yydiags
+}
+
+/* Return the number of tokens given to the parser by the last Edit() */
+func (inc *ParseIncremental) Parsed() int {
+	return inc.yyparsed
+}
+
+/* Give the token yytokens[i] to the parser, and keep the step for it */
+func (inc *ParseIncremental) yy_take(i int) {
+	yypParser := inc.yyparser
+	t := &inc.yytokens[i]
+	yypParser.yylow = yypParser.yytos + 1
+	yypParser.ParseSetLocation(t.Loc, t.Trivia)
+	yypParser.ParseRecover(t.Major, t.Minor)
+	inc.yysteps = append(inc.yysteps, yypParser.yy_step())
+	inc.yyparsed++
+}
+
+/*
+** Replace the tokens from start up to end of the document by tokens,
+** parse it again, and return the value of the start symbol and the
+** first error, as ParseAll() would for the whole document.  The tokens
+** of the first call, with start and end 0, are those of a ParseLexer,
+** up to and including the end of input, as ParseTokens() returns them.
+** An edit out of the range of the tokens, or a code that is not a
+** terminal, is an error, and the document is left as it was.
+ */
+func (inc *ParseIncremental) Edit(start, end int, tokens ...ParseToken) (ParseRESULTTYPE, error) {
+	var yyzero ParseRESULTTYPE
+	if start < 0 || end < start || end > len(inc.yytokens) {
+		return yyzero, fmt.Errorf("cannot replace tokens %d to %d of %d", start, end, len(inc.yytokens))
+	}
+	for i := range tokens {
+		if int(tokens[i].Major) >= YYNTOKEN {
+			return yyzero, &ParseError{Loc: tokens[i].Loc, Token: tokens[i].Major,
+				Msg: fmt.Sprintf("token code %d is not a terminal", tokens[i].Major)}
+		}
+	}
+	yypParser := inc.yyparser
+	yyold, yyoldsteps, yyolddiags := inc.yytokens, inc.yysteps, yypParser.yydiags
+	yyshift := len(tokens) - (end - start) /* The new index of a token after the edit, less the old */
+	inc.yytokens = make([]ParseToken, 0, len(yyold)+yyshift)
+	inc.yytokens = append(inc.yytokens, yyold[:start]...)
+	inc.yytokens = append(inc.yytokens, tokens...)
+	inc.yytokens = append(inc.yytokens, yyold[end:]...)
+	inc.yyparsed = 0
+
+	/* Start again after the last token before the edit at which the
+	 ** parser was clean */
+	k := start
+	if k >= len(yyoldsteps) {
+		k = len(yyoldsteps) - 1
+	}
+	for !yyoldsteps[k].clean {
+		k--
+	}
+	yypParser.yy_restart(yyoldsteps, k, yyolddiags)
+	inc.yysteps = yyoldsteps[: k+1 : k+1]
+
+	/* Below yyfloor, the stacks of the two parses are those of the
+	 ** restart */
+	yyfloor := yyoldsteps[k].top() + 1
+	for j := k + 1; j <= end && j < len(yyoldsteps); j++ {
+		if yyoldsteps[j].low < yyfloor {
+			yyfloor = yyoldsteps[j].low
+		}
+	}
+	yyconverged := -1 /* The old step with which the parse converged */
+	for i := k; i < len(inc.yytokens) && yypParser.yystatus == YYSTATUS_PARSING; i++ {
+		inc.yy_take(i)
+		s := &inc.yysteps[i+1]
+		if s.low < yyfloor {
+			yyfloor = s.low
+		}
+		if j := i + 1 - yyshift; i >= start+len(tokens) && j < len(yyoldsteps) {
+			if yyoldsteps[j].low < yyfloor {
+				yyfloor = yyoldsteps[j].low
+			}
+			if s.clean && yyoldsteps[j].clean && s.errcnt == yyoldsteps[j].errcnt &&
+				yypParser.yy_same_stack(yyoldsteps, j, yyfloor) {
+				yyconverged = j
+				break
+			}
+		}
+	}
+	if yyconverged >= 0 {
+		inc.yy_converge(yyoldsteps, yyolddiags, yyconverged, yyshift, yyfloor)
+	}
+	return inc.yy_result()
+}
+
+/*
+** Go on with a parse that has converged with the last, whose steps were
+** yyoldsteps, after the old step k.  The entries of the stack from
+** yystale up to yytop may hold values built again, which the last parse
+** did not have: every step that changes one of them is taken again by
+** the parser, and so is the last.  The steps between are copied, with
+** the entries above yytop that they leave on the stack.
+ */
+func (inc *ParseIncremental) yy_converge(yyoldsteps []yyStep, yyolddiags []ParseDiagnostic, k, yyshift, yystale int) {
+	yypParser := inc.yyparser
+	yytop := yyoldsteps[k].top()
+	if yytop < yystale {
+		yytop = -1
+	}
+	for yypParser.yystatus == YYSTATUS_PARSING && k+1 < len(yyoldsteps) {
+		/* Find the next step to take again, and copy the steps up to the
+		 ** last clean one before it */
+		t := k + 1
+		for t+1 < len(yyoldsteps) && yyoldsteps[t].low > yytop {
+			t++
+		}
+		c := t - 1
+		for c > k && !yyoldsteps[c].clean {
+			c--
+		}
+		if c > k {
+			/* The syntax errors since the last clean step may have been
+			 ** recovered from in the steps copied, so they are copied too */
+			q := k
+			for !yyoldsteps[q].clean {
+				q--
+			}
+			yydelta := len(yypParser.yydiags) - yyoldsteps[k].ndiags
+			yypParser.yydiags = append(yypParser.yydiags[:yyoldsteps[q].ndiags+yydelta],
+				yyolddiags[yyoldsteps[q].ndiags:yyoldsteps[c].ndiags]...)
+			for j := k + 1; j <= c; j++ {
+				s := yyoldsteps[j]
+				s.ndiags += yydelta
+				inc.yysteps = append(inc.yysteps, s)
+			}
+			yypParser.yy_rebuild(yyoldsteps, c, yytop+1)
+			yypParser.yyerrcnt = yyoldsteps[c].errcnt
+			yypParser.yyheld = yyToken{major: YYNOCODE}
+			yypParser.yysyncing = false
+			k = c
+		}
+		for ; k < t && yypParser.yystatus == YYSTATUS_PARSING; k++ {
+			inc.yy_take(k + yyshift)
+			s := &inc.yysteps[len(inc.yysteps)-1]
+			if s.low <= yytop {
+				/* The entry at low, if the token changed it, may have
+				 ** taken in a value built again; those above are new */
+				if s.low < yystale {
+					yystale = s.low
+				}
+				yytop = s.low
+				if s.low > s.top() {
+					yytop--
+				}
+				if yytop < yystale {
+					yytop = -1
+				}
+			}
+		}
+	}
+	for i := len(inc.yysteps) - 1; i < len(inc.yytokens) && yypParser.yystatus == YYSTATUS_PARSING; i++ {
+		inc.yy_take(i)
+	}
+}
+
+/* Return the value of the start symbol, and the first error, after an
+** Edit() */
+func (inc *ParseIncremental) yy_result() (ParseRESULTTYPE, error) {
+	var result ParseRESULTTYPE
+	var firstErr error
+	yypParser := inc.yyparser
+	if len(yypParser.yydiags) > 0 {
+		d := yypParser.yydiags[0]
+		firstErr = yy_parse_error(d.Token, d.Loc, "syntax error")
+	}
+	var last ParseToken
+	if n := len(inc.yysteps) - 1; n > 0 {
+		last = inc.yytokens[n-1]
+	}
+	switch yypParser.yystatus {
+	case YYSTATUS_ACCEPTED:
+		result = yypParser.yyresult()
+	case YYSTATUS_FAILED:
+		if firstErr == nil {
+			firstErr = yy_parse_error(last.Major, last.Loc, "parse failed")
+		}
+	case YYSTATUS_OVERFLOW:
+		return result, yy_parse_error(last.Major, last.Loc, "parser stack overflow")
+	default:
+		/* The tokens ended before the end of input, or error recovery
+		 ** discarded it */
+		if firstErr == nil {
+			firstErr = yy_parse_error(0, last.Loc, "syntax error")
+		}
+	}
+	return result, firstErr
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+** A lexer for the generated parser, built from the grammar's
+** %token_pattern and %skip_pattern declarations:
+**
+**     %token_pattern NUM    "[0-9]+"
+**     %token_pattern ID     "[A-Za-z_][A-Za-z_0-9]*"
+**     %token_pattern SELECT "(?i)select"
+**     %token_pattern PLUS   "\+"
+**     %skip_pattern         "[ \t\n]+|--[^\n]*"
+**
+** Each pattern is a regular expression in the syntax of Go's regexp
+** package, written as a grammar string, so it can't contain a double
+** quote; use \x22 instead.  Anchors and \b are not allowed, and neither
+** is a pattern that matches the empty string.  A token may have several
+** patterns.
+**
+** The patterns are compiled into one DFA over runes, whose tables are
+** written to the parser with emit_table(), and ParseNewLexer(input)
+** returns a ParseLexer for ParseAll() that runs it.  At each point the
+** lexer takes the longest match.  Where patterns of different tokens
+** match the same longest text:
+**
+**   *  A keyword wins.  A keyword is a pattern that matches only one
+**      string, perhaps ignoring case, as "(?i)select" and "\+" do, so
+**      "select" is SELECT but "selection" is ID.  Two keywords of
+**      different tokens that match the same text are an error.
+**
+**   *  Otherwise, the pattern declared first wins.
+**
+** A keyword that can also be read as another token is best given that
+** token as its %fallback, so that the parser takes it as, say, an ID
+** where the keyword would be a syntax error.
+**
+** The text matched by %skip_pattern is skipped, and the lexer's Trivia()
+** method gives the text skipped before each token.  The value of a token
+** is its text if %token_type is string, and otherwise the zero value,
+** unless the lexer's Value function is set.
+ */
+
+/* A %token_pattern or %skip_pattern declaration */
+type lexrule struct {
+	sp       *symbol        /* The token, or nil for %skip_pattern */
+	re       string         /* The regular expression, as written */
+	parsed   *syntax.Regexp /* The regular expression, parsed and simplified */
+	keyword  bool           /* True if it matches only one string */
+	filename string         /* File of the declaration */
+	lineno   int            /* Line of the declaration */
+}
+
+/* A state of the NFA.  It has at most one labelled edge. */
+type nfastate struct {
+	ranges []rune /* Pairs lo, hi of the runes on the labelled edge */
+	next   int    /* Target of the labelled edge, or -1 */
+	eps    []int  /* Targets of the empty edges */
+	accept int    /* 1 + index of the pattern matched here, or 0 */
+}
+
+/* A nondeterministic finite automaton */
+type nfa struct {
+	states []nfastate
+}
+
+/* Add a state and return its number */
+func (n *nfa) add() int {
+	n.states = append(n.states, nfastate{next: -1})
+	return len(n.states) - 1
+}
+
+/* Add states that match re, and return the first and the last */
+func (n *nfa) build(re *syntax.Regexp) (int, int, error) {
+	switch re.Op {
+	case syntax.OpNoMatch, syntax.OpEmptyMatch:
+		s, e := n.add(), n.add()
+		if re.Op == syntax.OpEmptyMatch {
+			n.states[s].eps = append(n.states[s].eps, e)
+		}
+		return s, e, nil
+	case syntax.OpLiteral:
+		s := n.add()
+		e := s
+		for _, r := range re.Rune {
+			next := n.add()
+			n.states[e].ranges = fold_ranges(r, re.Flags&syntax.FoldCase != 0)
+			n.states[e].next = next
+			e = next
+		}
+		return s, e, nil
+	case syntax.OpCharClass, syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		s, e := n.add(), n.add()
+		switch re.Op {
+		case syntax.OpCharClass:
+			n.states[s].ranges = append([]rune{}, re.Rune...)
+		case syntax.OpAnyCharNotNL:
+			n.states[s].ranges = []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune}
+		default:
+			n.states[s].ranges = []rune{0, unicode.MaxRune}
+		}
+		n.states[s].next = e
+		return s, e, nil
+	case syntax.OpCapture:
+		return n.build(re.Sub[0])
+	case syntax.OpConcat:
+		s := n.add()
+		e := s
+		for _, sub := range re.Sub {
+			ss, se, err := n.build(sub)
+			if err != nil {
+				return 0, 0, err
+			}
+			n.states[e].eps = append(n.states[e].eps, ss)
+			e = se
+		}
+		return s, e, nil
+	case syntax.OpAlternate:
+		s, e := n.add(), n.add()
+		for _, sub := range re.Sub {
+			ss, se, err := n.build(sub)
+			if err != nil {
+				return 0, 0, err
+			}
+			n.states[s].eps = append(n.states[s].eps, ss)
+			n.states[se].eps = append(n.states[se].eps, e)
+		}
+		return s, e, nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		s, e := n.add(), n.add()
+		ss, se, err := n.build(re.Sub[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		n.states[s].eps = append(n.states[s].eps, ss)
+		n.states[se].eps = append(n.states[se].eps, e)
+		if re.Op != syntax.OpPlus {
+			n.states[s].eps = append(n.states[s].eps, e)
+		}
+		if re.Op != syntax.OpQuest {
+			n.states[se].eps = append(n.states[se].eps, ss)
+		}
+		return s, e, nil
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return 0, 0, fmt.Errorf("anchors such as \"%s\" are not allowed", re)
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return 0, 0, fmt.Errorf("\"%s\" is not allowed", re)
+	}
+	return 0, 0, fmt.Errorf("\"%s\" is not supported", re)
+}
+
+/* Return the ranges matching r, and the other cases of r if fold */
+func fold_ranges(r rune, fold bool) []rune {
+	runes := []rune{r}
+	if fold {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			runes = append(runes, f)
+		}
+		sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	}
+	var ranges []rune
+	for _, c := range runes {
+		ranges = append(ranges, c, c)
+	}
+	return ranges
+}
+
+/* Add to set the states reachable from s by empty edges */
+func (n *nfa) closure(s int, set map[int]bool) {
+	if set[s] {
+		return
+	}
+	set[s] = true
+	for _, t := range n.states[s].eps {
+		n.closure(t, set)
+	}
+}
+
+/* Report whether re matches only one string, perhaps ignoring case */
+func is_keyword(re *syntax.Regexp) bool {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	return re.Op == syntax.OpLiteral
+}
+
+/* Parse and check the pattern of a %token_pattern or %skip_pattern
+** declaration, and add it to the grammar */
+func pattern_add(psp *pstate, sp *symbol, re string) {
+	parsed, err := syntax.Parse(re, syntax.Perl)
+	if err == nil {
+		parsed = parsed.Simplify()
+		var n nfa
+		var s, e int
+		if s, e, err = n.build(parsed); err == nil {
+			set := make(map[int]bool)
+			n.closure(s, set)
+			if set[e] {
+				err = fmt.Errorf("it matches the empty string")
+			}
+		}
+	}
+	if err != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "Bad pattern \"%s\": %v", re, err)
+		psp.errorcnt++
+		return
+	}
+	psp.gp.patterns = append(psp.gp.patterns, &lexrule{
+		sp: sp, re: re, parsed: parsed, keyword: sp != nil && is_keyword(parsed),
+		filename: psp.filename, lineno: psp.tokenlineno,
+	})
+}
+
+/* The DFA of the lexer.  State 0 is the start state. */
+type lexdfa struct {
+	accept []int  /* For each state, the code of its token, -1 to skip, 0 for none */
+	first  []int  /* For each state, its first edge; then the number of edges */
+	lo, hi []rune /* For each edge, the range of runes on it */
+	next   []int  /* For each edge, the state it goes to */
+}
+
+/* Build the lexer's DFA from the patterns of the grammar.  Return false
+** if two keywords match the same text. */
+func lexer_build(lemp *lemon) (*lexdfa, bool) {
+	var n nfa
+	start := n.add()
+	for i, p := range lemp.patterns {
+		s, e, _ := n.build(p.parsed)
+		n.states[start].eps = append(n.states[start].eps, s)
+		n.states[e].accept = i + 1
+	}
+
+	/* The pattern that wins, if several match the same text */
+	better := func(a, b int) bool {
+		pa, pb := lemp.patterns[a-1], lemp.patterns[b-1]
+		if pa.keyword != pb.keyword {
+			return pa.keyword
+		}
+		return a < b
+	}
+
+	dfa := &lexdfa{}
+	ok := true
+	var sets [][]int
+	index := make(map[string]int)
+	/* Return the DFA state for a set of NFA states, adding it if new */
+	state := func(set map[int]bool) int {
+		members := make([]int, 0, len(set))
+		for s := range set {
+			members = append(members, s)
+		}
+		sort.Ints(members)
+		key := fmt.Sprint(members)
+		if d, ok := index[key]; ok {
+			return d
+		}
+		index[key] = len(sets)
+		sets = append(sets, members)
+		return len(sets) - 1
+	}
+	set := make(map[int]bool)
+	n.closure(start, set)
+	state(set)
+
+	for d := 0; d < len(sets); d++ {
+		/* The token accepted */
+		best := 0
+		for _, s := range sets[d] {
+			a := n.states[s].accept
+			if a == 0 {
+				continue
+			}
+			if best != 0 && lemp.patterns[a-1].keyword && lemp.patterns[best-1].keyword &&
+				lemp.patterns[a-1].sp != lemp.patterns[best-1].sp {
+				pa, pb := lemp.patterns[best-1], lemp.patterns[a-1]
+				ErrorMsg(pb.filename, pb.lineno,
+					"Patterns \"%s\" of %s and \"%s\" of %s match the same text.",
+					pa.re, pa.sp.name, pb.re, pb.sp.name)
+				lemp.errorcnt++
+				ok = false
+			}
+			if best == 0 || better(a, best) {
+				best = a
+			}
+		}
+		switch {
+		case best == 0:
+			dfa.accept = append(dfa.accept, 0)
+		case lemp.patterns[best-1].sp == nil:
+			dfa.accept = append(dfa.accept, -1)
+		default:
+			dfa.accept = append(dfa.accept, lemp.patterns[best-1].sp.index)
+		}
+
+		/* Split the runes on the edges into ranges that go to the same
+		** NFA states */
+		var bounds []rune
+		for _, s := range sets[d] {
+			r := n.states[s].ranges
+			for i := 0; i < len(r); i += 2 {
+				bounds = append(bounds, r[i], r[i+1]+1)
+			}
+		}
+		sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+		dfa.first = append(dfa.first, len(dfa.next))
+		for i := 0; i+1 < len(bounds); i++ {
+			lo, hi := bounds[i], bounds[i+1]-1
+			if lo > hi {
+				continue
+			}
+			target := make(map[int]bool)
+			for _, s := range sets[d] {
+				r := n.states[s].ranges
+				for k := 0; k < len(r); k += 2 {
+					if r[k] <= lo && hi <= r[k+1] {
+						n.closure(n.states[s].next, target)
+						break
+					}
+				}
+			}
+			if len(target) == 0 {
+				continue
+			}
+			t := state(target)
+			if e := len(dfa.next) - 1; e >= dfa.first[d] && dfa.next[e] == t && dfa.hi[e]+1 == lo {
+				dfa.hi[e] = hi
+				continue
+			}
+			dfa.lo = append(dfa.lo, lo)
+			dfa.hi = append(dfa.hi, hi)
+			dfa.next = append(dfa.next, t)
+		}
+	}
+	dfa.first = append(dfa.first, len(dfa.next))
+	return dfa, ok
+}
+
+/* Write the lexer's tables and code to out, after the rest of the
+** parser */
+func lexer_output(out *os.File, lemp *lemon, lineno *int) {
+	dfa, ok := lexer_build(lemp)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(out, "\n/* Tables of the DFA of the lexer, from %%token_pattern and %%skip_pattern */\n")
+	*lineno += 2
+	table := func(name string, signed bool, values []int) {
+		mn, mx := 0, 0
+		for _, v := range values {
+			if v < mn {
+				mn = v
+			}
+			if v > mx {
+				mx = v
+			}
+		}
+		var nByte int
+		zType := minimum_size_type(mn, mx, &nByte)
+		emit_table(out, lemp, name, zType, nByte, signed || mn < 0, values, lineno)
+	}
+	runes := func(r []rune) []int {
+		values := make([]int, len(r))
+		for i, c := range r {
+			values[i] = int(c)
+		}
+		return values
+	}
+	table("yy_lex_accept", true, dfa.accept)
+	table("yy_lex_first", false, dfa.first)
+	table("yy_lex_lo", false, runes(dfa.lo))
+	table("yy_lex_hi", false, runes(dfa.hi))
+	table("yy_lex_next", false, dfa.next)
+
+	tplt_xfer(lemp.name, bufio.NewReader(strings.NewReader(lexerTemplate)), out, lineno)
+}
+
+/* The code of the lexer.  "Parse" at the start of a word is replaced by
+** the %name of the parser. */
+const lexerTemplate = `
+/* A lexer generated from the %token_pattern and %skip_pattern
+** declarations of the grammar, which implements ParseLexer.  Value, if
+** not nil, gives the value of each token from its code and text.
+** Otherwise the value is the text if ParseTOKENTYPE is string, and the
+** zero value if not.
+ */
+type yyLexer struct {
+	input  string
+	pos    int /* Byte offset of the next token */
+	line   int /* Line of the next token */
+	column int    /* Column of the next token, in runes */
+	trivia string /* Text skipped before the last token */
+	Value  func(major YYCODETYPE, text string) ParseTOKENTYPE
+}
+
+/* Return a lexer that reads the tokens of input */
+func ParseNewLexer(input string) *yyLexer {
+	return &yyLexer{input: input, line: 1, column: 1}
+}
+
+/* Return the rune at the start of s, which is not empty, and its length
+** in bytes.  An invalid byte is returned as utf8.RuneError, of length 1. */
+func yy_lex_rune(s string) (rune, int) {
+	var r rune
+	for i, c := range s {
+		if i > 0 {
+			return r, i
+		}
+		r = c
+	}
+	return r, len(s)
+}
+
+/* Return the state of the DFA after state on the rune r, or -1 */
+func yy_lex_move(state int, r rune) int {
+	lo, hi := int(yy_lex_first_at(state)), int(yy_lex_first_at(state+1))
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if r < rune(yy_lex_lo_at(mid)) {
+			hi = mid
+		} else if r > rune(yy_lex_hi_at(mid)) {
+			lo = mid + 1
+		} else {
+			return int(yy_lex_next_at(mid))
+		}
+	}
+	return -1
+}
+
+/* Return the code, value and location of the next token.  Return the
+** code 0 at the end of input, and a *ParseError, with the Token
+** YYNOCODE, where no pattern matches. */
+func (l *yyLexer) Next() (YYCODETYPE, ParseTOKENTYPE, ParseLocation, error) {
+	var minor ParseTOKENTYPE
+	start := l.pos
+	for {
+		loc := ParseLocation{Offset: l.pos, Line: l.line, Column: l.column}
+		l.trivia = l.input[start:l.pos]
+		if l.pos >= len(l.input) {
+			return 0, minor, loc, nil
+		}
+		/* Find the longest match */
+		state, accept, end := 0, 0, l.pos
+		for i := l.pos; i < len(l.input); {
+			r, size := yy_lex_rune(l.input[i:])
+			if state = yy_lex_move(state, r); state < 0 {
+				break
+			}
+			i += size
+			if a := int(yy_lex_accept_at(state)); a != 0 {
+				accept, end = a, i
+			}
+		}
+		if accept == 0 {
+			r, _ := yy_lex_rune(l.input[l.pos:])
+			return YYNOCODE, minor, loc, &ParseError{Loc: loc, Token: YYNOCODE,
+				Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+		text := l.input[l.pos:end]
+		for _, r := range text {
+			if r == '\n' {
+				l.line++
+				l.column = 1
+			} else {
+				l.column++
+			}
+		}
+		l.pos = end
+		if accept < 0 {
+			continue
+		}
+		major := YYCODETYPE(accept)
+		if l.Value != nil {
+			minor = l.Value(major, text)
+		} else if v, ok := interface{}(text).(ParseTOKENTYPE); ok {
+			minor = v
+		}
+		return major, minor, loc, nil
+	}
+}
+
+/* Return the text of %skip_pattern skipped before the token that Next()
+** last returned, which implements ParseTrivia. */
+func (l *yyLexer) Trivia() string {
+	return l.trivia
+}
+`
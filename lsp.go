@@ -0,0 +1,1372 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+/*
+** A language server for grammar files:
+**
+**     golemon lsp [-I DIR] [-D NAME[=VALUE]] [-script FILE]
+**
+** The server speaks JSON-RPC 2.0 on standard input and output, framed
+** with Content-Length headers as the Language Server Protocol requires.
+** Each time a grammar is opened, changed or saved it is run through
+** Parse() and the analysis passes up to FindActions(), as the generator
+** would run them, and the results are kept until the next change.  The
+** server offers:
+**
+**   *  Diagnostics: every message passed to ErrorMsg(), each parsing
+**      conflict, and warnings for nonterminals that are unreachable or
+**      can never match anything, and for terminals declared but unused.
+**   *  Go to definition and find references for symbols, aliases and
+**      macros.  A nonterminal is defined by the left-hand sides of its
+**      rules, a terminal by %token (or its first use), and an alias by
+**      its appearance in the rule.  Uses of an alias are found in the
+**      rule's action, just as translate_code() finds them.
+**   *  Hover, showing a symbol's %type, precedence, first set and the
+**      rules it appears in.
+**   *  Renaming nonterminals, across every file of the grammar, and
+**      aliases, within their rule.
+**   *  Completion of the names of declarations and preprocessor
+**      directives after "%".
+**
+** Files named by %include_file and %import are read from disk, and the
+** diagnostics for such a file come from the open grammar that includes
+** it.  Names are found in the text with next_token() and the statement
+** boundaries that "golemon fmt" uses.
+**
+** With -script, the server is run in-process instead, connected by
+** pipes to lspharness, and the messages in FILE (one JSON-RPC message
+** per line, without headers) are sent to it in turn.  Every message the
+** server sends back is printed, one per line.  A request is answered
+** before the next line is sent, so the output is repeatable.
+ */
+
+/* Kinds of name found in a grammar */
+const (
+	OCC_SYMBOL = iota /* A terminal or nonterminal */
+	OCC_ALIAS         /* An alias in a rule, or its use in the rule's action */
+	OCC_MACRO         /* The name of a %macro */
+)
+
+/* LSP diagnostic severities */
+const (
+	LSP_ERROR   = 1
+	LSP_WARNING = 2
+)
+
+/* JSON-RPC error codes */
+const (
+	LSP_METHOD_NOT_FOUND = -32601
+	LSP_INVALID_PARAMS   = -32602
+	LSP_REQUEST_FAILED   = -32803
+)
+
+/* Names that may follow "%" at the start of a declaration */
+var lspDirectives = []string{
+	"code", "copy", "default_copy", "default_destructor", "default_type",
+	"destructor", "extra_argument", "extra_context", "fallback", "import",
+	"include", "include_file", "left", "macro", "name", "nonassoc",
+	"parse_accept", "parse_failure", "right", "skip_pattern",
+	"stack_overflow", "stack_size", "start_symbol", "sync", "syntax_error",
+	"token", "token_class", "token_copy", "token_destructor",
+	"token_pattern", "token_prefix", "token_type", "type", "wildcard",
+}
+
+/* Names that may follow "%" at the start of a line, for the preprocessor */
+var lspPreprocessorDirectives = []string{"define", "elif", "else", "endif", "if", "ifdef", "ifndef"}
+
+/* A JSON-RPC message: a request, a response or a notification */
+type lspmessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lsperror       `json:"error,omitempty"`
+}
+
+/* The error in a response */
+type lsperror struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lsperror) Error() string { return e.Message }
+
+type lspposition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lsprange struct {
+	Start lspposition `json:"start"`
+	End   lspposition `json:"end"`
+}
+
+type lsplocation struct {
+	URI   string   `json:"uri"`
+	Range lsprange `json:"range"`
+}
+
+type lspdiagnostic struct {
+	Range    lsprange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lsptextedit struct {
+	Range   lsprange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+/* The parameters of the requests and notifications the server handles */
+type lspparams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Position lspposition `json:"position"`
+	Context  struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+	NewName string `json:"newName"`
+}
+
+/* One end of a JSON-RPC connection */
+type lspconn struct {
+	in  *bufio.Reader
+	out io.Writer
+	mu  sync.Mutex /* Serialises writes */
+}
+
+/* Read the next message.  Return io.EOF at the end of the input. */
+func (c *lspconn) read() (*lspmessage, error) {
+	length := -1
+	for {
+		line, err := c.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if i := strings.Index(line, ":"); i >= 0 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil {
+				return nil, fmt.Errorf("bad Content-Length header: %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without a Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.in, body); err != nil {
+		return nil, err
+	}
+	var msg lspmessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("bad message: %v", err)
+	}
+	return &msg, nil
+}
+
+/* Write a message, which is any value that encodes as one */
+func (c *lspconn) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+/* A grammar file known to the server */
+type lspfile struct {
+	uri   string
+	path  string
+	text  []rune
+	lines []int /* Offset of the start of each line */
+}
+
+func lsp_newfile(uri string, path string, text string) *lspfile {
+	f := &lspfile{uri: uri, path: path, text: []rune(text), lines: []int{0}}
+	for i, c := range f.text {
+		if c == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+	return f
+}
+
+/* Convert an offset in the text to a position, counting UTF-16 units */
+func (f *lspfile) position(offset int) lspposition {
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	n := 0
+	for _, c := range f.text[f.lines[line]:offset] {
+		n += utf16.RuneLen(c)
+	}
+	return lspposition{Line: line, Character: n}
+}
+
+/* Convert a position to an offset in the text */
+func (f *lspfile) offset(pos lspposition) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(f.lines) {
+		return len(f.text)
+	}
+	i, n := f.lines[pos.Line], 0
+	for i < len(f.text) && f.text[i] != '\n' && n < pos.Character {
+		n += utf16.RuneLen(f.text[i])
+		i++
+	}
+	return i
+}
+
+func (f *lspfile) span(start int, end int) lsprange {
+	return lsprange{f.position(start), f.position(end)}
+}
+
+/* The range of the text on a line, numbered from 1 as in ErrorMsg() */
+func (f *lspfile) lineRange(lineno int) lsprange {
+	if lineno < 1 {
+		lineno = 1
+	}
+	if lineno > len(f.lines) {
+		lineno = len(f.lines)
+	}
+	start := f.lines[lineno-1]
+	end := start
+	for end < len(f.text) && f.text[end] != '\n' {
+		end++
+	}
+	for start < end && (f.text[start] == ' ' || f.text[start] == '\t') {
+		start++
+	}
+	for end > start && (f.text[end-1] == ' ' || f.text[end-1] == '\t' || f.text[end-1] == '\r') {
+		end--
+	}
+	return f.span(start, end)
+}
+
+/* One appearance of a name in a grammar */
+type lspocc struct {
+	file  *lspfile
+	start int /* Offset of the name in file.text */
+	end   int /* Offset just past the name */
+	name  string
+	kind  int  /* OCC_* */
+	def   bool /* True if this defines the name, false for a use */
+	scope int  /* For an alias, a number identifying its rule */
+	line  int  /* For an alias, the line of the "." ending its rule */
+}
+
+/* The result of running one grammar through the generator */
+type lspanalysis struct {
+	uri     string
+	lem     *lemon
+	files   []*lspfile                 /* The grammar and every file it reads */
+	bykey   map[string]*lspfile        /* The same, by include_key() */
+	symbols map[string]*symbol         /* Every symbol, by name */
+	diags   map[string][]lspdiagnostic /* Diagnostics, by URI */
+	occs    []lspocc                   /* Every name in the files */
+	actions map[int]string             /* The action of each rule, by scope */
+}
+
+/* Thrown in place of exiting after a fatal error in the grammar */
+type lspexit struct{}
+
+func lsp_path(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return uri
+}
+
+func lsp_uri(path string) string {
+	if p, err := filepath.Abs(path); err == nil {
+		path = p
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+/* Record a diagnostic at a line of a file, numbered from 1 */
+func (a *lspanalysis) diagnose(filename string, lineno int, severity int, msg string) {
+	f := a.bykey[include_key(filename)]
+	if f == nil {
+		f, lineno = a.files[0], 1
+	}
+	d := lspdiagnostic{Range: f.lineRange(lineno), Severity: severity, Source: "golemon", Message: strings.TrimSpace(msg)}
+	a.diags[f.uri] = append(a.diags[f.uri], d)
+}
+
+/* Add a file to the analysis.  The text of the grammar itself is given;
+** other files are read from disk. */
+func (a *lspanalysis) addfile(path string, text *string) *lspfile {
+	key := include_key(path)
+	if f := a.bykey[key]; f != nil {
+		return f
+	}
+	var data string
+	if text != nil {
+		data = *text
+	} else if b, err := os.ReadFile(path); err == nil {
+		data = string(b)
+	}
+	uri := a.uri
+	if text == nil {
+		uri = lsp_uri(path)
+	}
+	f := lsp_newfile(uri, path, data)
+	a.files = append(a.files, f)
+	a.bykey[key] = f
+	return f
+}
+
+/* Run the grammar in the document uri, whose text is given, through the
+** parser and the analysis passes */
+func lsp_analyze(uri string, text string) *lspanalysis {
+	a := &lspanalysis{
+		uri:     uri,
+		lem:     &lemon{filename: lsp_path(uri), source: []byte(text)},
+		bykey:   make(map[string]*lspfile),
+		symbols: make(map[string]*symbol),
+		diags:   make(map[string][]lspdiagnostic),
+		actions: make(map[int]string),
+	}
+	a.addfile(a.lem.filename, &text)
+	ok := a.run()
+	a.index()
+	if ok {
+		a.lint()
+	}
+	return a
+}
+
+/* Parse the grammar and find its states, collecting errors as
+** diagnostics rather than printing them.  Return true if the passes
+** all ran. */
+func (a *lspanalysis) run() (ok bool) {
+	lem := a.lem
+	var errs [][3]interface{}
+	errorHook = func(filename string, lineno int, msg string) {
+		errs = append(errs, [3]interface{}{filename, lineno, msg})
+	}
+	exitHook = func(status int) { panic(lspexit{}) }
+	defer func() {
+		errorHook, exitHook = nil, nil
+		if r := recover(); r != nil {
+			if _, exited := r.(lspexit); !exited {
+				errs = append(errs, [3]interface{}{lem.filename, 0, fmt.Sprintf("Internal error: %v", r)})
+			} else if len(errs) == 0 {
+				errs = append(errs, [3]interface{}{lem.filename, 0, "Internal error: an assertion failed."})
+			}
+			ok = false
+		}
+		if len(lem.files) == 0 {
+			lem.files = []string{lem.filename}
+		}
+		/* The files must be known before the errors in them are placed */
+		for _, name := range lem.files[1:] {
+			a.addfile(name, nil)
+		}
+		for _, e := range errs {
+			a.diagnose(e[0].(string), e[1].(int), LSP_ERROR, e[2].(string))
+		}
+	}()
+
+	/* Start from the state of a fresh process */
+	ppDefines = defines{}
+	x2a, x2a_keys, x3a, x4a = nil, nil, nil, nil
+	actionIndex = 0
+	Symbol_init()
+	State_init()
+	Symbol_new("$")
+	Parse(lem)
+	for _, sp := range Symbol_arrayof() {
+		a.symbols[sp.name] = sp
+	}
+	if lem.errorcnt > 0 {
+		return false
+	}
+	if lem.nrule == 0 {
+		errs = append(errs, [3]interface{}{lem.filename, 0, "Empty grammar."})
+		return false
+	}
+	index_grammar(lem)
+	FindRulePrecedences(lem)
+	FindFirstSets(lem)
+	lem.nstate = 0
+	FindStates(lem)
+	lem.sorted = State_arrayof()
+	FindLinks(lem)
+	FindFollowSets(lem)
+	FindActions(lem)
+	CompressTables(lem)
+	ResortStates(lem)
+	for rp := lem.rule; rp != nil; rp = rp.next {
+		translate_code(lem, rp) /* For its checks on aliases */
+	}
+	a.conflicts()
+	return true
+}
+
+/* Report each parsing conflict at the rules involved */
+func (a *lspanalysis) conflicts() {
+	lem := a.lem
+	seen := make(map[string]bool)
+	report := func(rp *rule, msg string) {
+		key := fmt.Sprintf("%s:%d: %s", rp.filename, rp.ruleline, msg)
+		if !seen[key] {
+			seen[key] = true
+			a.diagnose(rp.filename, rp.ruleline, LSP_ERROR, msg)
+		}
+	}
+	for i := 0; i < lem.nstate; i++ {
+		stp := lem.sorted[i]
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			if ap.typ != SSCONFLICT && ap.typ != SRCONFLICT && ap.typ != RRCONFLICT {
+				continue
+			}
+			/* Find the action that this one conflicts with */
+			var other *action
+			for op := stp.ap; op != nil && op != ap; op = op.next {
+				if op.sp == ap.sp {
+					other = op
+				}
+			}
+			var sb strings.Builder
+			switch ap.typ {
+			case SSCONFLICT:
+				rule_print(&sb, stp.bp.rp)
+				report(stp.bp.rp, fmt.Sprintf("Parsing conflict (shift/shift) on %s in state %d, after \"%s.\"", ap.sp.name, stp.statenum, sb.String()))
+			case SRCONFLICT:
+				rule_print(&sb, ap.x.rp)
+				report(ap.x.rp, fmt.Sprintf("Parsing conflict (shift/reduce) on %s in state %d: \"%s.\" could be reduced, or %s shifted.", ap.sp.name, stp.statenum, sb.String(), ap.sp.name))
+			case RRCONFLICT:
+				rule_print(&sb, ap.x.rp)
+				msg := fmt.Sprintf("Parsing conflict (reduce/reduce) on %s in state %d: \"%s.\"", ap.sp.name, stp.statenum, sb.String())
+				if other != nil && (other.typ == REDUCE || other.typ == RRCONFLICT) {
+					var sb2 strings.Builder
+					rule_print(&sb2, other.x.rp)
+					msg += fmt.Sprintf(" or \"%s.\"", sb2.String())
+					report(other.x.rp, msg+" could be reduced.")
+				}
+				report(ap.x.rp, msg+" could be reduced.")
+			}
+		}
+	}
+}
+
+/* Warn about nonterminals that can never match anything, and terminals
+** declared but never used.  Unreachable rules need no warning: they
+** can't be reduced, which FindActions() reports as an error. */
+func (a *lspanalysis) lint() {
+	lem := a.lem
+	first := make(map[*symbol]*rule) /* The first rule of each nonterminal */
+	used := make(map[*symbol]bool)
+	for rp := lem.rule; rp != nil; rp = rp.next {
+		if r := first[rp.lhs]; r == nil || rp.index < r.index {
+			first[rp.lhs] = rp
+		}
+		for _, sp := range rp.rhs {
+			used[sp] = true
+			for _, ss := range sp.subsym {
+				used[ss] = true
+			}
+		}
+		if rp.precsym != nil {
+			used[rp.precsym] = true
+		}
+	}
+
+	/* Nonterminals that derive some string of terminals */
+	productive := make(map[*symbol]bool)
+	for changed := true; changed; {
+		changed = false
+		for rp := lem.rule; rp != nil; rp = rp.next {
+			if productive[rp.lhs] {
+				continue
+			}
+			ok := true
+			for _, sp := range rp.rhs {
+				if sp.typ == NONTERMINAL && !productive[sp] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				productive[rp.lhs] = true
+				changed = true
+			}
+		}
+	}
+
+	for i := 1; i < lem.nsymbol; i++ {
+		sp := lem.symbols[i]
+		switch {
+		case sp.typ == NONTERMINAL && first[sp] != nil && !productive[sp]:
+			rp := first[sp]
+			a.diagnose(rp.filename, rp.ruleline, LSP_WARNING,
+				fmt.Sprintf("Nonterminal \"%s\" can never match any input: each of its rules needs another \"%s\".", sp.name, sp.name))
+		case sp.typ == TERMINAL && !used[sp] && sp != lem.errsym && sp != lem.wildcard && sp.fallback == nil:
+			for _, o := range a.occs {
+				if o.kind == OCC_SYMBOL && o.def && o.name == sp.name {
+					a.diagnose(o.file.path, o.file.position(o.start).Line+1, LSP_WARNING,
+						fmt.Sprintf("Terminal \"%s\" is declared but never used in a rule.", sp.name))
+					break
+				}
+			}
+		}
+	}
+}
+
+/* Find every name in the files of the grammar.  Statements are found as
+** "golemon fmt" finds them, and within them each symbol, alias and macro
+** name is recorded. */
+func (a *lspanalysis) index() {
+	saved := errorHook
+	errorHook = func(string, int, string) {} /* Parse() has reported these */
+	defer func() { errorHook = saved }()
+
+	type stmt struct {
+		file *lspfile
+		toks []fmttoken
+	}
+	var stmts []stmt
+	macros := make(map[string]bool)
+	for _, f := range a.files {
+		toks, _ := fmt_tokenize(f.path, f.text)
+		for i := 0; i < len(toks); {
+			if toks[i].kind == TK_COMMENT || toks[i].kind == TK_PP {
+				i++
+				continue
+			}
+			end := fmt_statement_end(toks, i)
+			var sig []fmttoken
+			for _, t := range toks[i:end] {
+				if t.kind != TK_COMMENT && t.kind != TK_PP {
+					sig = append(sig, t)
+				}
+			}
+			if len(sig) > 2 && sig[0].text == "%" && sig[1].text == "macro" && sig[2].kind == TK_ID {
+				macros[sig[2].text] = true
+			}
+			stmts = append(stmts, stmt{f, sig})
+			i = end
+		}
+	}
+	for n, st := range stmts {
+		a.index_statement(st.file, st.toks, n, macros)
+	}
+	/* Lint warnings need the occurrences */
+	sort.SliceStable(a.occs, func(i, j int) bool {
+		if a.occs[i].file != a.occs[j].file {
+			return a.occs[i].file.uri < a.occs[j].file.uri
+		}
+		return a.occs[i].start < a.occs[j].start
+	})
+}
+
+/* Record the names in one declaration or rule */
+func (a *lspanalysis) index_statement(f *lspfile, toks []fmttoken, scope int, macros map[string]bool) {
+	is := func(k int, kind int, text string) bool {
+		return k < len(toks) && toks[k].kind == kind && (text == "" || toks[k].text == text)
+	}
+	add := func(t fmttoken, skip int, kind int, def bool) *lspocc {
+		if kind == OCC_SYMBOL && macros[t.text[skip:]] {
+			kind = OCC_MACRO
+		}
+		a.occs = append(a.occs, lspocc{
+			file: f, start: t.offset + skip, end: t.offset + utf8.RuneCountInString(t.text),
+			name: t.text[skip:], kind: kind, def: def, scope: scope,
+		})
+		return &a.occs[len(a.occs)-1]
+	}
+
+	if is(0, TK_OP, "%") && is(1, TK_ID, "") {
+		kw := toks[1].text
+		for k, t := range toks[2:] {
+			switch kw {
+			case "type", "destructor", "copy", "start_symbol", "token_pattern":
+				if k == 0 && t.kind == TK_ID {
+					add(t, 0, OCC_SYMBOL, false)
+				}
+			case "left", "right", "nonassoc", "token", "fallback", "wildcard", "sync", "token_class":
+				if t.kind == TK_ID {
+					add(t, 0, OCC_SYMBOL, kw == "token" || (kw == "token_class" && k == 0))
+				} else if t.kind == TK_MULTI {
+					add(t, 1, OCC_SYMBOL, false)
+				}
+			case "macro":
+				if k == 0 && t.kind == TK_ID {
+					add(t, 0, OCC_MACRO, true)
+				}
+			}
+		}
+		return
+	}
+	if !is(0, TK_ID, "") {
+		return
+	}
+
+	/* A rule.  Find the line of its "." first, to identify the rule. */
+	line := 0
+	depth := 0
+	for k, t := range toks {
+		if is(k, TK_OP, "(") {
+			depth++
+		} else if is(k, TK_OP, ")") {
+			depth--
+		} else if is(k, TK_OP, ".") && depth <= 0 {
+			line = t.lineno
+			break
+		}
+	}
+	var aliases []*lspocc
+	alias := func(t fmttoken) {
+		o := add(t, 0, OCC_ALIAS, true)
+		o.line = line
+		aliases = append(aliases, o)
+	}
+
+	add(toks[0], 0, OCC_SYMBOL, true)
+	k := 1
+	if is(1, TK_OP, "(") && is(2, TK_ID, "") && is(3, TK_OP, ")") {
+		alias(toks[2])
+		k = 4
+	}
+	if !is(k, TK_ARROW, "") {
+		return
+	}
+	depth = 0
+	for k++; k < len(toks); k++ {
+		t := toks[k]
+		switch {
+		case t.kind == TK_ID:
+			add(t, 0, OCC_SYMBOL, false)
+		case t.kind == TK_MULTI:
+			add(t, 1, OCC_SYMBOL, false)
+		case t.kind == TK_OP && t.text == "(":
+			prev := toks[k-1]
+			if is(k+1, TK_ID, "") && is(k+2, TK_OP, ")") && !macros[prev.text] &&
+				(prev.kind == TK_ID || prev.kind == TK_MULTI || (prev.kind == TK_OP && strings.Contains(")?*+", prev.text))) {
+				alias(toks[k+1])
+				k += 2
+			} else {
+				depth++
+			}
+		case t.kind == TK_OP && t.text == ")":
+			depth--
+		case t.kind == TK_OP && t.text == "[" && is(k+1, TK_ID, ""):
+			add(toks[k+1], 0, OCC_SYMBOL, false)
+			k++
+		case t.kind == TK_CODE && depth <= 0:
+			/* Uses of the aliases in the action, found as translate_code()
+			** finds them */
+			a.actions[scope] = t.text
+			code := []rune(t.text)
+			for cp := 0; cp < len(code); cp++ {
+				if !isalnum(code[cp]) || (cp > 0 && (isalnum(code[cp-1]) || code[cp-1] == '_')) {
+					continue
+				}
+				xp := cp + 1
+				for xp < len(code) && (isalnum(code[xp]) || code[xp] == '_') {
+					xp++
+				}
+				word := string(code[cp:xp])
+				for _, o := range aliases {
+					if o.name == word {
+						a.occs = append(a.occs, lspocc{file: f, start: t.offset + cp, end: t.offset + xp,
+							name: word, kind: OCC_ALIAS, scope: scope, line: line})
+						break
+					}
+				}
+				cp = xp - 1
+			}
+		}
+	}
+}
+
+/* Return the name at an offset in a file, or nil */
+func (a *lspanalysis) occurrence(f *lspfile, offset int) *lspocc {
+	for i := range a.occs {
+		o := &a.occs[i]
+		if o.file == f && o.start <= offset && offset <= o.end {
+			return o
+		}
+	}
+	return nil
+}
+
+/* Return every occurrence of the same name as o */
+func (a *lspanalysis) related(o *lspocc) []*lspocc {
+	var list []*lspocc
+	for i := range a.occs {
+		p := &a.occs[i]
+		if p.name != o.name || p.kind != o.kind || (o.kind == OCC_ALIAS && p.scope != o.scope) {
+			continue
+		}
+		list = append(list, p)
+	}
+	return list
+}
+
+/* Return the rule in which the alias o appears */
+func (a *lspanalysis) alias_rule(o *lspocc) *rule {
+	key := include_key(o.file.path)
+	for rp := a.lem.rule; rp != nil; rp = rp.next {
+		if rp.ruleline != o.line || include_key(rp.filename) != key {
+			continue
+		}
+		if rp.lhsalias == o.name {
+			return rp
+		}
+		for _, al := range rp.rhsalias {
+			if al == o.name {
+				return rp
+			}
+		}
+	}
+	return nil
+}
+
+/* The text shown when hovering over a name */
+func (a *lspanalysis) hover(o *lspocc) string {
+	var sb strings.Builder
+	lem := a.lem
+	switch o.kind {
+	case OCC_MACRO:
+		fmt.Fprintf(&sb, "**%s** (macro)", o.name)
+		return sb.String()
+	case OCC_ALIAS:
+		rp := a.alias_rule(o)
+		if rp == nil {
+			fmt.Fprintf(&sb, "**%s** (alias)", o.name)
+			return sb.String()
+		}
+		sp := rp.lhs
+		for i, al := range rp.rhsalias {
+			if al == o.name {
+				sp = rp.rhs[i]
+			}
+		}
+		var rule strings.Builder
+		rule_print(&rule, rp)
+		fmt.Fprintf(&sb, "**%s** (alias of `%s`)\n\n", o.name, ebnf_symname(sp))
+		if decl := typecheck_typedecl(lem, sp); !strings.HasSuffix(decl, "{}") {
+			fmt.Fprintf(&sb, "`%s`\n\n", decl)
+		}
+		fmt.Fprintf(&sb, "in `%s.`", rule.String())
+		return sb.String()
+	}
+
+	sp := a.symbols[o.name]
+	if sp == nil {
+		fmt.Fprintf(&sb, "**%s**", o.name)
+		return sb.String()
+	}
+	if sp.typ == NONTERMINAL {
+		fmt.Fprintf(&sb, "**%s** (nonterminal)\n\n", sp.name)
+	} else {
+		fmt.Fprintf(&sb, "**%s** (terminal)\n\n", sp.name)
+	}
+	if decl := typecheck_typedecl(lem, sp); !strings.HasSuffix(decl, "{}") {
+		fmt.Fprintf(&sb, "`%s`\n\n", decl)
+	}
+	if sp.prec >= 0 {
+		assoc := map[e_assoc]string{LEFT: "%left", RIGHT: "%right", NONE: "%nonassoc"}[sp.assoc]
+		fmt.Fprintf(&sb, "Precedence: %s, level %d\n\n", assoc, sp.prec)
+	}
+	if sp.fallback != nil {
+		fmt.Fprintf(&sb, "Falls back to: %s\n\n", sp.fallback.name)
+	}
+	if sp.typ == NONTERMINAL && sp.firstset != nil {
+		var names []string
+		for i := 0; i < lem.nterminal; i++ {
+			if sp.firstset[i] {
+				names = append(names, lem.symbols[i].name)
+			}
+		}
+		fmt.Fprintf(&sb, "First set: %s", strings.Join(names, " "))
+		if sp.lambda {
+			sb.WriteString(" (or empty)")
+		}
+		sb.WriteString("\n\n")
+	}
+
+	/* The rules in which the symbol appears, in the order of the grammar */
+	var rules []*rule
+	for rp := lem.rule; rp != nil; rp = rp.next {
+		in := rp.lhs == sp || rp.precsym == sp
+		for _, r := range rp.rhs {
+			in = in || r == sp
+			for _, ss := range r.subsym {
+				in = in || ss == sp
+			}
+		}
+		if in {
+			rules = append(rules, rp)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].index < rules[j].index })
+	if len(rules) > 0 {
+		sb.WriteString("Rules:\n")
+	}
+	for i, rp := range rules {
+		if i == 20 {
+			fmt.Fprintf(&sb, "- and %d more\n", len(rules)-i)
+			break
+		}
+		var rule strings.Builder
+		rule_print(&rule, rp)
+		fmt.Fprintf(&sb, "- `%s.` (%s:%d)\n", rule.String(), filepath.Base(rp.filename), rp.ruleline)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+var lspNonterminalRe = regexp.MustCompile(`^[a-z][A-Za-z0-9_]*$`)
+var lspAliasRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+/* Check that the name at o may be renamed to newName, if newName is not
+** "".  Return an error if not. */
+func (a *lspanalysis) check_rename(o *lspocc, newName string) *lsperror {
+	fail := func(format string, args ...interface{}) *lsperror {
+		return &lsperror{Code: LSP_REQUEST_FAILED, Message: fmt.Sprintf(format, args...)}
+	}
+	switch o.kind {
+	case OCC_SYMBOL:
+		if sp := a.symbols[o.name]; (sp != nil && sp.typ != NONTERMINAL) || !lspNonterminalRe.MatchString(o.name) {
+			return fail("Only nonterminals and aliases can be renamed.")
+		}
+		if newName == "" {
+			return nil
+		}
+		if !lspNonterminalRe.MatchString(newName) {
+			return fail("\"%s\" is not a valid name for a nonterminal.", newName)
+		}
+		if a.symbols[newName] != nil || ebnfNames[newName] {
+			return fail("\"%s\" is already the name of a symbol.", newName)
+		}
+		for _, p := range a.occs {
+			if p.kind == OCC_MACRO && p.name == newName {
+				return fail("\"%s\" is already the name of a macro.", newName)
+			}
+		}
+	case OCC_ALIAS:
+		if newName == "" {
+			return nil
+		}
+		if !lspAliasRe.MatchString(newName) {
+			return fail("\"%s\" is not a valid alias.", newName)
+		}
+		/* The new name must not be taken by another alias of the rule, nor
+		** by anything else in its action */
+		for _, p := range a.occs {
+			if p.scope == o.scope && p.kind == OCC_ALIAS && p.def && p.name == newName {
+				return fail("\"%s\" is already an alias in this rule.", newName)
+			}
+		}
+		re := regexp.MustCompile(`(^|[^A-Za-z0-9_])` + newName + `($|[^A-Za-z0-9_])`)
+		if re.MatchString(a.actions[o.scope]) {
+			return fail("\"%s\" is already used in the action of this rule.", newName)
+		}
+	default:
+		return fail("Only nonterminals and aliases can be renamed.")
+	}
+	return nil
+}
+
+/* The state of the server */
+type lspserver struct {
+	conn      *lspconn
+	docs      map[string]string       /* Text of each open document, by URI */
+	analyses  map[string]*lspanalysis /* Analysis of each open document */
+	published map[string]string       /* Diagnostics last published, as JSON, by URI */
+	shutdown  bool                    /* True once "shutdown" has been received */
+	version   string                  /* Version in serverInfo, or "" to leave it out */
+}
+
+/* Return the analysis that covers the file uri: that of an open grammar
+** that includes it, or else its own */
+func (s *lspserver) owner(uri string) *lspanalysis {
+	var uris []string
+	for u := range s.analyses {
+		uris = append(uris, u)
+	}
+	sort.Strings(uris)
+	for _, u := range uris {
+		a := s.analyses[u]
+		for _, f := range a.files[1:] {
+			if f.uri == uri {
+				return a
+			}
+		}
+	}
+	return s.analyses[uri]
+}
+
+/* Publish the diagnostics for every file that has changed */
+func (s *lspserver) publish() {
+	all := make(map[string][]lspdiagnostic)
+	for _, a := range s.analyses {
+		for _, f := range a.files {
+			if s.owner(f.uri) == a {
+				all[f.uri] = append([]lspdiagnostic{}, a.diags[f.uri]...)
+			}
+		}
+	}
+	for uri := range s.published {
+		if _, ok := all[uri]; !ok {
+			all[uri] = nil
+		}
+	}
+	var uris []string
+	for uri := range all {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		diags := all[uri]
+		if diags == nil {
+			diags = []lspdiagnostic{}
+		}
+		sort.SliceStable(diags, func(i, j int) bool { return diags[i].Range.Start.Line < diags[j].Range.Start.Line })
+		data, _ := json.Marshal(diags)
+		if old, ok := s.published[uri]; old == string(data) || (!ok && len(diags) == 0) {
+			continue
+		}
+		if len(diags) == 0 {
+			delete(s.published, uri)
+		} else {
+			s.published[uri] = string(data)
+		}
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diags})
+	}
+}
+
+func (s *lspserver) notify(method string, params interface{}) {
+	s.conn.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+/* Analyse the document uri again, and every open grammar that reads it */
+func (s *lspserver) update(uri string) {
+	var uris []string
+	for u, a := range s.analyses {
+		for _, f := range a.files[1:] {
+			if f.uri == uri {
+				uris = append(uris, u)
+			}
+		}
+	}
+	if _, ok := s.docs[uri]; ok {
+		uris = append(uris, uri)
+	}
+	for _, u := range uris {
+		s.analyses[u] = lsp_analyze(u, s.docs[u])
+	}
+	s.publish()
+}
+
+/* Find the file and the name at the position given in a request */
+func (s *lspserver) lookup(p *lspparams) (*lspanalysis, *lspocc) {
+	a := s.owner(p.TextDocument.URI)
+	if a == nil {
+		return nil, nil
+	}
+	for _, f := range a.files {
+		if f.uri == p.TextDocument.URI {
+			return a, a.occurrence(f, f.offset(p.Position))
+		}
+	}
+	return a, nil
+}
+
+/* Handle one request or notification.  Return the result of a request. */
+func (s *lspserver) handle(msg *lspmessage) (interface{}, *lsperror) {
+	var p lspparams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &lsperror{Code: LSP_INVALID_PARAMS, Message: err.Error()}
+		}
+	}
+	uri := p.TextDocument.URI
+
+	switch msg.Method {
+	case "initialize":
+		info := map[string]interface{}{"name": "golemon"}
+		if s.version != "" {
+			info["version"] = s.version
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   map[string]interface{}{"openClose": true, "change": 1, "save": true},
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"renameProvider":     map[string]interface{}{"prepareProvider": true},
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"%"}},
+			},
+			"serverInfo": info,
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[uri] = p.TextDocument.Text
+		s.update(uri)
+	case "textDocument/didChange":
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[uri] = p.ContentChanges[n-1].Text
+		}
+		s.update(uri)
+	case "textDocument/didSave":
+		s.update(uri)
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		delete(s.analyses, uri)
+		s.publish()
+
+	case "textDocument/definition", "textDocument/references":
+		a, o := s.lookup(&p)
+		locs := []lsplocation{}
+		if o == nil {
+			return locs, nil
+		}
+		related := a.related(o)
+		if msg.Method == "textDocument/definition" {
+			var defs []*lspocc
+			for _, r := range related {
+				if r.def {
+					defs = append(defs, r)
+				}
+			}
+			if len(defs) == 0 && len(related) > 0 {
+				defs = related[:1] /* A terminal is declared by its first use */
+			}
+			related = defs
+		}
+		for _, r := range related {
+			if msg.Method == "textDocument/references" && r.def && !p.Context.IncludeDeclaration {
+				continue
+			}
+			locs = append(locs, lsplocation{URI: r.file.uri, Range: r.file.span(r.start, r.end)})
+		}
+		return locs, nil
+
+	case "textDocument/hover":
+		a, o := s.lookup(&p)
+		if o == nil {
+			return nil, nil
+		}
+		return map[string]interface{}{
+			"contents": map[string]string{"kind": "markdown", "value": a.hover(o)},
+			"range":    o.file.span(o.start, o.end),
+		}, nil
+
+	case "textDocument/prepareRename", "textDocument/rename":
+		a, o := s.lookup(&p)
+		if o == nil {
+			return nil, &lsperror{Code: LSP_REQUEST_FAILED, Message: "There is nothing here to rename."}
+		}
+		if err := a.check_rename(o, p.NewName); err != nil {
+			return nil, err
+		}
+		if msg.Method == "textDocument/prepareRename" {
+			return map[string]interface{}{"range": o.file.span(o.start, o.end), "placeholder": o.name}, nil
+		}
+		changes := make(map[string][]lsptextedit)
+		for _, r := range a.related(o) {
+			changes[r.file.uri] = append(changes[r.file.uri], lsptextedit{Range: r.file.span(r.start, r.end), NewText: p.NewName})
+		}
+		return map[string]interface{}{"changes": changes}, nil
+
+	case "textDocument/completion":
+		a := s.owner(uri)
+		items := []map[string]interface{}{}
+		if a == nil {
+			return items, nil
+		}
+		for _, f := range a.files {
+			if f.uri != uri {
+				continue
+			}
+			cp := f.offset(p.Position)
+			start := cp
+			for start > 0 && (isalnum(f.text[start-1]) || f.text[start-1] == '_') {
+				start--
+			}
+			if start == 0 || f.text[start-1] != '%' {
+				break
+			}
+			names := lspDirectives
+			if start == 1 || f.text[start-2] == '\n' {
+				names = append(append([]string{}, names...), lspPreprocessorDirectives...)
+				sort.Strings(names)
+			}
+			for _, name := range names {
+				items = append(items, map[string]interface{}{
+					"label": name,
+					"kind":  14, /* Keyword */
+					"textEdit": lsptextedit{
+						Range:   f.span(start, cp),
+						NewText: name,
+					},
+				})
+			}
+		}
+		return items, nil
+
+	default:
+		if len(msg.ID) > 0 {
+			return nil, &lsperror{Code: LSP_METHOD_NOT_FOUND, Message: fmt.Sprintf("Unknown method \"%s\".", msg.Method)}
+		}
+	}
+	return nil, nil
+}
+
+/* Serve one client until it sends "exit" or closes the connection,
+** reporting version as that of the server.  Return the exit status. */
+func lsp_serve(in io.Reader, out io.Writer, version string) int {
+	s := &lspserver{
+		version:   version,
+		conn:      &lspconn{in: bufio.NewReader(in), out: out},
+		docs:      make(map[string]string),
+		analyses:  make(map[string]*lspanalysis),
+		published: make(map[string]string),
+	}
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "golemon lsp: %v\n", err)
+			}
+			return 1
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, rerr := s.handle(msg)
+		if len(msg.ID) == 0 {
+			continue /* A notification */
+		}
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+		if rerr != nil {
+			resp["error"] = rerr
+		} else {
+			resp["result"] = result
+		}
+		s.conn.write(resp)
+	}
+}
+
+/* An in-process client of the language server, connected to it by pipes.
+** Requests wait for their response; everything the server sends is kept
+** in order in received. */
+type lspharness struct {
+	conn     *lspconn
+	mu       sync.Mutex
+	queue    []*lspmessage /* Messages from the server not yet taken */
+	closed   bool          /* True once the server has closed its output */
+	exited   bool          /* True once the exit notification has been sent */
+	ready    chan struct{} /* Signalled when queue or closed changes */
+	status   chan int      /* The server's exit status */
+	nextID   int           /* The highest numeric request id sent so far */
+	received []*lspmessage
+}
+
+/* Start a language server and return a client connected to it */
+func lsp_harness() *lspharness {
+	toServer, fromClient := io.Pipe()
+	toClient, fromServer := io.Pipe()
+	h := &lspharness{
+		conn:   &lspconn{in: bufio.NewReader(toClient), out: fromClient},
+		ready:  make(chan struct{}, 1),
+		status: make(chan int, 1),
+	}
+	go func() {
+		/* No version, so that a script's output does not depend on how
+		** golemon was built */
+		h.status <- lsp_serve(toServer, fromServer, "")
+		/* Fail the client's writes from now on, rather than leave them
+		** waiting for a reader */
+		toServer.Close()
+		fromServer.Close()
+	}()
+	/* Read everything the server sends as soon as it is sent, so that
+	** the server never waits on the client */
+	go func() {
+		for {
+			msg, err := h.conn.read()
+			h.mu.Lock()
+			if err != nil {
+				h.closed = true
+			} else {
+				h.queue = append(h.queue, msg)
+			}
+			h.mu.Unlock()
+			select {
+			case h.ready <- struct{}{}:
+			default:
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return h
+}
+
+/* Return the next message from the server, or nil once it has closed
+** the connection */
+func (h *lspharness) next() *lspmessage {
+	for {
+		h.mu.Lock()
+		if len(h.queue) > 0 {
+			msg := h.queue[0]
+			h.queue = h.queue[1:]
+			h.mu.Unlock()
+			h.received = append(h.received, msg)
+			return msg
+		}
+		closed := h.closed
+		h.mu.Unlock()
+		if closed {
+			return nil
+		}
+		<-h.ready
+	}
+}
+
+/* Send a notification */
+func (h *lspharness) notify(method string, params interface{}) error {
+	if method == "exit" {
+		h.exited = true
+	}
+	return h.conn.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+/* Send a request with the given id, or the next unused number if id is
+** empty, and wait for its response.  Messages that arrive first are kept
+** in h.received. */
+func (h *lspharness) call(id json.RawMessage, method string, params interface{}, result interface{}) error {
+	if len(id) == 0 {
+		h.nextID++
+		id = json.RawMessage(strconv.Itoa(h.nextID))
+	} else if n, err := strconv.Atoi(string(id)); err == nil && n > h.nextID {
+		h.nextID = n
+	}
+	if err := h.conn.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return err
+	}
+	for msg := h.next(); msg != nil; msg = h.next() {
+		if msg.Method != "" || string(msg.ID) != string(id) {
+			continue
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	}
+	return fmt.Errorf("the server closed the connection")
+}
+
+/* Shut the server down, unless it has been sent exit already, and
+** return its exit status */
+func (h *lspharness) close() int {
+	if !h.exited {
+		h.call(nil, "shutdown", nil, nil)
+		h.notify("exit", nil)
+	}
+	for h.next() != nil {
+	}
+	return <-h.status
+}
+
+/* Send the messages in a script to an in-process server, printing what
+** it sends back.  Return the exit status. */
+func lsp_script(name string) int {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read file \"%s\": %v\n", name, err)
+		return 1
+	}
+	h := lsp_harness()
+	flush := func() {
+		for _, msg := range h.received {
+			out, _ := json.Marshal(msg)
+			fmt.Printf("%s\n", out)
+		}
+		h.received = nil
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		var msg lspmessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", name, n+1, err)
+			return 1
+		}
+		var params interface{}
+		if len(msg.Params) > 0 {
+			params = msg.Params
+		}
+		if len(msg.ID) > 0 {
+			h.call(msg.ID, msg.Method, params, nil)
+		} else {
+			h.notify(msg.Method, params)
+		}
+		flush()
+	}
+	status := h.close()
+	flush()
+	return status
+}
+
+/* Run "golemon lsp" with the given arguments.  Return the exit status. */
+func lsp_command(args []string) int {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.Var(&includePath, "I", "Search this directory for %include_file and %import.")
+	fs.Var(&azDefine, "D", "Define an %ifdef macro, as NAME or NAME=VALUE.")
+	script := fs.String("script", "", "Run the messages in this file through an in-process server and print the replies.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s lsp [-I DIR] [-D NAME[=VALUE]] [-script FILE]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *script != "" {
+		return lsp_script(*script)
+	}
+	return lsp_serve(os.Stdin, os.Stdout, golemon_version())
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+** Parameterised nonterminals ("macros").
+**
+** A macro is declared with its formal parameters, and then defined by
+** ordinary rules whose left-hand side is the macro name:
+**
+**     %macro seplist(SEP, X)
+**     %type seplist {[]$X}
+**     seplist(A) ::= X(B).                          { A = []$X{B} }
+**     seplist(A) ::= seplist(SEP, X)(A) SEP X(B).   { A = append(A, B) }
+**
+** A use such as "seplist(COMMA, expr)" on the right-hand side of a rule
+** instantiates the macro as a new nonterminal called
+** "seplist(COMMA,expr)", whose rules are the macro's rules with every
+** formal parameter used as a symbol replaced by the corresponding
+** argument; an alias keeps its name, even if a formal has it.  On the
+** right-hand side, a macro is always followed by its arguments, so a
+** recursive use is written "seplist(SEP, X)(A)" with the alias last.  Within the
+** %type, %destructor and the rule actions of a macro, $X stands for the
+** Go type of the value carried by argument X.  Arguments may themselves
+** be macro uses, and macro rules may use other macros, themselves, and
+** the EBNF operators.
+**
+** The rules of a macro are recorded as tokens and only checked when they
+** are instantiated, after the whole grammar has been read.  Instances are
+** added after all the other rules, so a macro is never the start symbol.
+ */
+
+/* Maximum nesting of macro instances, to stop runaway expansion of
+** rules like "m(X) ::= m(list(X))." */
+const MAXMACRODEPTH = 32
+
+/* A token of a recorded macro rule */
+type macrotoken struct {
+	text     string /* Text of the token */
+	filename string /* File in which it appeared */
+	lineno   int    /* Line on which it appeared */
+}
+
+/* A parameterised nonterminal */
+type macro struct {
+	name         string         /* Name of the macro */
+	formals      []string       /* Names of the formal parameters */
+	filename     string         /* File of the %macro declaration */
+	lineno       int            /* Line of the %macro declaration */
+	datatype     string         /* %type, with $X placeholders */
+	destructor   string         /* %destructor, with $X placeholders */
+	destLineno   int            /* Line number of the destructor */
+	destFilename string         /* File in which the destructor appears */
+	copycode     string         /* %copy, with $X placeholders */
+	copyLineno   int            /* Line number of the %copy code */
+	copyFilename string         /* File in which the %copy code appears */
+	rules        [][]macrotoken /* The recorded rules of the macro */
+	nInstance    int            /* Number of instances */
+}
+
+/* One instantiation of a macro */
+type macroinst struct {
+	sp    *symbol   /* The nonterminal for this instance */
+	mp    *macro    /* The macro being instantiated */
+	args  []*symbol /* The actual arguments */
+	depth int       /* Nesting depth of this instance */
+}
+
+/* Names that would clash with the nonterminals made by EBNF operators */
+var ebnfNames = map[string]bool{
+	"option":                  true,
+	"list":                    true,
+	"nonempty_list":           true,
+	"separated_nonempty_list": true,
+	"group":                   true,
+}
+
+/* Handle the name following %macro */
+func macro_declare(psp *pstate, name string) {
+	switch {
+	case !islower([]rune(name)[0]):
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"%%macro name \"%s\" must begin with a lower-case letter.", name)
+	case ebnfNames[name]:
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"%%macro name \"%s\" is reserved for EBNF operators.", name)
+	case psp.macros[name] != nil || Symbol_find(name) != nil:
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"Symbol \"%s\" already used", name)
+	default:
+		if psp.macros == nil {
+			psp.macros = make(map[string]*macro)
+		}
+		psp.curmacro = &macro{name: name, filename: psp.filename, lineno: psp.tokenlineno}
+		psp.macros[name] = psp.curmacro
+		psp.state = WAITING_FOR_MACRO_LPAREN
+		return
+	}
+	psp.errorcnt++
+	psp.state = RESYNC_AFTER_DECL_ERROR
+}
+
+/* Begin recording a rule of the macro mp.  "x" is its first token. */
+func macro_record_start(psp *pstate, mp *macro, x string) {
+	psp.recording = mp
+	psp.recordtoks = []macrotoken{{x, psp.filename, psp.tokenlineno}}
+	psp.recordphase = 0
+}
+
+/* If a macro rule is being recorded, add the token to it and return true.
+** Return false once the rule is complete, so that the token is parsed
+** normally. */
+func macro_record(psp *pstate, x string) bool {
+	tok := macrotoken{x, psp.filename, psp.tokenlineno}
+	switch psp.recordphase {
+	case 0: /* In the rule itself */
+		if x == "." {
+			psp.recordphase = 1
+		}
+	case 1: /* After the ".": a code block, precedence mark or label may follow */
+		if x[0] == '{' {
+			break
+		}
+		if x == "[" || x == "<" {
+			psp.recordphase = 2
+			break
+		}
+		macro_record_finish(psp)
+		return false
+	case 2: /* The precedence symbol or label */
+		psp.recordphase = 3
+	case 3: /* The "]" or ">" */
+		psp.recordphase = 1
+	}
+	psp.recordtoks = append(psp.recordtoks, tok)
+	return true
+}
+
+/* Finish recording a macro rule */
+func macro_record_finish(psp *pstate) {
+	if psp.recording == nil {
+		return
+	}
+	if psp.recordphase == 0 {
+		ErrorMsg(psp.recordtoks[0].filename, psp.recordtoks[0].lineno,
+			"Rule for macro \"%s\" is not terminated by \".\".", psp.recording.name)
+		psp.errorcnt++
+	} else {
+		psp.recording.rules = append(psp.recording.rules, psp.recordtoks)
+	}
+	psp.recording = nil
+	psp.recordtoks = nil
+}
+
+/* Parse a macro argument, which is either a symbol name or a use of
+** another macro, from the tokens toks.  Return the symbol, or nil after
+** reporting an error. */
+func macro_term(psp *pstate, toks []string) *symbol {
+	if len(toks) == 0 || !unicode.IsLetter([]rune(toks[0])[0]) {
+		ErrorMsg(psp.filename, psp.tokenlineno, "Missing or invalid macro argument.")
+		psp.errorcnt++
+		return nil
+	}
+	mp := psp.macros[toks[0]]
+	if len(toks) == 1 {
+		if mp != nil {
+			ErrorMsg(psp.filename, psp.tokenlineno,
+				"Macro \"%s\" used without arguments.", mp.name)
+			psp.errorcnt++
+			return nil
+		}
+		return Symbol_new(toks[0])
+	}
+	if mp == nil || toks[1] != "(" || toks[len(toks)-1] != ")" {
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"Invalid macro argument \"%s\".", strings.Join(toks, " "))
+		psp.errorcnt++
+		return nil
+	}
+
+	/* Split the arguments at top-level commas */
+	var args []*symbol
+	depth := 0
+	start := 2
+	for i := 2; i < len(toks); i++ {
+		switch toks[i] {
+		case "(":
+			depth++
+		case ")", ",":
+			if toks[i] == ")" && depth > 0 {
+				depth--
+				continue
+			}
+			if toks[i] == "," && depth > 0 {
+				continue
+			}
+			sp := macro_term(psp, toks[start:i])
+			if sp == nil {
+				return nil
+			}
+			args = append(args, sp)
+			start = i + 1
+		}
+	}
+	return macro_instance(psp, mp, args)
+}
+
+/* Return the nonterminal for the instance of mp with the given arguments,
+** creating it if this is its first use. */
+func macro_instance(psp *pstate, mp *macro, args []*symbol) *symbol {
+	if len(args) != len(mp.formals) {
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"Macro \"%s\" takes %d arguments but is given %d.",
+			mp.name, len(mp.formals), len(args))
+		psp.errorcnt++
+		return nil
+	}
+	names := make([]string, len(args))
+	depth := 1
+	for i, sp := range args {
+		names[i] = sp.name
+		if inst := psp.instmap[sp.name]; inst != nil && inst.depth >= depth {
+			depth = inst.depth + 1
+		}
+	}
+	name := mp.name + "(" + strings.Join(names, ",") + ")"
+	if inst := psp.instmap[name]; inst != nil {
+		inst.sp.useCnt++
+		return inst.sp
+	}
+	if depth > MAXMACRODEPTH {
+		ErrorMsg(psp.filename, psp.tokenlineno,
+			"Instances of macro \"%s\" are nested more than %d deep.",
+			mp.name, MAXMACRODEPTH)
+		psp.errorcnt++
+		return nil
+	}
+	inst := &macroinst{
+		sp:    Symbol_new(name),
+		mp:    mp,
+		args:  args,
+		depth: depth,
+	}
+	if psp.instmap == nil {
+		psp.instmap = make(map[string]*macroinst)
+	}
+	psp.instmap[name] = inst
+	psp.instances = append(psp.instances, inst)
+	mp.nInstance++
+	return inst.sp
+}
+
+/* Matches a $X placeholder in a %type, %destructor, %copy or action */
+var macroPlaceholder = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+/* Replace each $X in code with the Go type of the argument for X */
+func macro_subst_types(psp *pstate, inst *macroinst, code string) string {
+	if !strings.Contains(code, "$") {
+		return code
+	}
+	return macroPlaceholder.ReplaceAllStringFunc(code, func(m string) string {
+		for i, f := range inst.mp.formals {
+			if f == m[1:] {
+				t := ebnf_valuetype(psp.gp, inst.args[i])
+				if t == "" {
+					ErrorMsg(psp.filename, psp.tokenlineno,
+						"Argument \"%s\" for %s of macro \"%s\" carries no value, so %s has no type.",
+						inst.args[i].name, f, inst.mp.name, m)
+					psp.errorcnt++
+				}
+				return t
+			}
+		}
+		return m
+	})
+}
+
+/* Return true if the token toks[j] of a recorded rule is an alias, not a
+** symbol: a name in parentheses that follows the left-hand side, a
+** symbol, a group or the arguments of a macro use, as parseonetoken()
+** reads it.  A name in parentheses after a macro name is an argument. */
+func macro_is_alias(psp *pstate, toks []macrotoken, j int) bool {
+	if j < 2 || j+1 >= len(toks) || toks[j-1].text != "(" || toks[j+1].text != ")" {
+		return false
+	}
+	prev := strings.TrimLeft(toks[j-2].text, "|/")
+	switch {
+	case j == 2:
+		return true
+	case prev == ")":
+		return !macro_is_alias(psp, toks, j-3)
+	case prev != "" && unicode.IsLetter([]rune(prev)[0]):
+		return psp.macros[prev] == nil
+	}
+	return false
+}
+
+/* Called once the whole grammar has been read.  Generate the rules of
+** every macro instance by replaying the recorded rules of its macro with
+** the arguments substituted.  Replaying may create further instances,
+** which are expanded in turn. */
+func macro_finish(psp *pstate) {
+	filename := psp.filename
+	defer func() { psp.filename = filename }()
+	macro_record_finish(psp)
+	names := make([]string, 0, len(psp.macros))
+	for name := range psp.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if mp := psp.macros[name]; len(mp.rules) == 0 {
+			ErrorMsg(mp.filename, mp.lineno, "Macro \"%s\" has no rules.", mp.name)
+			psp.errorcnt++
+		}
+	}
+	for i := 0; i < len(psp.instances); i++ {
+		inst := psp.instances[i]
+		mp := inst.mp
+		psp.filename = mp.filename
+		psp.tokenlineno = mp.lineno
+		if mp.datatype != "" {
+			inst.sp.datatype = macro_subst_types(psp, inst, mp.datatype)
+		}
+		if mp.destructor != "" {
+			inst.sp.destructor = macro_subst_types(psp, inst, mp.destructor)
+			inst.sp.destLineno = mp.destLineno
+			inst.sp.destFilename = mp.destFilename
+		}
+		if mp.copycode != "" {
+			inst.sp.copycode = macro_subst_types(psp, inst, mp.copycode)
+			inst.sp.copyLineno = mp.copyLineno
+			inst.sp.copyFilename = mp.copyFilename
+		}
+		for _, toks := range mp.rules {
+			psp.state = WAITING_FOR_DECL_OR_RULE
+			for j, tok := range toks {
+				psp.filename = tok.filename
+				psp.tokenlineno = tok.lineno
+				text := tok.text
+				switch {
+				case j == 0:
+					text = inst.sp.name
+				case text[0] == '{':
+					text = macro_subst_types(psp, inst, text)
+				case macro_is_alias(psp, toks, j):
+					/* An alias keeps its name, even that of a formal */
+				default:
+					prefix := ""
+					if text[0] == '|' || text[0] == '/' {
+						prefix, text = text[:1], text[1:]
+					}
+					for k, f := range mp.formals {
+						if f == text {
+							text = inst.args[k].name
+						}
+					}
+					text = prefix + text
+				}
+				parseonetoken(psp, []rune(text))
+			}
+		}
+	}
+	psp.state = WAITING_FOR_DECL_OR_RULE
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+/*
+** Random sentences of a grammar:
+**
+**     golemon sentences [-n N] [-depth D] [-seed S] [-invalid] grammar.y
+**
+** Prints N sentences of the grammar, one per line, each as the names of
+** its tokens separated by spaces.  A sentence is found by expanding the
+** start symbol, choosing at random among the rules of each nonterminal.
+** The depth of the derivation is limited by -depth: each nonterminal is
+** given the height of its shallowest derivation of a string of terminals
+** (so a nonterminal that may be empty, with symbol.lambda set, has height
+** one), and once the budget runs low only rules that can finish within it
+** are chosen.  Rules that use the "error" token are never chosen, and a
+** wildcard or a %token_class is replaced by a random token it matches.
+**
+** Each sentence is run through the parser's own action tables, found as
+** for the generator, and kept only if they accept it.  This matters
+** where precedence declarations, %nonassoc in particular, reject
+** sentences that the rules alone would allow.
+**
+** With -invalid, each sentence is instead mutated, by deleting,
+** inserting, replacing, duplicating or swapping tokens, until the
+** action tables reject it.  Such sentences exercise the %syntax_error
+** code and any error-recovery rules.
+**
+** The same -seed always gives the same sentences.
+ */
+
+/* Kinds of mutation made to a sentence for -invalid */
+const (
+	MUTATE_DELETE = iota
+	MUTATE_INSERT
+	MUTATE_REPLACE
+	MUTATE_DUPLICATE
+	MUTATE_SWAP
+	MUTATE_COUNT
+)
+
+/* How often to try for a sentence before giving up on it */
+const SENTENCE_TRIES = 100
+
+/* The state of the sentence generator */
+type sentencegen struct {
+	lemp   *lemon
+	rnd    *rand.Rand
+	start  *symbol
+	height map[*symbol]int /* Height of each productive nonterminal */
+	tokens []*symbol       /* Tokens that may appear in input */
+}
+
+/* Return the height of a rule: one more than the greatest height of the
+** nonterminals on its right-hand side.  Return -1 if the rule can't be
+** used, or some nonterminal on it has no height yet. */
+func (g *sentencegen) rule_height(rp *rule) int {
+	h := 1
+	for _, sp := range rp.rhs {
+		switch {
+		case sp == g.lemp.errsym:
+			return -1
+		case sp.typ == NONTERMINAL:
+			sh, ok := g.height[sp]
+			if !ok {
+				return -1
+			}
+			if sh+1 > h {
+				h = sh + 1
+			}
+		}
+	}
+	return h
+}
+
+/* Find the height of every nonterminal that derives some string of
+** terminals without using "error" */
+func (g *sentencegen) find_heights() {
+	g.height = make(map[*symbol]int)
+	for changed := true; changed; {
+		changed = false
+		for rp := g.lemp.rule; rp != nil; rp = rp.next {
+			h := g.rule_height(rp)
+			if h < 0 {
+				continue
+			}
+			if old, ok := g.height[rp.lhs]; !ok || h < old {
+				g.height[rp.lhs] = h
+				changed = true
+			}
+		}
+	}
+}
+
+/* Return a random token matched by sp */
+func (g *sentencegen) token(sp *symbol) *symbol {
+	switch {
+	case sp.typ == MULTITERMINAL:
+		return sp.subsym[g.rnd.Intn(len(sp.subsym))]
+	case sp == g.lemp.wildcard:
+		return g.tokens[g.rnd.Intn(len(g.tokens))]
+	}
+	return sp
+}
+
+/* Append to out a random string of tokens derived from sp, in a
+** derivation no deeper than depth */
+func (g *sentencegen) expand(sp *symbol, depth int, out []*symbol) []*symbol {
+	if sp.typ != NONTERMINAL {
+		return append(out, g.token(sp))
+	}
+	var choices []*rule
+	for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+		if h := g.rule_height(rp); h >= 0 && h <= depth {
+			choices = append(choices, rp)
+		}
+	}
+	if len(choices) == 0 {
+		/* Only when depth is less than the height of sp: take its
+		** shallowest rules */
+		for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+			if h := g.rule_height(rp); h >= 0 && h == g.height[sp] {
+				choices = append(choices, rp)
+			}
+		}
+	}
+	rp := choices[g.rnd.Intn(len(choices))]
+	for _, rsp := range rp.rhs {
+		out = g.expand(rsp, depth-1, out)
+	}
+	return out
+}
+
+/* Return the action of state stp on the lookahead sp, or nil for a
+** syntax error.  Conflicts are resolved as in the generated parser.
+** The tables may have been through CompressTables(): a SHIFTREDUCE
+** still names the state it shifts to, and a state's default reduce is
+** found by sentence_default(). */
+func sentence_action(stp *state, sp *symbol) *action {
+	for ap := stp.ap; ap != nil; ap = ap.next {
+		if ap.sp != sp {
+			continue
+		}
+		switch ap.typ {
+		case SHIFT, SHIFTREDUCE, ACCEPT, REDUCE:
+			return ap
+		case ERROR:
+			return nil
+		}
+	}
+	return nil
+}
+
+/* Return the default reduce action of state stp, or nil if it has none */
+func sentence_default(stp *state) *action {
+	for ap := stp.ap; ap != nil; ap = ap.next {
+		if ap.typ == REDUCE && ap.sp.name == "{default}" {
+			return ap
+		}
+	}
+	return nil
+}
+
+/* Report whether the parser accepts the sentence */
+func (g *sentencegen) accepts(sentence []*symbol) bool {
+	lemp := g.lemp
+	stack := []*state{lemp.sorted[0]}
+	input := append(append([]*symbol{}, sentence...), lemp.symbols[0])
+	for i := 0; i < len(input); {
+		top := stack[len(stack)-1]
+		la := input[i]
+		ap := sentence_action(top, la)
+		/* Try the fallback tokens, then the wildcard, as yy_find_shift_action()
+		** does */
+		for fb := la.fallback; ap == nil && fb != nil; fb = fb.fallback {
+			ap = sentence_action(top, fb)
+		}
+		if ap == nil && lemp.wildcard != nil && la.index > 0 {
+			ap = sentence_action(top, lemp.wildcard)
+		}
+		if ap == nil {
+			ap = sentence_default(top)
+		}
+		if ap == nil {
+			return false
+		}
+		switch ap.typ {
+		case SHIFT, SHIFTREDUCE:
+			stack = append(stack, ap.x.stp)
+			i++
+		case REDUCE:
+			rp := ap.x.rp
+			stack = stack[:len(stack)-len(rp.rhs)]
+			top = stack[len(stack)-1]
+			gp := sentence_action(top, rp.lhs)
+			if gp == nil {
+				return false
+			}
+			if gp.typ == ACCEPT {
+				return la.index == 0
+			}
+			stack = append(stack, gp.x.stp)
+		case ACCEPT:
+			return la.index == 0
+		}
+	}
+	return false
+}
+
+/* Return a random sentence accepted by the parser.  Return false if
+** none is found. */
+func (g *sentencegen) sentence(depth int) ([]*symbol, bool) {
+	for try := 0; try < SENTENCE_TRIES; try++ {
+		s := g.expand(g.start, depth, nil)
+		if g.accepts(s) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+/* Return a copy of sentence with a random mutation, which the parser
+** rejects.  Return false if none is found. */
+func (g *sentencegen) mutate(sentence []*symbol) ([]*symbol, bool) {
+	for try := 0; try < SENTENCE_TRIES; try++ {
+		s := append([]*symbol{}, sentence...)
+		/* Make one to three changes */
+		for n := 1 + g.rnd.Intn(3); n > 0; n-- {
+			kind := g.rnd.Intn(MUTATE_COUNT)
+			if len(s) == 0 {
+				kind = MUTATE_INSERT
+			}
+			i := g.rnd.Intn(len(s) + 1)
+			if i == len(s) && kind != MUTATE_INSERT {
+				i--
+			}
+			switch kind {
+			case MUTATE_DELETE:
+				s = append(s[:i], s[i+1:]...)
+			case MUTATE_INSERT:
+				s = append(s[:i], append([]*symbol{g.tokens[g.rnd.Intn(len(g.tokens))]}, s[i:]...)...)
+			case MUTATE_REPLACE:
+				s[i] = g.tokens[g.rnd.Intn(len(g.tokens))]
+			case MUTATE_DUPLICATE:
+				s = append(s[:i+1], s[i:]...)
+			case MUTATE_SWAP:
+				if i+1 < len(s) {
+					s[i], s[i+1] = s[i+1], s[i]
+				}
+			}
+		}
+		if !g.accepts(s) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+/* Run "golemon sentences" with the given arguments.  Return the exit
+** status. */
+func sentences_command(args []string) int {
+	fs := flag.NewFlagSet("sentences", flag.ExitOnError)
+	fs.Var(&includePath, "I", "Search this directory for %include_file and %import.")
+	fs.Var(&azDefine, "D", "Define an %ifdef macro, as NAME or NAME=VALUE.")
+	count := fs.Int("n", 10, "Number of sentences to print.")
+	depth := fs.Int("depth", 8, "Greatest depth of the derivation of each sentence.")
+	seed := fs.Int64("seed", 1, "Seed for the random choices.")
+	invalid := fs.Bool("invalid", false, "Print mutated sentences that the parser rejects.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s sentences [flags] grammar.y\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	lem := lemon{filename: fs.Arg(0)}
+	Symbol_init()
+	State_init()
+	Symbol_new("$")
+	Parse(&lem)
+	if lem.errorcnt > 0 {
+		return 1
+	}
+	if lem.nrule == 0 {
+		fmt.Fprintf(os.Stderr, "Empty grammar.\n")
+		return 1
+	}
+	index_grammar(&lem)
+	FindRulePrecedences(&lem)
+	FindFirstSets(&lem)
+	lem.nstate = 0
+	FindStates(&lem)
+	lem.sorted = State_arrayof()
+	FindLinks(&lem)
+	FindFollowSets(&lem)
+	FindActions(&lem)
+
+	g := &sentencegen{lemp: &lem, rnd: rand.New(rand.NewSource(*seed))}
+	if lem.start != "" {
+		g.start = Symbol_find(lem.start)
+	}
+	if g.start == nil {
+		g.start = lem.startRule.lhs
+	}
+	for i := 1; i < lem.nterminal; i++ {
+		if sp := lem.symbols[i]; sp != lem.errsym && sp != lem.wildcard {
+			g.tokens = append(g.tokens, sp)
+		}
+	}
+	g.find_heights()
+	if _, ok := g.height[g.start]; !ok {
+		fmt.Fprintf(os.Stderr, "The start symbol \"%s\" derives no sentence.\n", g.start.name)
+		return 1
+	}
+	if *invalid && len(g.tokens) == 0 {
+		fmt.Fprintf(os.Stderr, "The grammar has no tokens to mutate with.\n")
+		return 1
+	}
+
+	status := 0
+	for n := 0; n < *count; n++ {
+		s, ok := g.sentence(*depth)
+		if ok && *invalid {
+			s, ok = g.mutate(s)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Gave up on sentence %d after %d tries.\n", n+1, SENTENCE_TRIES)
+			status = 1
+			continue
+		}
+		names := make([]string, len(s))
+		for i, sp := range s {
+			names[i] = sp.name
+		}
+		fmt.Println(strings.Join(names, " "))
+	}
+	return status
+}
@@ -0,0 +1,125 @@
+// A test case for the types made from labelled rules.  Run as follows:
+//
+//     golemon ast-test01.y && go run ./ast-test01.go
+//
+
+%token_type string
+%type program {[]Stmt}
+%type stmt    {Stmt}
+%type expr    {Expr}
+%type name    {Expr}
+%type number  {int}
+%right ASSIGN.
+%left PLUS MINUS.
+%left TIMES.
+
+%token_pattern NUM    "[0-9]+"
+%token_pattern ID     "[a-z]+"
+%token_pattern ASSIGN "="
+%token_pattern PLUS   "\+"
+%token_pattern MINUS  "-"
+%token_pattern TIMES  "\*"
+%token_pattern LP     "\("
+%token_pattern RP     "\)"
+%token_pattern COMMA  ","
+%token_pattern SEMI   ";"
+%skip_pattern         "[ \t\n]+"
+
+%include {
+import (
+	"strconv"
+	"strings"
+)
+
+func yytestcase(condition bool) {}
+}
+
+program(A) ::= stmt*(A).
+stmt ::= ID(Name) ASSIGN expr(Value) SEMI.         <AssignStmt>
+stmt ::= expr(X) SEMI.                             <ExprStmt>
+stmt ::= SEMI.                                     <EmptyStmt>
+expr ::= expr(X) PLUS|MINUS(Op) expr(Y).           <BinaryExpr>
+expr ::= expr(X) TIMES(Op) expr(Y).                <BinaryExpr>
+expr ::= ID(Func) LP expr % COMMA (Args) RP.       <CallExpr>
+expr ::= number(Value).                            <NumberLit>
+expr(A) ::= name(A).
+expr(A) ::= LP expr(B) RP.                         { A = B }
+name ::= ID(Name).                                 <Ident>
+number(A) ::= NUM(B).                              { A, _ = strconv.Atoi(B) }
+
+%code {
+/* Print a tree as a Lisp-like expression, by its types */
+func show(v interface{}) string {
+	switch n := v.(type) {
+	case []Stmt:
+		var s []string
+		for _, x := range n {
+			s = append(s, show(x))
+		}
+		return strings.Join(s, " ")
+	case *AssignStmt:
+		return fmt.Sprintf("(set %s %s)", n.Name, show(n.Value))
+	case *ExprStmt:
+		return show(n.X)
+	case *EmptyStmt:
+		return "()"
+	case *BinaryExpr:
+		return fmt.Sprintf("(%s %s %s)", n.Op, show(n.X), show(n.Y))
+	case *CallExpr:
+		var s []string
+		for _, x := range n.Args {
+			s = append(s, show(x))
+		}
+		return fmt.Sprintf("(%s %s)", n.Func, strings.Join(s, " "))
+	case *NumberLit:
+		return strconv.Itoa(n.Value)
+	case *Ident:
+		return n.Name
+	}
+	return fmt.Sprintf("?%T", v)
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+func parse(input string) string {
+	result, err := ParseAll(ParseNewLexer(input))
+	if err != nil {
+		return err.Error()
+	}
+	return show(result)
+}
+
+func main() {
+	testCase(100, "(set x (+ 1 (* 2 y)))", parse("x = 1 + 2*y;"))
+	testCase(110, "(f (- a 1) (g b) 3) ()", parse("f(a - 1, g(b), (3));;"))
+	testCase(120, "(* (+ a b) c)", parse("(a + b) * c;"))
+
+	/* The location of each value is where its text starts */
+	result, _ := ParseAll(ParseNewLexer("x = 1;\n  f(y + 2);"))
+	call := result[1].(*ExprStmt).X.(*CallExpr)
+	testCase(200, "1:1 2:3 2:5 2:9", fmt.Sprint(result[0].(*AssignStmt).Loc, " ", call.Loc, " ",
+		call.Args[0].(*BinaryExpr).Loc, " ", call.Args[0].(*BinaryExpr).Y.(*NumberLit).Loc))
+
+	/* Each label implements the interface of its nonterminal */
+	var _ Stmt = &AssignStmt{}
+	var _ Expr = &Ident{}
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
@@ -0,0 +1,125 @@
+// A test case for ParseCanShift().  Run as follows:
+//
+//     golemon canshift-test01.y && go run ./canshift-test01.go
+//
+
+%token_type string
+%type name {string}
+
+%include {
+import (
+	"strings"
+)
+
+var nAction = 0       /* Actions run */
+var nDestroyed = 0    /* Values destroyed */
+var nSyntaxError = 0
+
+func yytestcase(condition bool) {}
+}
+
+%destructor name { nDestroyed++ }
+
+program ::= stmts.
+stmts ::= .
+stmts ::= stmts stmt.
+stmt ::= SELECT names FROM name SEMI.   { nAction++ }
+names ::= name.
+names ::= names COMMA name.
+name(A) ::= ID(B).                      { A = B; nAction++ }
+
+%syntax_error {
+	nSyntaxError++
+}
+%code {
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Give p the tokens of input, where "select" and "from" are keywords
+** only where the parser can take them as keywords, and return the tokens
+** it was given */
+func feed(p *yyParser, input string) string {
+	var s []string
+	for _, w := range strings.Fields(input) {
+		major := YYCODETYPE(ID)
+		switch w {
+		case "select":
+			if p.ParseCanShift(SELECT) {
+				major = SELECT
+			}
+		case "from":
+			if p.ParseCanShift(FROM) {
+				major = FROM
+			}
+		case ",":
+			major = COMMA
+		case ";":
+			major = SEMI
+		}
+		p.Parse(major, w)
+		s = append(s, yyTokenName[major])
+	}
+	return strings.Join(s, " ")
+}
+
+/* Check ParseCanShift() against Parse() on a clone of p, for each token,
+** after each sequence of up to n tokens that has no error.  Return the
+** number of disagreements. */
+func check(p *yyParser, n int) int {
+	nBad := 0
+	for major := YYCODETYPE(0); int(major) < YYNTOKEN; major++ {
+		nAction, nDestroyed = 0, 0
+		can := p.ParseCanShift(major)
+		if nAction != 0 || nDestroyed != 0 {
+			nBad++
+		}
+		q := p.ParseClone()
+		nSyntaxError = 0
+		q.Parse(major, "x")
+		if can != (nSyntaxError == 0) {
+			nBad++
+		}
+		if nSyntaxError == 0 && major != 0 && n > 0 {
+			nBad += check(q, n-1)
+		}
+		q.ParseFree()
+	}
+	return nBad
+}
+
+func main() {
+	p := ParseAlloc()
+	testCase(100, "SELECT ID FROM ID SEMI", feed(p, "select a from b ;"))
+	testCase(110, "SELECT ID FROM ID SEMI", feed(p, "select from from from ;"))
+	testCase(120, "SELECT ID COMMA ID FROM ID SEMI", feed(p, "select select , from from select ;"))
+
+	/* "name ::= ID" must be reduced before FROM can be shifted, but
+	** the action is not run */
+	feed(p, "select a")
+	nAction = 0
+	testCase(200, "true false false true 0", fmt.Sprint(p.ParseCanShift(FROM), p.ParseCanShift(SEMI),
+		p.ParseCanShift(0), p.ParseCanShift(COMMA), nAction))
+	feed(p, "from b ;")
+	testCase(210, "true true false", fmt.Sprint(p.ParseCanShift(0), p.ParseCanShift(SELECT), p.ParseCanShift(ID)))
+	p.ParseFree()
+
+	testCase(300, "0", fmt.Sprint(check(ParseAlloc(), 6)))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
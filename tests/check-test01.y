@@ -0,0 +1,13 @@
+// A test case for -check, which writes nothing, and shows how each output
+// differs from the file on disk.  Run as follows:
+//
+//     (golemon -l -q check-test01.y && golemon -l -check -q check-test01.y; echo "exit $?"; sed -i 's/total = 0/total = 1/' check-test01.go; golemon -l -check -q check-test01.y; echo "exit $?") 2>&1 | diff check-test01.out -
+//
+
+%token_type int
+
+%include {
+var total = 0
+}
+
+program ::= NUM(A). { total = A }
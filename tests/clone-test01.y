@@ -0,0 +1,157 @@
+// A test case for ParseClone(), ParseSnapshot() and ParseRestore().  Run
+// as follows:
+//
+//     golemon clone-test01.y && go run ./clone-test01.go
+//
+
+%token_type string
+%type list    {*List}
+%type program {string}
+
+%include {
+import (
+	"strings"
+)
+
+/* A list that the actions change in place, so that a parser and its
+** clone must not share one */
+type List struct {
+	items []string
+}
+
+var nLive = 0 /* Lists made and not yet destroyed */
+var nSyntaxError = 0
+var result = "" /* The value of the last program reduced */
+
+func newList() *List {
+	nLive++
+	return &List{}
+}
+
+func (l *List) clone() *List {
+	nLive++
+	return &List{items: append([]string(nil), l.items...)}
+}
+
+func (l *List) free() {
+	nLive--
+}
+
+func yytestcase(condition bool) {}
+}
+
+%destructor list { $$.free() }
+%copy list       { $$ = $$.clone() }
+%token_copy      { $$ += "'" }
+
+program(A) ::= list(B) END.            { A = strings.Join(B.items, " "); B.free(); result = A }
+list(A) ::= .                          { A = newList() }
+list(A) ::= list(A) ITEM(B).           { A.items = append(A.items, B) }
+list(A) ::= list(A) LP list(B) RP.     { A.items = append(A.items, "("+strings.Join(B.items, " ")+")"); B.free() }
+
+%syntax_error {
+	nSyntaxError++
+}
+%code {
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Give p a token for each word of input: "(", ")" and "." stand for LP,
+** RP and END, and any other word for an ITEM */
+func feed(p *yyParser, input string) {
+	for _, w := range strings.Fields(input) {
+		switch w {
+		case "(":
+			p.Parse(LP, w)
+		case ")":
+			p.Parse(RP, w)
+		case ".":
+			p.Parse(END, w)
+		default:
+			p.Parse(ITEM, w)
+		}
+	}
+}
+
+/* Finish the parse, and return its result */
+func finish(p *yyParser) string {
+	result = ""
+	p.Parse(0, "")
+	p.ParseFree()
+	return result
+}
+
+/* Return the tokens that may come next, found by trying each one on a
+** clone of p */
+func expected(p *yyParser) string {
+	var s []string
+	for _, major := range []YYCODETYPE{ITEM, LP, RP, END} {
+		q := p.ParseClone()
+		n := nSyntaxError
+		q.Parse(major, "")
+		if nSyntaxError == n {
+			s = append(s, yyTokenName[major])
+		}
+		q.ParseFree()
+	}
+	nSyntaxError = 0
+	return strings.Join(s, " ")
+}
+
+func main() {
+	/* A clone goes its own way.  The token on the top of the stack, not
+	** yet reduced, is copied by %token_copy */
+	p := ParseAlloc()
+	feed(p, "a ( b c")
+	q := p.ParseClone()
+	feed(q, "x ) .")
+	feed(p, "d ) e .")
+	testCase(100, "a (b c' x)", finish(q))
+	testCase(110, "a (b c d) e", finish(p))
+	testCase(120, "0", fmt.Sprint(nLive))
+
+	/* Try each token and back out, as for completion */
+	p = ParseAlloc()
+	feed(p, "a (")
+	testCase(200, "ITEM LP RP", expected(p))
+	feed(p, ")")
+	testCase(210, "ITEM LP END", expected(p))
+	feed(p, ".")
+	testCase(220, "a ()", finish(p))
+	testCase(230, "0", fmt.Sprint(nLive))
+
+	/* A snapshot can be restored more than once, each time with copies
+	** of its values */
+	p = ParseAlloc()
+	feed(p, "a ( b")
+	s := p.ParseSnapshot()
+	feed(p, ". ) )")
+	testCase(300, "1", fmt.Sprint(nSyntaxError))
+	p.ParseRestore(s)
+	feed(p, ") .")
+	testCase(310, "a (b'')", finish(p))
+	p = ParseAlloc()
+	p.ParseRestore(s)
+	feed(p, "c ) d .")
+	testCase(320, "a (b'' c) d", finish(p))
+	s.Free()
+	testCase(330, "0", fmt.Sprint(nLive))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
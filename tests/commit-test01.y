@@ -0,0 +1,16 @@
+// A test case for how the outputs are written: an output that would not
+// change is left alone, with its modification time, and a run that fails
+// leaves every output as it was.  Run as follows:
+//
+//     (golemon -report commit-test01.rpt commit-test01.y && touch -d 2000-01-01 commit-test01.go commit-test01.rpt && cp commit-test01.go commit-test01.go.orig && golemon -report commit-test01.rpt commit-test01.y; echo "exit $?"; date -r commit-test01.go +%Y; date -r commit-test01.rpt +%Y; sed 's/NUM(A). { total = A }/INT(A). { total = }/' commit-test01.y | golemon -filename commit-test01.y -report commit-test01.rpt - 2>/dev/null; echo "exit $?"; date -r commit-test01.go +%Y; date -r commit-test01.rpt +%Y; cmp commit-test01.go commit-test01.go.orig && echo same) 2>&1 | diff commit-test01.out -
+//
+
+%token_type int
+
+%include {
+var total = 0
+
+func yytestcase(condition bool) {}
+}
+
+program ::= NUM(A). { total = A }
@@ -0,0 +1,141 @@
+// A test case for the syntax tree built with -cst.  Run as follows:
+//
+//     golemon -cst cst-test01.y && go run ./cst-test01.go
+//
+
+%token_type string
+%type number {int}
+%left PLUS.
+%left TIMES.
+
+%token_pattern NUM   "[0-9]+"
+%token_pattern ID    "[a-z]+"
+%token_pattern PLUS  "\+"
+%token_pattern TIMES "\*"
+%token_pattern LP    "\("
+%token_pattern RP    "\)"
+%token_pattern SEMI  ";"
+%skip_pattern        "[ \t\n]+|#[^\n]*"
+
+%include {
+import (
+	"strconv"
+	"strings"
+)
+
+func yytestcase(condition bool) {}
+}
+
+program ::= stmts.
+stmts ::= .
+stmts ::= stmts stmt.
+stmt ::= expr SEMI.
+stmt ::= error SEMI.
+expr ::= expr PLUS expr.
+expr ::= expr TIMES expr.
+expr ::= LP expr RP.
+expr ::= ID.
+expr ::= number.
+expr(A) ::= ID(B) LP RP. { A = &ParseNode{Rule: -1, Symbol: ID, Token: B + "()"} }
+number(A) ::= NUM(B).    { A, _ = strconv.Atoi(B) }
+
+%code {
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+func tree(input string) string {
+	root, err := ParseAll(ParseNewLexer(input))
+	if root == nil {
+		return err.Error()
+	}
+	var b strings.Builder
+	ParseFprint(&b, root)
+	return b.String()
+}
+
+func source(input string) string {
+	root, err := ParseAll(ParseNewLexer(input))
+	if root == nil {
+		return err.Error()
+	}
+	var b strings.Builder
+	ParseFprintSource(&b, root)
+	return b.String()
+}
+
+func main() {
+	input := "# Two statements\n  a + b*(c) ;\n\tx\t*  y; # done\n\n"
+	testCase(100, input, source(input))
+
+	/* The text of a nonterminal with a %type is not kept */
+	testCase(105, "x+;", source("x+42;"))
+	testCase(110, `program ::= stmts
+  stmts ::= stmts stmt
+    stmts ::=
+    stmt ::= expr SEMI
+      expr ::= expr PLUS expr
+        expr ::= ID
+          ID "a" 1:1
+        PLUS "+" 1:3 trivia " "
+        expr ::= number
+          number 1 1:4
+      SEMI ";" 1:5
+`, tree("a +1;"))
+
+	/* An action that builds its own node */
+	testCase(120, `program ::= stmts
+  stmts ::= stmts stmt
+    stmts ::=
+    stmt ::= expr SEMI
+      ID "f()" offset 0
+      SEMI ";" 1:4
+`, tree("f();"))
+
+	/* Count the tokens and nodes with ParseInspect() */
+	root, _ := ParseAll(ParseNewLexer(input))
+	nToken, nNode := 0, 0
+	ParseInspect(root, func(n *ParseNode) bool {
+		if n != nil && n.IsToken() {
+			nToken++
+		} else if n != nil {
+			nNode++
+		}
+		return true
+	})
+	testCase(130, "12 15", fmt.Sprint(nToken, " ", nNode))
+
+	/* The error token is a leaf, and the tokens discarded by error
+	** recovery are lost */
+	testCase(200, "a; ; b;", source("a; + ; b;"))
+	testCase(210, "; b;", source("a +; b;"))
+	testCase(220, "true", fmt.Sprint(strings.Contains(tree("a +; b;"), "error <nil> 1:4\n")))
+
+	/* In push mode, the location and trivia come from ParseSetLocation() */
+	p := ParseAlloc()
+	tokens := []YYCODETYPE{ID, PLUS, ID, SEMI, 0}
+	for i, t := range tokens {
+		p.ParseSetLocation(ParseLocation{Offset: i, Line: 7, Column: i + 1}, strings.Repeat(" ", i))
+		p.Parse(t, fmt.Sprint("t", i))
+	}
+	var b strings.Builder
+	ParseFprintSource(&b, p.yyresult())
+	testCase(300, "t0 t1  t2   t3    ", b.String())
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
@@ -0,0 +1,118 @@
+// A test case for the EBNF operators ?, *, +, % and groups.  Run as
+// follows:
+//
+//     golemon ebnf-test01.y && go run ./ebnf-test01.go
+//
+// Some rules put a group right after an aliased symbol, as in
+// "ID(N) ( COMMA ID(M) )*(L)", which must keep the alias N.  Two rules
+// use the same group with different aliases, which must share one
+// nonterminal, or they conflict.
+
+%token_type   string
+%type program {string}
+%type stmt    {string}
+%type call    {string}
+%type args    {[]string}
+%type expr    {string}
+%type type    {string}
+
+%token_pattern VAR    "var"
+%token_pattern USE    "use"
+%token_pattern ID     "[a-z]+"
+%token_pattern LP     "\("
+%token_pattern RP     "\)"
+%token_pattern COMMA  ","
+%token_pattern COLON  ":"
+%token_pattern DOT    "\."
+%token_pattern SEMI   ";"
+%skip_pattern         "[ \t\n]+"
+
+%include {
+import (
+	"strings"
+)
+
+func yytestcase(condition bool) {}
+}
+
+program(P) ::= stmt*(L).                          { P = strings.Join(L, " ") }
+stmt(A) ::= call(C) SEMI?(S).                     { A = C + S }
+stmt(A) ::= VAR ID(N) ( COMMA ID(M) )*(L) SEMI.   { A = "var " + strings.Join(append([]string{N}, L...), ",") + ";" }
+stmt(A) ::= VAR ID(N) ( COMMA ID(K) )*(L) COLON type(T) SEMI. {
+	A = "var " + strings.Join(append([]string{N}, L...), ",") + ":" + T + ";"
+}
+stmt(A) ::= USE ID+(L) SEMI.                      { A = "use " + strings.Join(L, "|") + ";" }
+call(C) ::= ID(N) args?(A) ( COLON type(T) )?(R). { C = newCall(N, A, R) }
+args(A) ::= LP expr % COMMA (L) RP.               { A = L }
+expr(A) ::= ID(X) ( DOT ID(Y) )*(L).              { A = strings.Join(append([]string{X}, L...), ".") }
+type(A) ::= ID(X).                                { A = X }
+
+%code {
+func newCall(name string, args []string, typ string) string {
+	s := name
+	if args != nil {
+		s += "(" + strings.Join(args, ",") + ")"
+	}
+	if typ != "" {
+		s += ":" + typ
+	}
+	return s
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Parse input, and return its value or error */
+func parse(input string) string {
+	result, err := ParseAll(ParseNewLexer(input))
+	if err != nil {
+		return err.Error()
+	}
+	return result
+}
+
+func main() {
+	/* X* with no elements, and X? with and without its element */
+	testCase(100, "", parse(""))
+	testCase(110, "f", parse("f"))
+	testCase(120, "f; g", parse("f; g"))
+
+	/* An option of a nonterminal, and an option of a group */
+	testCase(200, "f(a)", parse("f(a)"))
+	testCase(210, "f:int;", parse("f: int;"))
+	testCase(220, "f(a,b.c,d.e.f):t;", parse("f(a, b.c, d . e.f): t;"))
+
+	/* X % SEP needs one element, and none after a trailing SEP */
+	testCase(300, "1:3: syntax error near RP", parse("f()"))
+	testCase(310, "1:5: syntax error near RP", parse("f(a,)"))
+
+	/* A group repeated after an aliased symbol */
+	testCase(400, "var x;", parse("var x;"))
+	testCase(410, "var x,y,z;", parse("var x, y, z;"))
+	testCase(420, "1:7: syntax error near ID", parse("var x y;"))
+	testCase(430, "var x,y:int;", parse("var x, y: int;"))
+
+	/* X+ needs one element */
+	testCase(500, "use a|b|c;", parse("use a b c;"))
+	testCase(510, "1:5: syntax error near SEMI", parse("use ;"))
+
+	testCase(600, "var a,b; use c; f(x.y):t; g", parse("var a, b; use c; f(x.y): t; g"))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
@@ -0,0 +1,33 @@
+// A test case for "golemon fmt", on a grammar laid out badly, which must
+// keep its comments and its %if blocks.  Formatting the result again
+// must change nothing.  Run as follows:
+//
+//     golemon fmt fmt-test01.y | diff fmt-test01.out - && golemon fmt fmt-test01.out | diff fmt-test01.out -
+//
+
+%token_type   {int}
+%type expr {int}
+  %left PLUS   MINUS.
+%left TIMES .
+
+%include {
+import "strings"
+var   total=0
+}
+
+/* The start symbol */
+program ::= expr( A ).   { total=A }
+expr(A)::=expr(B) PLUS expr(C). {A=B+C}
+   // Subtraction
+expr(A) ::= expr(B)   MINUS
+      expr(C).   { A = B - C }
+%ifdef TIMES
+expr(A) ::= expr(B) TIMES expr(C). { A = B *
+	C }
+%else
+expr(A) ::= expr(B) expr(C) [PLUS].
+%endif
+
+
+expr(A) ::= NUM(B). { A = B; _ = strings.ToLower }
+expr ::= LP expr RP .
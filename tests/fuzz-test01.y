@@ -0,0 +1,29 @@
+// A test that the fuzz test golemon writes with -fuzz compiles, passes
+// go vet and passes on its seed corpus, for a grammar with destructors and
+// with actions that take only some of their values.  Run as follows:
+//
+//     golemon -fuzz -q fuzz-test01.y && go vet ./fuzz-test01.go ./fuzz-test01_fuzz_test.go && go test ./fuzz-test01.go ./fuzz-test01_fuzz_test.go
+//
+
+%token_type {string}
+%type expr {[]string}
+%type args {[]string}
+%left PLUS.
+%left TIMES.
+
+%include {
+var nDestroyed = 0
+}
+
+%destructor expr { nDestroyed++ }
+%destructor args { nDestroyed++ }
+%token_destructor { nDestroyed++ }
+
+program ::= expr.
+expr(A) ::= expr(B) PLUS expr(C).       { A = append(B, C...) }
+expr(A) ::= expr TIMES expr(C).         { A = C }
+expr(A) ::= ID(B) LP args(C) RP.        { A = append([]string{B}, C...) }
+expr(A) ::= ID(B).                      { A = []string{B} }
+args(A) ::= .                           { A = nil }
+args(A) ::= args(B) COMMA expr(C).      { A = append(B, C...) }
+args(A) ::= expr(B).                    { A = B }
@@ -0,0 +1,9 @@
+// A test case for the header of the generated parser, which names the
+// version of golemon, hashes the grammar and the template, and lists the
+// -D defines in effect.  The version and the hash of the template are
+// left out, as they change from one build to the next.  Run as follows:
+//
+//     golemon -q -o - -D DIALECT=pg -D TRACE -U TRACE header-test01.y | sed -n 1,10p | sed 's/^\(\*\* Generator: *golemon \).*/\1VERSION/; s/^\(\*\* Template: .*sha256:\).*/\1HASH/' | diff header-test01.out -
+//
+
+program ::= A.
@@ -0,0 +1,78 @@
+// A test case for %include_file, %import and -I.  Run as follows:
+//
+//     golemon -I include-test01/lib include-test01.y && go run ./include-test01.go
+//
+// include-test01/expr.y holds the rules for expr, and imports tokens.y
+// from include-test01/lib, which this file imports first.
+
+%import "tokens.y"
+%include_file "include-test01/expr.y"
+%start_symbol program
+%type program {int}
+
+%include {
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+func yytestcase(condition bool) {}
+}
+
+program(A) ::= expr(E).             { A = E }
+
+%code {
+/* The place in the grammar of the last action to call atoi */
+var where string
+
+/* Return the file and line of the caller */
+func here() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+func atoi(s string, at string) int {
+	where = at
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Parse input, and return its value or error */
+func parse(input string) string {
+	result, err := ParseAll(ParseNewLexer(input))
+	if err != nil {
+		return err.Error()
+	}
+	return strconv.Itoa(result)
+}
+
+func main() {
+	/* Rules and precedence from the included files */
+	testCase(100, "7", parse("1 + 2 * 3"))
+	testCase(110, "1:5: syntax error near PLUS", parse("1 + + 2"))
+
+	/* The //line directives name the file each action came from */
+	testCase(200, "tokens.y:12", where)
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
@@ -0,0 +1,3 @@
+// Part of a cycle of files, for include-test02.y.
+
+%import "../include-test02.y"
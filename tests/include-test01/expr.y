@@ -0,0 +1,10 @@
+// Rules for include-test01.y, read with %include_file.
+
+%import "tokens.y"
+%type expr  {int}
+%left PLUS.
+%left STAR.
+
+expr(A) ::= expr(X) PLUS expr(Y).   { A = X + Y }
+expr(A) ::= expr(X) STAR expr(Y).   { A = X * Y }
+expr(A) ::= num(X).                 { A = X }
@@ -0,0 +1,12 @@
+// Tokens for include-test01.y, found with -I.  Both include-test01.y
+// and expr.y import this file, which it is an error to read twice.
+
+%token_type string
+%type num   {int}
+
+%token_pattern NUM  "[0-9]+"
+%token_pattern PLUS "\+"
+%token_pattern STAR "\*"
+%skip_pattern       " +"
+
+num(A) ::= NUM(X).                  { A = atoi(X, here()) }
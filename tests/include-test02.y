@@ -0,0 +1,8 @@
+// A test case for a cycle of %include_file and %import.  Run as follows:
+//
+//     golemon -q include-test02.y 2>&1 | sed "s|$PWD/||g" | diff include-test02.out -
+
+%include_file "include-test01/cycle.y"
+%include_file "include-test02.y"
+
+prog ::= .
@@ -0,0 +1,218 @@
+// A test case for incremental reparsing with ParseIncremental, which
+// checks that each Edit() gives the same tree, syntax errors and error
+// as parsing all the tokens again.  Run as follows:
+//
+//     golemon -cst -incremental incremental-test01.y && go run ./incremental-test01.go
+//
+
+%token_type string
+%left PLUS.
+%sync SEMI RBRACE.
+
+%token_pattern ID     "[a-z]+"
+%token_pattern PLUS   "\+"
+%token_pattern LP     "\("
+%token_pattern RP     "\)"
+%token_pattern COMMA  ","
+%token_pattern SEMI   ";"
+%token_pattern LBRACE "\{"
+%token_pattern RBRACE "\}"
+%skip_pattern         "[ \t\n]+"
+
+%include {
+import (
+	"context"
+	"math/rand"
+	"strings"
+)
+
+func yytestcase(condition bool) {}
+}
+
+program ::= stmts.
+stmts ::= .
+stmts ::= stmts stmt.
+stmt ::= expr SEMI.
+stmt ::= LBRACE stmts RBRACE.
+stmt ::= error SEMI.
+expr ::= expr PLUS expr.
+expr ::= LP expr RP.
+expr ::= ID.
+expr ::= ID LP args RP.
+args ::= expr.
+args ::= expr COMMA args.
+
+%code {
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* A ParseLexer for a slice of tokens */
+type tokenLexer struct {
+	tokens []ParseToken
+	trivia string
+}
+
+func (l *tokenLexer) Next() (YYCODETYPE, ParseTOKENTYPE, ParseLocation, error) {
+	t := l.tokens[0]
+	l.tokens = l.tokens[1:]
+	l.trivia = t.Trivia
+	return t.Major, t.Minor, t.Loc, nil
+}
+
+func (l *tokenLexer) Trivia() string {
+	return l.trivia
+}
+
+/* Describe the tree, the syntax errors and the error of a parse */
+func describe(root *ParseNode, diags []ParseDiagnostic, err error) string {
+	var b strings.Builder
+	ParseFprint(&b, root)
+	for _, d := range diags {
+		fmt.Fprintln(&b, d)
+	}
+	fmt.Fprint(&b, err)
+	return b.String()
+}
+
+/* Parse all the tokens of inc again, as recovery says */
+func full(inc *ParseIncremental, recovery ParseRecovery) string {
+	root, diags, err := ParseAllRecover(context.Background(), &tokenLexer{tokens: inc.Tokens()}, ParseLimits{}, recovery)
+	return describe(root, diags, err)
+}
+
+/* Make the first change of old to new in *text, give inc the tokens
+** that changed, and return the text of the tree */
+func edit(inc *ParseIncremental, text *string, old, new string) (string, string) {
+	*text = strings.Replace(*text, old, new, 1)
+	a := inc.Tokens()
+	b, _ := ParseTokens(ParseNewLexer(*text))
+	i, j := 0, 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	for j < len(a)-i && j < len(b)-i {
+		x, y := a[len(a)-1-j], b[len(b)-1-j]
+		if x.Major != y.Major || x.Minor != y.Minor || x.Trivia != y.Trivia {
+			break
+		}
+		j++
+	}
+	root, err := inc.Edit(i, len(a)-j, b[i:len(b)-j]...)
+	var s strings.Builder
+	ParseFprintSource(&s, root)
+	return s.String(), describe(root, inc.Diagnostics(), err)
+}
+
+func main() {
+	var doc strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&doc, "x%s + f(a, (b), c);\n{ y; { z + w; } }\n", strings.Repeat("x", i%3))
+	}
+	text := doc.String()
+	tokens, _ := ParseTokens(ParseNewLexer(text))
+	inc := ParseNewIncremental(ParseRecovery{})
+	root, err := inc.Edit(0, 0, tokens...)
+	testCase(100, full(inc, ParseRecovery{}), describe(root, inc.Diagnostics(), err))
+	testCase(110, fmt.Sprint(len(tokens)), fmt.Sprint(inc.Parsed()))
+
+	/* A change in the middle parses a few tokens around it, and one for
+	** each statement after it, to build the list of statements again */
+	source, tree := edit(inc, &text, "xx + f(a, (b), c);\n{ y; { z", "xx + f(a, (b), c);\n{ y; { q")
+	testCase(200, full(inc, ParseRecovery{}), tree)
+	testCase(210, text, source)
+	testCase(220, "true", fmt.Sprint(inc.Parsed() < len(tokens)/4))
+
+	/* Statements put in and taken out */
+	source, tree = edit(inc, &text, "y;", "y; { v + u; } t;")
+	testCase(300, full(inc, ParseRecovery{}), tree)
+	testCase(310, text, source)
+	source, tree = edit(inc, &text, "xx + f(a, (b), c);\n", "")
+	testCase(320, full(inc, ParseRecovery{}), tree)
+	testCase(330, text, source)
+	source, tree = edit(inc, &text, "x + f(a, (b), c);", "x + f(a, b, (c + d), e);")
+	testCase(340, full(inc, ParseRecovery{}), tree)
+	testCase(350, text, source)
+
+	/* A syntax error, and then its fix */
+	source, tree = edit(inc, &text, "z + w;", "z + + w;")
+	testCase(400, full(inc, ParseRecovery{}), tree)
+	testCase(410, "true", fmt.Sprint(len(inc.Diagnostics()) == 1 && strings.Contains(tree, "syntax error near PLUS")))
+	source, tree = edit(inc, &text, "z + + w;", "z + w;")
+	testCase(420, full(inc, ParseRecovery{}), tree)
+	testCase(430, "0 "+text, fmt.Sprint(len(inc.Diagnostics()), " ", source))
+
+	/* A change at each end of the document */
+	source, tree = edit(inc, &text, "x + f", "g; x + f")
+	testCase(500, full(inc, ParseRecovery{}), tree)
+	text += "h;"
+	source, tree = edit(inc, &text, "", "")
+	testCase(510, full(inc, ParseRecovery{}), tree)
+	testCase(520, text, source)
+
+	/* Random edits of the tokens, which are mostly syntax errors, with
+	** each strategy of recovery */
+	pool, _ := ParseTokens(ParseNewLexer(" a + ( ) , ; { }"))
+	pool = pool[:len(pool)-1]
+	insert := []YYCODETYPE{SEMI, RP}
+	for i, recovery := range []ParseRecovery{{}, {Insert: insert, Delete: true}, {Insert: insert, Delete: true, Sync: true}} {
+		rng := rand.New(rand.NewSource(int64(i)))
+		inc := ParseNewIncremental(recovery)
+		tokens, _ := ParseTokens(ParseNewLexer(text[:400]))
+		inc.Edit(0, 0, tokens...)
+		nBad, nParsed, nTokens := 0, 0, 0
+		for n := 0; n < 500; n++ {
+			start := rng.Intn(len(inc.Tokens()))
+			end := start + rng.Intn(3)
+			if end >= len(inc.Tokens()) {
+				end = len(inc.Tokens()) - 1
+			}
+			var tokens []ParseToken
+			for k := rng.Intn(3); k > 0; k-- {
+				t := pool[rng.Intn(len(pool))]
+				t.Loc.Offset = 1000 + n
+				tokens = append(tokens, t)
+			}
+			root, err := inc.Edit(start, end, tokens...)
+			if describe(root, inc.Diagnostics(), err) != full(inc, recovery) {
+				nBad++
+			}
+			nParsed += inc.Parsed()
+			nTokens += len(inc.Tokens())
+		}
+		testCase(600+10*i, "0", fmt.Sprint(nBad))
+
+		/* While the parser discards tokens up to a %sync token, which it
+		** does to the end of input after a stray RBRACE, a parse cannot
+		** converge */
+		if !recovery.Sync {
+			testCase(605+10*i, "true", fmt.Sprint(nParsed < nTokens/4))
+		}
+	}
+
+	/* An edit out of range, or with a code that is not a terminal, leaves
+	** the document as it was */
+	n := len(inc.Tokens())
+	_, err = inc.Edit(n, n+1)
+	testCase(700, fmt.Sprintf("cannot replace tokens %d to %d of %d", n, n+1, n), fmt.Sprint(err))
+	_, err = inc.Edit(0, 0, ParseToken{Major: YYNOCODE})
+	testCase(710, fmt.Sprintf("offset 0: token code %d is not a terminal %d", YYNOCODE, n),
+		fmt.Sprint(err, " ", len(inc.Tokens())))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
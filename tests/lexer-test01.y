@@ -0,0 +1,170 @@
+// A test case for the lexer built from %token_pattern.  Run as follows:
+//
+//     golemon lexer-test01.y && go run ./lexer-test01.go
+//
+// The generated lexer is compared with a reference lexer that tries
+// each pattern with Go's regexp package.
+
+%token_type   string
+%type stmt    {string}
+%type cols    {[]string}
+%type expr    {string}
+%left PLUS.
+%left ARROW.
+
+%token_pattern SELECT "(?i)select"
+%token_pattern FROM   "(?i)from"
+%token_pattern ID     "[A-Za-z_][A-Za-z_0-9]*"
+%token_pattern NUM    "[0-9]+(\.[0-9]+)?"
+%token_pattern STRING "'([^'\n]|'')*'"
+%token_pattern COMMA  ","
+%token_pattern STAR   "\*"
+%token_pattern PLUS   "\+"
+%token_pattern ARROW  "->|→"
+%skip_pattern         "[ \t\n]+|--[^\n]*"
+%fallback ID FROM.
+
+%include {
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+func yytestcase(condition bool) {}
+}
+
+stmt(A) ::= SELECT cols(C) FROM ID(T).    { A = strings.Join(C, ";") + " from " + T }
+stmt(A) ::= SELECT STAR FROM ID(T).       { A = "* from " + T }
+cols(A) ::= expr(E).                      { A = []string{E} }
+cols(A) ::= cols(C) COMMA expr(E).        { A = append(C, E) }
+expr(A) ::= ID(X).                        { A = X }
+expr(A) ::= NUM(X).                       { A = X }
+expr(A) ::= STRING(X).                    { A = X }
+expr(A) ::= expr(X) ARROW ID(Y).          { A = X + "." + Y }
+expr(A) ::= expr(X) PLUS expr(Y).         { A = "(" + X + "+" + Y + ")" }
+
+%code {
+/* The patterns, as declared above, with 0 for %skip_pattern */
+var patterns = []struct {
+	major   YYCODETYPE
+	re      string
+	keyword bool
+}{
+	{SELECT, "(?i)select", true},
+	{FROM, "(?i)from", true},
+	{ID, "[A-Za-z_][A-Za-z_0-9]*", false},
+	{NUM, "[0-9]+(\\.[0-9]+)?", false},
+	{STRING, "'([^'\\n]|'')*'", false},
+	{COMMA, ",", true},
+	{STAR, "\\*", true},
+	{PLUS, "\\+", true},
+	{ARROW, "->|→", false},
+	{0, "[ \\t\\n]+|--[^\\n]*", false},
+}
+
+/* Return the tokens of input, as found by the reference lexer */
+func reference(input string) []string {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		res[i] = regexp.MustCompile("^(?:" + p.re + ")")
+		res[i].Longest()
+	}
+	var tokens []string
+	for pos := 0; pos < len(input); {
+		best, length := -1, 0
+		for i, re := range res {
+			m := re.FindStringIndex(input[pos:])
+			if m == nil || m[1] < length {
+				continue
+			}
+			if m[1] > length || (patterns[i].keyword && !patterns[best].keyword) {
+				best, length = i, m[1]
+			}
+		}
+		if best < 0 {
+			return append(tokens, fmt.Sprintf("error at %d", pos))
+		}
+		if patterns[best].major != 0 {
+			tokens = append(tokens, yyTokenName[patterns[best].major]+":"+input[pos:pos+length])
+		}
+		pos += length
+	}
+	return tokens
+}
+
+/* Return the tokens of input, as found by the generated lexer */
+func generated(input string) []string {
+	var tokens []string
+	lex := ParseNewLexer(input)
+	for {
+		major, minor, loc, err := lex.Next()
+		if err != nil {
+			return append(tokens, fmt.Sprintf("error at %d", loc.Offset))
+		}
+		if major == 0 {
+			return tokens
+		}
+		tokens = append(tokens, yyTokenName[major]+":"+minor)
+	}
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+func parse(input string) string {
+	result, err := ParseAll(ParseNewLexer(input))
+	if err != nil {
+		return err.Error()
+	}
+	return result
+}
+
+func main() {
+	testCase(100, "a;(1+'x''y') from t", parse("SELECT a, 1 + 'x''y' FROM t"))
+	testCase(110, "from;b.c from t", parse("select from, b->c -- columns\n from t"))
+	testCase(120, "selection from fromage", parse("select selection from fromage"))
+	testCase(130, "* from t", parse("Select * From t"))
+	testCase(200, "2:1: syntax error at the end of input", parse("select a from\n"))
+	testCase(210, "1:10: unexpected character '$'", parse("select a $ from t"))
+
+	/* Compare the lexers on random text */
+	pieces := []string{"select", "SeLeCt", "from", "selectfrom", "x", "_1", "42", "3.14", "1.",
+		"'", "''", "'it''s'", ",", "*", "+", "-", "->", "→", " ", "\t", "\n", "--", "é", "$"}
+	rnd := rand.New(rand.NewSource(1))
+	mismatches := 0
+	for n := 0; n < 20000; n++ {
+		var b strings.Builder
+		for k := rnd.Intn(12); k > 0; k-- {
+			b.WriteString(pieces[rnd.Intn(len(pieces))])
+		}
+		input := b.String()
+		want := strings.Join(reference(input), " ")
+		got := strings.Join(generated(input), " ")
+		if got != want {
+			if mismatches < 5 {
+				fmt.Printf("input %q: got %s, expected %s\n", input, got, want)
+			}
+			mismatches++
+		}
+	}
+	testCase(300, "0", fmt.Sprint(mismatches))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
@@ -0,0 +1,155 @@
+// A test case for the limits of ParseSetLimits() and ParseAllContext().
+// Run as follows:
+//
+//     golemon -pull limit-test01.y && go run ./limit-test01.go
+//
+
+%token_type int
+%type expr {int}
+%stack_size 0
+%left PLUS.
+
+%include {
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var nLive = 0 /* Values of expr made and not yet used or destroyed */
+
+func yytestcase(condition bool) {}
+}
+
+%token BAD.
+%destructor expr { nLive-- }
+
+program ::= exprs.
+exprs ::= .
+exprs ::= exprs expr(B) SEMI.           { _ = B; nLive-- }
+exprs ::= exprs error SEMI.
+expr(A) ::= LP expr(B) RP.              { A = B }
+expr(A) ::= expr(B) PLUS expr(C).       { A = B + C; nLive-- }
+expr(A) ::= NUM(B).                     { A = B; nLive++ }
+
+%code {
+/* A lexer for a string, in which each character is a token, and which
+** calls hook, if it is not nil, before each token */
+type charLexer struct {
+	input string
+	pos   int
+	hook  func(pos int)
+}
+
+func (l *charLexer) Next() (YYCODETYPE, ParseTOKENTYPE, ParseLocation, error) {
+	if l.hook != nil {
+		l.hook(l.pos)
+	}
+	loc := ParseLocation{Offset: l.pos, Line: 1, Column: l.pos + 1}
+	if l.pos >= len(l.input) {
+		return 0, 0, loc, nil
+	}
+	c := l.input[l.pos]
+	l.pos++
+	switch {
+	case c == '(':
+		return LP, 0, loc, nil
+	case c == ')':
+		return RP, 0, loc, nil
+	case c == '+':
+		return PLUS, 0, loc, nil
+	case c == ';':
+		return SEMI, 0, loc, nil
+	case c >= '0' && c <= '9':
+		return NUM, int(c - '0'), loc, nil
+	}
+	return BAD, 0, loc, nil
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Parse input with limits, and describe the error, if any, and whether
+** every value was used or destroyed */
+func run(ctx context.Context, input string, limits ParseLimits) string {
+	nLive = 0
+	_, err := ParseAllContext(ctx, &charLexer{input: input}, limits)
+	var limitErr *ParseLimitError
+	s := fmt.Sprint(err)
+	if errors.As(err, &limitErr) {
+		s = fmt.Sprintf("%s %s", yyTokenName[limitErr.Token], err)
+	}
+	return fmt.Sprintf("%s, %d live", s, nLive)
+}
+
+func main() {
+	deep := strings.Repeat("(", 5000) + "1" + strings.Repeat(")", 5000) + ";"
+	none := ParseLimits{}
+	testCase(100, "<nil>, 0 live", run(context.Background(), deep, none))
+	testCase(110, "LP 1:100: parse limit exceeded: more than 100 stack entries, 0 live",
+		run(context.Background(), deep, ParseLimits{MaxDepth: 100}))
+	testCase(120, "NUM 1:10: parse limit exceeded: more than 6 stack entries, 0 live",
+		run(context.Background(), "1+2;3+(4+5);", ParseLimits{MaxDepth: 6}))
+	testCase(130, "<nil>, 0 live", run(context.Background(), "1+2;3+(4+5);", ParseLimits{MaxDepth: 7}))
+
+	testCase(200, "NUM 1:7: parse limit exceeded: more than 6 tokens, 0 live",
+		run(context.Background(), "1+2;3+4;", ParseLimits{MaxTokens: 6}))
+	testCase(210, "<nil>, 0 live", run(context.Background(), "1+2;3+4;", ParseLimits{MaxTokens: 8}))
+	testCase(220, "PLUS 1:6: parse limit exceeded: more than 5 reductions, 0 live",
+		run(context.Background(), "1+2;3+4;", ParseLimits{MaxReductions: 5}))
+	testCase(230, "1:2: syntax error near BAD, 0 live",
+		run(context.Background(), "1?;2?;3?;", ParseLimits{MaxRecoveries: 6}))
+	testCase(240, "BAD 1:8: parse limit exceeded: more than 5 error recoveries, 0 live",
+		run(context.Background(), "1?;2?;3?;", ParseLimits{MaxRecoveries: 5}))
+
+	/* The context is checked before each token is read */
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	testCase(300, "context canceled, 0 live", run(ctx, "1+2;", none))
+	ctx, cancel = context.WithCancel(context.Background())
+	lex := &charLexer{input: "1+(2+3);", hook: func(pos int) {
+		if pos == 4 {
+			cancel()
+		}
+	}}
+	_, err := ParseAllContext(ctx, lex, none)
+	testCase(310, "context canceled 5", fmt.Sprint(err, " ", lex.pos))
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, err = ParseAllContext(ctx, &charLexer{input: "1;"}, none)
+	cancel()
+	testCase(320, "true", fmt.Sprint(errors.Is(err, context.DeadlineExceeded)))
+
+	/* In push mode, the parser ignores its tokens once a limit is
+	** exceeded, until ParseInit() */
+	p := ParseAlloc()
+	p.ParseSetLimits(ParseLimits{MaxTokens: 2})
+	p.Parse(NUM, 1)
+	p.Parse(SEMI, 0)
+	testCase(400, "<nil>", fmt.Sprint(p.ParseLimitErr()))
+	p.Parse(NUM, 2)
+	p.Parse(SEMI, 0)
+	testCase(410, "parse limit exceeded: more than 2 tokens", fmt.Sprint(p.ParseLimitErr()))
+	p.ParseInit()
+	p.Parse(NUM, 3)
+	testCase(420, "<nil> 2", fmt.Sprint(p.ParseLimitErr(), " ", p.yytos))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
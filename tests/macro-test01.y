@@ -0,0 +1,118 @@
+// A test case for parameterised nonterminals declared with %macro.  Run
+// as follows:
+//
+//     golemon macro-test01.y && go run ./macro-test01.go
+//
+// seplist is used with a terminal, with a nonterminal, with another
+// macro, and with itself as its argument.  tagged has a formal named as
+// one of its aliases.
+
+%token_type   string
+%type value   {string}
+%type num     {int}
+%type word    {string}
+
+%macro seplist(SEP, X)
+%type seplist {[]$X}
+%destructor seplist {
+	var zero $X
+	destroyed = append(destroyed, fmt.Sprintf("%d of %T", len($$), zero))
+}
+seplist(A) ::= X(B).                          { A = []$X{B} }
+seplist(A) ::= seplist(SEP, X)(A) SEP X(B).   { A = append(A, B) }
+
+%macro pair(K, V)
+%type pair {struct{ K $K; V $V }}
+pair(A) ::= K(B) COLON V(C).                  { A.K, A.V = B, C }
+
+%macro tagged(B, T)
+%type tagged {string}
+tagged(A) ::= T(B) COLON B(C).                { A = fmt.Sprint(B, "=", C) }
+
+%token_pattern NUM    "[0-9]+"
+%token_pattern ID     "[a-z]+"
+%token_pattern LB     "\["
+%token_pattern RB     "\]"
+%token_pattern LC     "\{"
+%token_pattern RC     "\}"
+%token_pattern LP     "\("
+%token_pattern RP     "\)"
+%token_pattern COMMA  ","
+%token_pattern SEMI   ";"
+%token_pattern COLON  ":"
+%skip_pattern         "[ \t\n]+"
+
+%include {
+import (
+	"strconv"
+	"strings"
+)
+
+func yytestcase(condition bool) {}
+}
+
+value(A) ::= LB seplist(COMMA, num)(L) RB.                  { A = fmt.Sprint(L) }
+value(A) ::= LC seplist(COMMA, pair(word, num))(L) RC.      { A = fmt.Sprintf("%+v", L) }
+value(A) ::= LP seplist(SEMI, seplist(COMMA, num))(L) RP.   { A = fmt.Sprint(L) }
+value(A) ::= seplist(COMMA, ID)(L).                         { A = strings.Join(L, "|") }
+value(A) ::= COLON tagged(num, word)(L).                    { A = L }
+num(A) ::= NUM(X).                                          { A, _ = strconv.Atoi(X) }
+word(A) ::= ID(X).                                          { A = X }
+
+%code {
+/* The values given to the destructor of seplist */
+var destroyed []string
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Parse input, and return its value or error */
+func parse(input string) string {
+	result, err := ParseAll(ParseNewLexer(input))
+	if err != nil {
+		return err.Error()
+	}
+	return result
+}
+
+func main() {
+	/* An instance with a terminal, and one with a nonterminal */
+	testCase(100, "a|b|c", parse("a, b, c"))
+	testCase(110, "[1 2 3]", parse("[1, 2, 3]"))
+
+	/* An instance of a macro as the argument of another */
+	testCase(200, "[{K:a V:1} {K:b V:2}]", parse("{a: 1, b: 2}"))
+	testCase(210, "[[1 2] [3] [4 5]]", parse("(1, 2; 3; 4, 5)"))
+
+	/* An alias with the name of a formal is not replaced */
+	testCase(220, "a=1", parse(": a : 1"))
+
+	/* The destructor of each instance, with its own $X */
+	destroyed = nil
+	testCase(300, "1:7: syntax error near ID", parse("[1, 2 x"))
+	testCase(310, "[2 of int]", fmt.Sprint(destroyed))
+	destroyed = nil
+	testCase(320, "1:9: syntax error near RC", parse("{a: 1, b}"))
+	testCase(330, "[1 of struct { K string; V int }]", fmt.Sprint(destroyed))
+	destroyed = nil
+	testCase(340, "1:10: syntax error near LB", parse("(1, 2; 3 ["))
+	testCase(350, "[2 of []int]", fmt.Sprint(destroyed))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
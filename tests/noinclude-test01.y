@@ -0,0 +1,29 @@
+// A test case for a grammar with no %include and no %token_type, whose
+// parser must still be valid Go.  Run as follows:
+//
+//     golemon noinclude-test01.y && go run ./noinclude-test01.go
+//
+
+all ::= A B.
+
+%parse_accept {
+	nAccept++
+}
+%code {
+var nAccept = 0
+
+func yytestcase(condition bool) {}
+
+func main() {
+	p := ParseAlloc()
+	p.Parse(A, "a")
+	p.Parse(B, "b")
+	p.Parse(0, nil)
+	p.ParseFinalize()
+	if nAccept != 1 {
+		fmt.Printf("test 100: got %d, expected 1\n", nAccept)
+		os.Exit(1)
+	}
+	fmt.Printf("test 100: ok\n1 tests pass\n")
+}
+}
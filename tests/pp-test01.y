@@ -0,0 +1,45 @@
+// A test case for the preprocessor.  Run as follows:
+//
+//     golemon -E -D DIALECT=pg -D VERSION=12 -D TRACE -D DEBUG -U DEBUG pp-test01.y | diff pp-test01.out -
+//
+// Each directive is left as a comment noting whether its branch was
+// taken, and the lines of branches not taken are left empty.
+
+%define LIMIT 10
+%define VERSION 9
+
+%ifdef TRACE
+%token TRACED.
+%ifdef DEBUG
+%token DEBUGGED.
+%elif VERSION >= 12 && LIMIT == 10
+%token NEW_ENOUGH.
+%if DIALECT == "lite"
+%token LITE.
+%else
+%token NOT_LITE.
+%endif
+%else
+%token NEITHER.
+%endif
+%endif
+
+%ifndef DEBUG
+%if DIALECT != "pg" || !TRACE
+%token UNREACHED.
+%elif VERSION < 12
+%token OLD.
+%elif (VERSION > 11 && DIALECT == "pg") && !(LIMIT < 5)
+%token PG12.
+%endif
+%else
+%token UNDEFINED_BY_U.
+%endif
+
+%ifdef UNDEFINED
+%if BOGUS == 1
+%token SKIPPED.
+%endif
+%endif
+
+prog ::= .
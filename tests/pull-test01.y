@@ -0,0 +1,91 @@
+// A test case for ParseAll(), the pull-mode driver.  Run as follows:
+//
+//     golemon -pull pull-test01.y && go run ./pull-test01.go
+//
+
+%token_prefix TK_
+%token_type   int
+%type expr    {int}
+%type program {int}
+%left PLUS.
+%left TIMES.
+%include {
+var nSyntaxError = 0
+
+func yytestcase(condition bool) {}
+}
+
+program(A) ::= expr(B).                 { A = B }
+expr(A)    ::= expr(B) PLUS expr(C).    { A = B + C }
+expr(A)    ::= expr(B) TIMES expr(C).   { A = B * C }
+expr(A)    ::= LP expr(B) RP.           { A = B }
+expr(A)    ::= LP error RP.             { A = -1 }
+expr(A)    ::= NUM(B).                  { A = B }
+
+%syntax_error {
+	nSyntaxError++
+}
+%code {
+/* A lexer that returns the tokens of a slice, each on its own column */
+type sliceLexer struct {
+	tokens []YYCODETYPE
+	values []int
+	pos    int
+	err    error /* Returned instead of the end of input, if not nil */
+}
+
+func (l *sliceLexer) Next() (YYCODETYPE, ParseTOKENTYPE, ParseLocation, error) {
+	loc := ParseLocation{Offset: l.pos, Line: 1, Column: l.pos + 1}
+	if l.pos >= len(l.tokens) {
+		return 0, 0, loc, l.err
+	}
+	l.pos++
+	return l.tokens[l.pos-1], l.values[l.pos-1], loc, nil
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+func run(tokens []YYCODETYPE, values []int, lexErr error) string {
+	result, err := ParseAll(&sliceLexer{tokens: tokens, values: values, err: lexErr})
+	if err != nil {
+		return fmt.Sprintf("%d %v", result, err)
+	}
+	return fmt.Sprintf("%d", result)
+}
+
+func main() {
+	testCase(100, "7", run(
+		[]YYCODETYPE{TK_NUM, TK_PLUS, TK_NUM, TK_TIMES, TK_NUM},
+		[]int{1, 0, 2, 0, 3}, nil))
+	testCase(110, "9", run(
+		[]YYCODETYPE{TK_LP, TK_NUM, TK_PLUS, TK_NUM, TK_RP, TK_TIMES, TK_NUM},
+		[]int{0, 1, 0, 2, 0, 0, 3}, nil))
+	testCase(200, "9 1:6: syntax error near TIMES", run(
+		[]YYCODETYPE{TK_NUM, TK_PLUS, TK_LP, TK_NUM, TK_TIMES, TK_TIMES, TK_RP, TK_PLUS, TK_NUM},
+		[]int{1, 0, 0, 2, 0, 0, 0, 0, 9}, nil))
+	testCase(210, "1", fmt.Sprint(nSyntaxError))
+	testCase(220, "0 1:3: syntax error at the end of input", run(
+		[]YYCODETYPE{TK_NUM, TK_PLUS},
+		[]int{1, 0}, nil))
+	testCase(300, "0 unexpected character", run(
+		[]YYCODETYPE{TK_NUM, TK_PLUS},
+		[]int{1, 0}, fmt.Errorf("unexpected character")))
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
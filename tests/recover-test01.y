@@ -0,0 +1,162 @@
+// A test case for the strategies of ParseRecovery, and the diagnostics
+// of ParseAllRecover() and ParseDiagnostics().  The %sync declaration
+// makes golemon generate ParseRecover().  Run as follows:
+//
+//     golemon recover-test01.y && go run ./recover-test01.go
+//
+
+%token_type int
+%type expr {int}
+%left PLUS.
+%sync SEMI RBRACE.
+
+%include {
+import (
+	"context"
+	"strings"
+)
+
+var results []int       /* The value of each statement, or -1 for an error */
+var nTokenDestroyed = 0 /* Tokens destroyed */
+
+func yytestcase(condition bool) {}
+}
+
+%token_destructor { nTokenDestroyed++ }
+
+program ::= stmts.
+stmts ::= .
+stmts ::= stmts stmt.
+stmt ::= expr(A) SEMI.                  { results = append(results, A) }
+stmt ::= error SEMI.                    { results = append(results, -1) }
+stmt ::= LBRACE stmts RBRACE.
+expr(A) ::= expr(B) PLUS expr(C).       { A = B + C }
+expr(A) ::= LP expr(B) RP.              { A = B }
+expr(A) ::= NUM(B).                     { A = B }
+
+%code {
+/* A lexer for a string, in which each character other than a space is a
+** token */
+type charLexer struct {
+	input string
+	pos   int
+}
+
+func (l *charLexer) Next() (YYCODETYPE, ParseTOKENTYPE, ParseLocation, error) {
+	for l.pos < len(l.input) && l.input[l.pos] == ' ' {
+		l.pos++
+	}
+	loc := ParseLocation{Offset: l.pos, Line: 1, Column: l.pos + 1}
+	if l.pos >= len(l.input) {
+		return 0, 0, loc, nil
+	}
+	c := l.input[l.pos]
+	l.pos++
+	switch c {
+	case '+':
+		return PLUS, 0, loc, nil
+	case ';':
+		return SEMI, 0, loc, nil
+	case '(':
+		return LP, 0, loc, nil
+	case ')':
+		return RP, 0, loc, nil
+	case '{':
+		return LBRACE, 0, loc, nil
+	case '}':
+		return RBRACE, 0, loc, nil
+	}
+	return NUM, int(c - '0'), loc, nil
+}
+
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Parse input, recovering from errors as recovery says, and describe the
+** value of each statement and the diagnostics */
+func run(input string, recovery ParseRecovery) string {
+	results = nil
+	_, diags, _ := ParseAllRecover(context.Background(), &charLexer{input: input}, ParseLimits{}, recovery)
+	s := []string{fmt.Sprint(results)}
+	for _, d := range diags {
+		s = append(s, d.String())
+	}
+	return strings.Join(s, "; ")
+}
+
+func main() {
+	/* The classic scheme, with the error token */
+	testCase(100, "[3 -1 4]; 1:7: syntax error near SEMI, recovered with the error token",
+		run("1+2;3+;4;", ParseRecovery{}))
+
+	/* The first token of Insert that works is inserted */
+	insert := ParseRecovery{Insert: []YYCODETYPE{NUM, SEMI, RP}, Window: -1}
+	testCase(200, "[1 2 3 4]; 1:3: syntax error near SEMI, inserted NUM; "+
+		"1:6: syntax error near NUM, inserted SEMI; 1:10: syntax error near SEMI, inserted RP",
+		run("1+;2 3;(4;", insert))
+	testCase(210, "[-1 2]; 1:2: syntax error near RP, recovered with the error token",
+		run("1)2;", ParseRecovery{Insert: insert.Insert}))
+
+	/* A token is deleted if the next can be taken in its place; if not,
+	** the parser recovers as it would have */
+	del := ParseRecovery{Delete: true, Window: -1}
+	testCase(300, "[3 3]; 1:3: syntax error near RP, deleted it; 1:8: syntax error near SEMI, deleted it",
+		run("1+)2;3;;", del))
+	testCase(310, "[-1]; 1:3: syntax error near RP, recovered with the error token",
+		run("1+))2;", ParseRecovery{Delete: true}))
+
+	/* Tokens are discarded up to a %sync token, and the stack popped to
+	** a state that can take it, perhaps after a nonterminal */
+	sync := ParseRecovery{Sync: true, Window: -1}
+	testCase(400, "[0 2 5]; 1:4: syntax error near SEMI, skipped 0 tokens to SEMI; "+
+		"1:10: syntax error near NUM, skipped 1 tokens to RBRACE",
+		run("(1+;2;{3 4}5;", sync))
+	testCase(410, "[]; 1:5: syntax error at the end of input, skipped 0 tokens to the end of input",
+		run("1+(2", sync))
+	testCase(420, "[1]; 1:2: syntax error near RBRACE, skipped 2 tokens to SEMI",
+		run("1}2;", sync))
+
+	/* Within the window, errors are recovered from but not reported */
+	plus := []YYCODETYPE{PLUS}
+	testCase(500, "[3 18]; 1:3: syntax error near NUM, inserted PLUS; 1:7: syntax error near NUM, inserted PLUS",
+		run("1 2;3 4 5 6;", ParseRecovery{Insert: plus, Window: 2}))
+	testCase(510, "[3 18]; 1:3: syntax error near NUM, inserted PLUS; 1:7: syntax error near NUM, inserted PLUS; "+
+		"1:11: syntax error near NUM, inserted PLUS",
+		run("1 2;3 4+5 6;", ParseRecovery{Insert: plus, Window: 2}))
+	testCase(520, "[3 18]; 1:3: syntax error near NUM, inserted PLUS",
+		run("1 2;3 4+5 6;", ParseRecovery{Insert: plus, Window: 4}))
+
+	/* In push mode, a token held back by Delete is copied by ParseClone()
+	** and destroyed by ParseFinalize() */
+	p := ParseAlloc()
+	p.ParseSetRecovery(ParseRecovery{Delete: true})
+	p.ParseRecover(NUM, 1)
+	p.ParseRecover(PLUS, 0)
+	p.ParseRecover(RP, 0)
+	q := p.ParseClone()
+	q.ParseRecover(NUM, 2)
+	testCase(600, "[offset 0: syntax error near RP] [offset 0: syntax error near RP, deleted it]",
+		fmt.Sprint(p.ParseDiagnostics(), " ", q.ParseDiagnostics()))
+	q.ParseFree()
+	nTokenDestroyed = 0
+	p.ParseFinalize()
+	testCase(610, "2", fmt.Sprint(nTokenDestroyed))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
@@ -0,0 +1,136 @@
+// A test case for the errors ParseErr() gives after Parse(), and for the
+// state of the parser after an action panics.  Run as follows:
+//
+//     golemon -pull robust-test01.y && go run ./robust-test01.go
+//
+
+%token_type int
+%type expr {int}
+%type list {int}
+%left PLUS.
+
+%include {
+var nDestroyed = 0      /* Values of list and expr destroyed */
+var nTokenDestroyed = 0 /* Tokens destroyed */
+var sum = 0
+
+func yytestcase(condition bool) {}
+}
+
+%destructor list { nDestroyed++ }
+%destructor expr { nDestroyed++ }
+%token_destructor { nTokenDestroyed++ }
+
+program ::= list(A).                    { sum = A }
+list(A) ::= .                           { A = 0 }
+list(A) ::= list(B) expr(C) SEMI.       { A = B + C }
+expr(A) ::= expr(B) PLUS expr(C).       { if C == 0 { panic("adding zero") }; A = B + C }
+expr(A) ::= NUM(B).                     { A = B }
+
+%code {
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* A number, which feed() gives as a NUM token */
+type num int
+
+/* Give p the tokens, in which nums stand for NUM, and return the error
+** of ParseErr() after the last call to Parse(), and the panic, if any */
+func feed(p *yyParser, tokens ...interface{}) (err error, panicked interface{}) {
+	defer func() {
+		panicked = recover()
+	}()
+	for _, t := range tokens {
+		if n, ok := t.(num); ok {
+			p.Parse(NUM, int(n))
+		} else {
+			p.Parse(YYCODETYPE(t.(int)), 0)
+		}
+		err = p.ParseErr()
+	}
+	return err, nil
+}
+
+/* A lexer that gives the codes of a slice */
+type codeLexer []YYCODETYPE
+
+func (l *codeLexer) Next() (YYCODETYPE, ParseTOKENTYPE, ParseLocation, error) {
+	loc := ParseLocation{Offset: 10 - len(*l)}
+	if len(*l) == 0 {
+		return 0, 0, loc, nil
+	}
+	major := (*l)[0]
+	*l = (*l)[1:]
+	return major, 1, loc, nil
+}
+
+func main() {
+	p := ParseAlloc()
+	err, _ := feed(p, num(1), SEMI, num(2), PLUS, num(3), SEMI, 0)
+	testCase(100, "<nil> 6", fmt.Sprint(err, " ", sum))
+
+	/* A parser that has accepted its input takes no more tokens */
+	nTokenDestroyed = 0
+	err, _ = feed(p, num(4))
+	testCase(110, "the parser has accepted its input; call ParseInit() to parse again 1",
+		fmt.Sprint(err, " ", nTokenDestroyed))
+	p.ParseInit()
+	err, _ = feed(p, num(4), SEMI, 0)
+	testCase(120, "<nil> 4", fmt.Sprint(err, " ", sum))
+
+	/* Tokens of each kind run the %token_destructor they share when a
+	** rule takes them without an alias */
+	p.ParseInit()
+	nTokenDestroyed = 0
+	err, _ = feed(p, num(1), SEMI, num(2), PLUS, num(3), SEMI, 0)
+	testCase(130, "<nil> 3", fmt.Sprint(err, " ", nTokenDestroyed))
+
+	/* Nor does a parser that was never set up, and no code that is not
+	** a terminal is taken */
+	var zero yyParser
+	err, _ = feed(&zero, num(1))
+	testCase(200, "the parser was not set up by ParseAlloc() or ParseInit(); call ParseInit() to parse again",
+		fmt.Sprint(err))
+	p.ParseInit()
+	err, _ = feed(p, YYNOCODE, YYNTOKEN)
+	testCase(210, fmt.Sprintf("token code %d is not a terminal", YYNTOKEN), fmt.Sprint(err))
+	err, _ = feed(p, num(5), SEMI, 0)
+	testCase(220, "<nil> 5", fmt.Sprint(err, " ", sum))
+	lex := codeLexer{NUM, SEMI, YYNOCODE, NUM}
+	_, err = ParseAll(&lex)
+	testCase(230, fmt.Sprintf("offset 8: token code %d is not a terminal", YYNOCODE), fmt.Sprint(err))
+	testCase(240, "0 0 0", fmt.Sprint(ParseFallback(-1), " ", ParseFallback(YYNTOKEN), " ", ParseFallback(1<<20)))
+
+	/* When an action panics, the PLUS and SEMI of the rules reduced before
+	** have been destroyed.  The next call to Parse() destroys the values
+	** left on the stack, but those of the rule's right-hand side, which
+	** were given to the action, and then the token it is given. */
+	p.ParseInit()
+	nDestroyed, nTokenDestroyed = 0, 0
+	err, panicked := feed(p, num(1), PLUS, num(2), SEMI, num(3), PLUS, num(0), PLUS)
+	testCase(300, "<nil> adding zero 0 2", fmt.Sprint(err, " ", panicked, " ", nDestroyed, " ", nTokenDestroyed))
+	err, _ = feed(p, num(4))
+	testCase(310, "the parser failed when an action panicked; call ParseInit() to parse again 0 1 3",
+		fmt.Sprint(err, " ", p.yytos, " ", nDestroyed, " ", nTokenDestroyed))
+	p.ParseInit()
+	err, _ = feed(p, num(4), SEMI, 0)
+	testCase(320, "<nil> 4", fmt.Sprint(err, " ", sum))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
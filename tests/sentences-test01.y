@@ -0,0 +1,22 @@
+// A test case for "golemon sentences", whose output is fixed by -seed.
+// Each sentence must be accepted, and each mutated one rejected, by the
+// parser.  An empty line is the empty program.  Run as follows:
+//
+//     (golemon sentences -n 8 -depth 6 -seed 3 sentences-test01.y; golemon sentences -n 4 -depth 6 -seed 3 -invalid sentences-test01.y) | diff sentences-test01.out -
+//
+
+%left PLUS.
+%left TIMES.
+%nonassoc EQ.
+
+program ::= stmts.
+stmts ::= .
+stmts ::= stmts stmt SEMI.
+stmt ::= ID EQ expr.
+stmt ::= PRINT expr.
+expr ::= expr PLUS expr.
+expr ::= expr TIMES expr.
+expr ::= expr EQ expr.
+expr ::= LP expr RP.
+expr ::= NUM.
+expr ::= ID.
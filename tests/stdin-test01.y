@@ -0,0 +1,36 @@
+// A test case for a grammar read from standard input, and a parser
+// written to standard output.  Run as follows:
+//
+//     golemon -q -o - -filename stdin-test01.y - <stdin-test01.y >stdin-test01.go && go run ./stdin-test01.go
+//
+
+%token_type int
+%type sum {int}
+
+%include {
+var result = 0
+
+func yytestcase(condition bool) {}
+}
+
+program ::= sum(A).         { result = A }
+sum(A) ::= NUM(B).          { A = B }
+sum(A) ::= sum(B) PLUS NUM(C). { A = B + C }
+
+%code {
+func main() {
+	p := ParseAlloc()
+	for _, t := range []struct {
+		major YYCODETYPE
+		minor int
+	}{{NUM, 1}, {PLUS, 0}, {NUM, 2}, {PLUS, 0}, {NUM, 3}, {0, 0}} {
+		p.Parse(t.major, t.minor)
+	}
+	p.ParseFinalize()
+	if result != 6 {
+		fmt.Printf("test 100: got %d, expected 6\n", result)
+		os.Exit(1)
+	}
+	fmt.Printf("test 100: ok\n1 tests pass\n")
+}
+}
@@ -0,0 +1,7 @@
+// A test case for the outputs that cannot go to standard output.  Run as
+// follows:
+//
+//     (golemon -q -o - -sql - stdin-test02.y; golemon -q -o - - <stdin-test02.y) 2>&1 | diff stdin-test02.out -
+//
+
+program ::= A.
@@ -0,0 +1,134 @@
+// A test case for -tables=string, with enough states that the action
+// table needs two bytes an entry.  Run as follows:
+//
+//     golemon -tables=string tables-test01.y && go run ./tables-test01.go
+//
+
+%token_type int
+%type program {int}
+%type stmts   {int}
+%type stmt    {int}
+%type expr    {int}
+%left PLUS MINUS.
+%left TIMES.
+
+%include {
+var result = 0
+
+func yytestcase(condition bool) {}
+}
+
+program(P) ::= stmts(L).               { P = L; result = L }
+stmts(A) ::= .                         { A = 0 }
+stmts(A) ::= stmts(B) stmt(C).         { A = B + C }
+expr(A) ::= expr(B) PLUS expr(C).      { A = B + C }
+expr(A) ::= expr(B) MINUS expr(C).     { A = B - C }
+expr(A) ::= expr(B) TIMES expr(C).     { A = B * C }
+expr(A) ::= LP expr(B) RP.             { A = B }
+expr(A) ::= NUM(B).                    { A = B }
+stmt(A) ::= K01 expr(B) SEMI.          { A = 1 * B }
+stmt(A) ::= K02 expr(B) SEMI.          { A = 2 * B }
+stmt(A) ::= K03 expr(B) SEMI.          { A = 3 * B }
+stmt(A) ::= K04 expr(B) SEMI.          { A = 4 * B }
+stmt(A) ::= K05 expr(B) SEMI.          { A = 5 * B }
+stmt(A) ::= K06 expr(B) SEMI.          { A = 6 * B }
+stmt(A) ::= K07 expr(B) SEMI.          { A = 7 * B }
+stmt(A) ::= K08 expr(B) SEMI.          { A = 8 * B }
+stmt(A) ::= K09 expr(B) SEMI.          { A = 9 * B }
+stmt(A) ::= K10 expr(B) SEMI.          { A = 10 * B }
+stmt(A) ::= K11 expr(B) SEMI.          { A = 11 * B }
+stmt(A) ::= K12 expr(B) SEMI.          { A = 12 * B }
+stmt(A) ::= K13 expr(B) SEMI.          { A = 13 * B }
+stmt(A) ::= K14 expr(B) SEMI.          { A = 14 * B }
+stmt(A) ::= K15 expr(B) SEMI.          { A = 15 * B }
+stmt(A) ::= K16 expr(B) SEMI.          { A = 16 * B }
+stmt(A) ::= K17 expr(B) SEMI.          { A = 17 * B }
+stmt(A) ::= K18 expr(B) SEMI.          { A = 18 * B }
+stmt(A) ::= K19 expr(B) SEMI.          { A = 19 * B }
+stmt(A) ::= K20 expr(B) SEMI.          { A = 20 * B }
+stmt(A) ::= K21 expr(B) SEMI.          { A = 21 * B }
+stmt(A) ::= K22 expr(B) SEMI.          { A = 22 * B }
+stmt(A) ::= K23 expr(B) SEMI.          { A = 23 * B }
+stmt(A) ::= K24 expr(B) SEMI.          { A = 24 * B }
+stmt(A) ::= K25 expr(B) SEMI.          { A = 25 * B }
+stmt(A) ::= K26 expr(B) SEMI.          { A = 26 * B }
+stmt(A) ::= K27 expr(B) SEMI.          { A = 27 * B }
+stmt(A) ::= K28 expr(B) SEMI.          { A = 28 * B }
+stmt(A) ::= K29 expr(B) SEMI.          { A = 29 * B }
+stmt(A) ::= K30 expr(B) SEMI.          { A = 30 * B }
+stmt(A) ::= K31 expr(B) SEMI.          { A = 31 * B }
+stmt(A) ::= K32 expr(B) SEMI.          { A = 32 * B }
+stmt(A) ::= K33 expr(B) SEMI.          { A = 33 * B }
+stmt(A) ::= K34 expr(B) SEMI.          { A = 34 * B }
+stmt(A) ::= K35 expr(B) SEMI.          { A = 35 * B }
+stmt(A) ::= K36 expr(B) SEMI.          { A = 36 * B }
+stmt(A) ::= K37 expr(B) SEMI.          { A = 37 * B }
+stmt(A) ::= K38 expr(B) SEMI.          { A = 38 * B }
+stmt(A) ::= K39 expr(B) SEMI.          { A = 39 * B }
+stmt(A) ::= K40 expr(B) SEMI.          { A = 40 * B }
+stmt(A) ::= K41 expr(B) SEMI.          { A = 41 * B }
+stmt(A) ::= K42 expr(B) SEMI.          { A = 42 * B }
+stmt(A) ::= K43 expr(B) SEMI.          { A = 43 * B }
+stmt(A) ::= K44 expr(B) SEMI.          { A = 44 * B }
+stmt(A) ::= K45 expr(B) SEMI.          { A = 45 * B }
+stmt(A) ::= K46 expr(B) SEMI.          { A = 46 * B }
+stmt(A) ::= K47 expr(B) SEMI.          { A = 47 * B }
+stmt(A) ::= K48 expr(B) SEMI.          { A = 48 * B }
+stmt(A) ::= K49 expr(B) SEMI.          { A = 49 * B }
+stmt(A) ::= K50 expr(B) SEMI.          { A = 50 * B }
+stmt(A) ::= K51 expr(B) SEMI.          { A = 51 * B }
+stmt(A) ::= K52 expr(B) SEMI.          { A = 52 * B }
+stmt(A) ::= K53 expr(B) SEMI.          { A = 53 * B }
+stmt(A) ::= K54 expr(B) SEMI.          { A = 54 * B }
+stmt(A) ::= K55 expr(B) SEMI.          { A = 55 * B }
+stmt(A) ::= K56 expr(B) SEMI.          { A = 56 * B }
+stmt(A) ::= K57 expr(B) SEMI.          { A = 57 * B }
+stmt(A) ::= K58 expr(B) SEMI.          { A = 58 * B }
+stmt(A) ::= K59 expr(B) SEMI.          { A = 59 * B }
+stmt(A) ::= K60 expr(B) SEMI.          { A = 60 * B }
+
+%code {
+var nTest int
+var nErr int
+
+func testCase(testId int, shouldBe string, actual string) {
+	nTest++
+	if shouldBe == actual {
+		fmt.Printf("test %d: ok\n", testId)
+	} else {
+		fmt.Printf("test %d: got %q, expected %q\n", testId, actual, shouldBe)
+		nErr++
+	}
+}
+
+/* Parse the tokens, in which ints stand for NUM, and return the result */
+func parse(tokens ...YYCODETYPE) int {
+	result = -1
+	p := ParseAlloc()
+	for _, t := range tokens {
+		p.Parse(t, int(t))
+	}
+	p.Parse(0, 0)
+	p.ParseFinalize()
+	return result
+}
+
+func main() {
+	testCase(100, "uint16 int16", fmt.Sprintf("%T %T", yy_action_at(0), yy_reduce_ofst_at(0)))
+	testCase(110, "true", fmt.Sprint(YY_MAX_REDUCE > 255))
+
+	testCase(200, "0", fmt.Sprint(parse()))
+	/* K01 NUM(2) SEMI: NUM carries its own code as its value */
+	testCase(210, fmt.Sprint(NUM), fmt.Sprint(parse(K01, NUM, SEMI)))
+	testCase(220, fmt.Sprint(60*(NUM+NUM*NUM)), fmt.Sprint(parse(K60, NUM, PLUS, NUM, TIMES, NUM, SEMI)))
+	testCase(230, fmt.Sprint(30*((NUM-NUM)*NUM)+7*NUM), fmt.Sprint(parse(K30, LP, NUM, MINUS, NUM, RP, TIMES, NUM, SEMI, K07, NUM, SEMI)))
+	testCase(240, "-1", fmt.Sprint(parse(K01, NUM)))
+
+	if nErr == 0 {
+		fmt.Printf("%d tests pass\n", nTest)
+	} else {
+		fmt.Printf("%d errors out %d tests\n", nErr, nTest)
+		os.Exit(nErr)
+	}
+}
+}
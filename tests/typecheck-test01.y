@@ -0,0 +1,20 @@
+// A test case for -typecheck, with type errors in actions that hold
+// several statements on one line, which gofmt would split.  Run as
+// follows:
+//
+//     golemon -typecheck -q -o - typecheck-test01.y 2>&1 >/dev/null | diff typecheck-test01.out -
+//
+
+%token_type int
+%type expr {int}
+%type name {string}
+
+%include {
+func yytestcase(condition bool) {}
+}
+
+program ::= expr(A).                 { _ = A }
+expr(A) ::= NUM(B).                  { n := B; A = n }
+expr(A) ::= expr(B) PLUS name(C).    { n := C; A = B + n }
+expr(A) ::= name(B).                 { A = len(B); var s string = A; _ = s }
+name(A) ::= ID(B).                   { A = "x"; A = B }
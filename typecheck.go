@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+** Type-checking rule actions (-typecheck).
+**
+** translate_code() turns the aliases in an action into accesses to the
+** parser stack, such as yypParser.yystack[yypParser.yytos+-2].minor.yy3,
+** so a type error in an action is reported by the Go compiler in terms of
+** the generated code.  With -typecheck, the generated parser is checked
+** with go/types together with the other Go files of its package in the
+** same directory.  Each error is reported against the line of the grammar
+** that the //line directives point to, with the stack accesses written
+** back as the aliases they came from, followed by the symbol and type of
+** each alias mentioned.
+ */
+
+/* Matches a value on the parser stack, as printed by go/types */
+var stackExprRe = regexp.MustCompile(`yypParser\.yystack\[yypParser\.yytos\s*\+\s*(-?\d+)\]\.(minor\.yy\d+|major)|yylhsminor\.yy\d+`)
+
+/* Describe the value carried by sp, as declared in the grammar */
+func typecheck_typedecl(lemp *lemon, sp *symbol) string {
+	if sp.typ == TERMINAL || sp.typ == MULTITERMINAL {
+		return fmt.Sprintf("%%token_type {%s}", strings.TrimSpace(lemp.tokentype))
+	}
+	if sp.datatype != "" {
+		return fmt.Sprintf("%%type {%s}", strings.TrimSpace(sp.datatype))
+	}
+	return fmt.Sprintf("%%default_type {%s}", strings.TrimSpace(lemp.vartype))
+}
+
+/* Rewrite the stack accesses in msg, an error in the action of rp, as the
+** aliases they stand for.  Return the new message and a description of
+** each alias used. */
+func typecheck_aliases(lemp *lemon, rp *rule, msg string) (string, []string) {
+	var notes []string
+	seen := make(map[string]bool)
+	note := func(alias string, sp *symbol) {
+		if !seen[alias] {
+			seen[alias] = true
+			notes = append(notes, fmt.Sprintf("%s is %s, %s", alias, sp.name, typecheck_typedecl(lemp, sp)))
+		}
+	}
+	msg = stackExprRe.ReplaceAllStringFunc(msg, func(m string) string {
+		sub := stackExprRe.FindStringSubmatch(m)
+		i := len(rp.rhs)
+		if sub[1] != "" {
+			ofst, _ := strconv.Atoi(sub[1])
+			i = ofst + len(rp.rhs) - 1
+		}
+		if i >= 0 && i < len(rp.rhs) && rp.rhsalias[i] != "" {
+			note(rp.rhsalias[i], rp.rhs[i])
+			if sub[2] == "major" {
+				return "@" + rp.rhsalias[i]
+			}
+			return rp.rhsalias[i]
+		}
+		if rp.lhsalias != "" && sub[2] != "major" {
+			note(rp.lhsalias, rp.lhs)
+			return rp.lhsalias
+		}
+		return m
+	})
+	return msg, notes
+}
+
+/* Return the rule whose action contains pos in the generated parser f,
+** by finding the case of the switch on yyruleno in which it lies.  Return
+** nil if pos is not in a rule action. */
+func typecheck_rule(lemp *lemon, f *ast.File, pos token.Pos) *rule {
+	var iRule = -1
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		if sw, ok := n.(*ast.SwitchStmt); ok {
+			if id, ok := sw.Tag.(*ast.Ident); !ok || id.Name != "yyruleno" {
+				return true
+			}
+			for _, stmt := range sw.Body.List {
+				cc := stmt.(*ast.CaseClause)
+				if pos < cc.Pos() || pos >= cc.End() || len(cc.List) == 0 {
+					continue
+				}
+				if lit, ok := cc.List[0].(*ast.BasicLit); ok {
+					iRule, _ = strconv.Atoi(lit.Value)
+				}
+			}
+			return false
+		}
+		return true
+	})
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.iRule == iRule {
+			return rp
+		}
+	}
+	return nil
+}
+
+/* Parse the other Go files of the package in the directory of filename */
+func typecheck_package_files(fset *token.FileSet, filename string, pkg string) []*ast.File {
+	var files []*ast.File
+	if filename == "-" {
+		return nil /* Written to standard output, so not part of a package */
+	}
+	names, _ := filepath.Glob(filepath.Join(filepath.Dir(filename), "*.go"))
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") || filepath.Clean(name) == filepath.Clean(filename) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != pkg {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+/* Type-check the generated parser, which will be called filename and is
+** for now in the file called path, and report errors in rule actions
+** against the grammar.  This is done before format_output() rewrites the
+** file, so each action is still on the lines it has in the grammar. */
+func typecheck_output(lemp *lemon, path string, filename string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return /* Reported by format_output() */
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return /* Reported by format_output() */
+	}
+	files := append([]*ast.File{f}, typecheck_package_files(fset, filename, f.Name.Name)...)
+
+	/* go/types follows an error with continuation errors, whose messages
+	** start with a tab, such as "\tother declaration of X".  Each error is
+	** kept with its continuations, and the group is reported if any of
+	** them is in the parser. */
+	var groups [][]types.Error
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			terr, ok := err.(types.Error)
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(terr.Msg, "\t") && len(groups) > 0 {
+				groups[len(groups)-1] = append(groups[len(groups)-1], terr)
+			} else {
+				groups = append(groups, []types.Error{terr})
+			}
+		},
+	}
+	conf.Check(f.Name.Name, fset, files, nil)
+
+	inParser := func(e types.Error) bool {
+		raw := fset.PositionFor(e.Pos, false)
+		return filepath.Clean(raw.Filename) == filepath.Clean(filename)
+	}
+	for _, group := range groups {
+		keep := false
+		for _, e := range group {
+			keep = keep || inParser(e)
+		}
+		if !keep {
+			continue /* In other files of the package */
+		}
+		for _, e := range group {
+			typecheck_report(lemp, f, e, inParser(e))
+		}
+		lemp.errorcnt++
+	}
+}
+
+/* Report the error e, against the rule whose action it is in if it is in
+** the parser f, or else at its own position in another file */
+func typecheck_report(lemp *lemon, f *ast.File, e types.Error, inParser bool) {
+	pos := e.Fset.Position(e.Pos)
+	var rp *rule
+	if inParser {
+		rp = typecheck_rule(lemp, f, e.Pos)
+	}
+	if rp == nil {
+		ErrorMsg(pos.Filename, pos.Line, "%s", e.Msg)
+		return
+	}
+	msg, notes := typecheck_aliases(lemp, rp, e.Msg)
+	var sb strings.Builder
+	rule_print(&sb, rp)
+	ErrorMsg(pos.Filename, pos.Line, "%s, in the action of rule \"%s.\"", msg, sb.String())
+	for _, n := range notes {
+		fmt.Fprintf(os.Stderr, "    %s\n", n)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+/*
+** Recording how a parser was generated.
+**
+** The generated parser begins with the "Code generated ... DO NOT EDIT."
+** line that Go tools look for, and a comment giving the golemon version,
+** a hash of the grammar after preprocessing (including any files read
+** with %include_file or %import), a hash of the template, and the
+** -D defines in effect.  Nothing in it depends on the time or the machine,
+** so the same inputs always give the same output.
+ */
+
+/* Return the version of golemon, as recorded by the Go toolchain */
+func golemon_version() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+	return "(devel)"
+}
+
+/* Return the -D defines in effect, as command-line options */
+func effective_defines() string {
+	var opts []string
+	for name, value := range azDefine {
+		opts = append(opts, fmt.Sprintf("-D %s=%s", name, value))
+	}
+	if len(opts) == 0 {
+		return "(none)"
+	}
+	sort.Strings(opts)
+	return strings.Join(opts, " ")
+}
+
+/* Return the lines of the header describing how the parser was made, each
+** beginning with prefix.  tpltname and tplt are the name and contents of
+** the template. */
+func generated_header(lemp *lemon, prefix string, tpltname string, tplt []byte) []string {
+	return []string{
+		fmt.Sprintf("%sGenerator: golemon %s", prefix, golemon_version()),
+		fmt.Sprintf("%sGrammar:   %s sha256:%x", prefix, lemp.filename, lemp.inputHash.Sum(nil)),
+		fmt.Sprintf("%sTemplate:  %s sha256:%x", prefix, filepath.Base(tpltname), sha256.Sum256(tplt)),
+		fmt.Sprintf("%sDefines:   %s", prefix, effective_defines()),
+	}
+}